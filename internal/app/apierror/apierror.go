@@ -12,6 +12,8 @@ import (
 type APIError struct {
 	Status  int    `json:"-"`
 	Message string `json:"message"`
+	// Details is an optional machine readable explanation returned along with the message.
+	Details any `json:"details,omitempty"`
 	wrapped error
 }
 
@@ -39,9 +41,11 @@ var (
 		Status:  http.StatusUnauthorized,
 		Message: "unauthorized",
 	}
-	WrongPasswordError = APIError{
+	// InvalidCredentialsError is returned both for an unknown user and a wrong password,
+	// so that the response doesn't tell which usernames exist.
+	InvalidCredentialsError = APIError{
 		Status:  http.StatusUnauthorized,
-		Message: "wrong password",
+		Message: "wrong username or password",
 	}
 	BadAuthHeaderError = APIError{
 		Status:  http.StatusUnauthorized,
@@ -51,6 +55,18 @@ var (
 		Status:  http.StatusUnauthorized,
 		Message: "empty or invalid token",
 	}
+	RevokedTokenError = APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "token has been revoked",
+	}
+	RefreshTokenReusedError = APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "refresh token has already been used",
+	}
+	ForbiddenError = APIError{
+		Status:  http.StatusForbidden,
+		Message: "forbidden",
+	}
 	BadRequestError = APIError{
 		Status:  http.StatusBadRequest,
 		Message: "bad request error",
@@ -59,6 +75,98 @@ var (
 		Status:  http.StatusBadRequest,
 		Message: "no such item exists",
 	}
+	ItemArchivedError = APIError{
+		Status:  http.StatusBadRequest,
+		Message: "item is no longer sold",
+	}
+	OutOfStockError = APIError{
+		Status:  http.StatusConflict,
+		Message: "item is out of stock",
+	}
+	ItemNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "item not found",
+	}
+	ItemAlreadyExistsError = APIError{
+		Status:  http.StatusConflict,
+		Message: "item already exists",
+	}
+	OrderNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "order not found",
+	}
+	OrderStatusTransitionError = APIError{
+		Status:  http.StatusConflict,
+		Message: "order can't be moved to this status",
+	}
+	OrderNotRefundableError = APIError{
+		Status:  http.StatusConflict,
+		Message: "order can't be refunded",
+	}
+	RefundPeriodExpiredError = APIError{
+		Status:  http.StatusConflict,
+		Message: "refund period has expired",
+	}
+	TransferLimitExceededError = APIError{
+		Status:  http.StatusBadRequest,
+		Message: "transfer limit exceeded",
+	}
+	ApprovalNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "approval not found",
+	}
+	ApprovalDecidedError = APIError{
+		Status:  http.StatusConflict,
+		Message: "transfer is already decided",
+	}
+	ApprovalExpiredError = APIError{
+		Status:  http.StatusConflict,
+		Message: "approval has expired",
+	}
+	CoinRequestNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "coin request not found",
+	}
+	CoinRequestDecidedError = APIError{
+		Status:  http.StatusConflict,
+		Message: "coin request is already decided",
+	}
+	ScheduledTransferNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "scheduled transfer not found",
+	}
+	ScheduledTransferNotActiveError = APIError{
+		Status:  http.StatusConflict,
+		Message: "scheduled transfer is not active",
+	}
+	WalletNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "wallet not found",
+	}
+	WalletAlreadyExistsError = APIError{
+		Status:  http.StatusConflict,
+		Message: "wallet already exists",
+	}
+	WalletMemberNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "wallet member not found",
+	}
+	WalletLastOwnerError = APIError{
+		Status:  http.StatusConflict,
+		Message: "wallet must have an owner",
+	}
+	IdempotencyKeyNotFoundError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "idempotency key not found",
+	}
+	IdempotencyKeyReusedError = APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: "idempotency key was already used for another request",
+	}
+	IdempotencyKeyInProgressError = APIError{
+		Status:  http.StatusConflict,
+		Message: "request with this idempotency key is already being processed",
+	}
 	InvalidAuthInput = APIError{
 		Status:  http.StatusBadRequest,
 		Message: "invalid username or password",
@@ -67,6 +175,18 @@ var (
 		Status:  http.StatusBadRequest,
 		Message: "not enough money",
 	}
+	UserNotFoundError = APIError{
+		Status:  http.StatusUnauthorized,
+		Message: "user not found",
+	}
+	NoSuchUserError = APIError{
+		Status:  http.StatusNotFound,
+		Message: "no such user exists",
+	}
+	UserAlreadyExistsError = APIError{
+		Status:  http.StatusConflict,
+		Message: "user already exists",
+	}
 )
 
 func NewAPIError(apiErr APIError, err error) error {
@@ -79,6 +199,12 @@ func NewAPIErrorWithMsg(apiErr APIError, msg string) error {
 	return apiErr
 }
 
+func NewAPIErrorWithDetails(apiErr APIError, msg string, details any) error {
+	apiErr.wrapped = errors.New(msg)
+	apiErr.Details = details
+	return apiErr
+}
+
 func GetAPIError(err error) APIError {
 	if apiErr := new(APIError); errors.As(err, apiErr) {
 		return *apiErr
@@ -86,10 +212,17 @@ func GetAPIError(err error) APIError {
 	return InternalError
 }
 
+// Is reports whether err carries the same API error as target.
+func Is(err error, target APIError) bool {
+	apiErr := GetAPIError(err)
+	return apiErr.Status == target.Status && apiErr.Message == target.Message
+}
+
 func LogAndRespondError(ctx *gin.Context, l *slog.Logger, err error) {
 	l.Error(err.Error())
 	apiError := GetAPIError(err)
 	ctx.AbortWithStatusJSON(apiError.Status, APIError{
 		Message: apiError.Message,
+		Details: apiError.Details,
 	})
 }
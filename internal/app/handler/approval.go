@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func getApprovalID(ctx *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.ApprovalNotFoundError, "invalid approval id")
+	}
+	return id, nil
+}
+
+// GetApprovals lists the pending transfers the user may decide on.
+func (h *Handler) GetApprovals(ctx *gin.Context) {
+	const op = "handler.approval.GetApprovals"
+
+	claims, err := getClaims(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting claims", op))
+		return
+	}
+
+	approvals, err := h.approvalService.GetApprovals(claims.Username, claims.Role == model.RoleAdmin)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting approvals", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, approvals)
+}
+
+func (h *Handler) ApproveTransfer(ctx *gin.Context) {
+	h.decideApproval(ctx, true)
+}
+
+func (h *Handler) RejectTransfer(ctx *gin.Context) {
+	h.decideApproval(ctx, false)
+}
+
+func (h *Handler) decideApproval(ctx *gin.Context, approve bool) {
+	const op = "handler.approval.decideApproval"
+
+	claims, err := getClaims(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting claims", op))
+		return
+	}
+
+	id, err := getApprovalID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting approval id", op))
+		return
+	}
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	approval, err := h.approvalService.DecideApproval(model.ApprovalDecision{
+		ID:       id,
+		Approver: claims.Username,
+		Admin:    claims.Role == model.RoleAdmin,
+		Approve:  approve,
+	}, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while deciding on approval", op))
+		return
+	}
+
+	h.logger.Info("transfer decided",
+		slog.String("approver", claims.Username), slog.Int64("approval", id), slog.String("status", approval.Status))
+
+	ctx.JSON(http.StatusOK, approval)
+}
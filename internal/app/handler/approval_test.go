@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockApprovalService struct {
+	mock.Mock
+}
+
+func (m *MockApprovalService) GetApprovals(approver string, admin bool) ([]model.TransferApproval, error) {
+	args := m.Called(approver, admin)
+	approvals, _ := args.Get(0).([]model.TransferApproval)
+	return approvals, args.Error(1)
+}
+
+func (m *MockApprovalService) DecideApproval(decision model.ApprovalDecision,
+	key *model.IdempotencyKey) (model.TransferApproval, error) {
+	args := m.Called(decision, key)
+	approval, _ := args.Get(0).(model.TransferApproval)
+	return approval, args.Error(1)
+}
+
+func TestHandler_GetApprovals(t *testing.T) {
+	tests := []struct {
+		name      string
+		claims    model.TokenClaims
+		wantAdmin bool
+	}{
+		{
+			name:   "manager",
+			claims: model.TokenClaims{Username: "boss", Role: model.RoleUser},
+		},
+		{
+			name:      "admin",
+			claims:    model.TokenClaims{Username: "admin", Role: model.RoleAdmin},
+			wantAdmin: true,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approvalService := new(MockApprovalService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, approvalService, nil, nil)
+			approvalService.On("GetApprovals", tt.claims.Username, tt.wantAdmin).
+				Return([]model.TransferApproval{{ID: 1, Status: model.ApprovalStatusPending}}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(claimsField, tt.claims)
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/approvals", nil)
+
+			h.GetApprovals(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"id":1`)
+			approvalService.AssertCalled(t, "GetApprovals", tt.claims.Username, tt.wantAdmin)
+		})
+	}
+}
+
+func TestHandler_decideApproval(t *testing.T) {
+	type inputArgs struct {
+		id                        string
+		approve                   bool
+		claims                    model.TokenClaims
+		decideApprovalOutputError error
+	}
+
+	tests := []struct {
+		name         string
+		args         inputArgs
+		wantDecision model.ApprovalDecision
+		wantErr      *apierror.APIError
+	}{
+		{
+			name: "approve by manager",
+			args: inputArgs{
+				id:      "1",
+				approve: true,
+				claims:  model.TokenClaims{Username: "boss", Role: model.RoleUser},
+			},
+			wantDecision: model.ApprovalDecision{ID: 1, Approver: "boss", Approve: true},
+		},
+		{
+			name: "reject by admin",
+			args: inputArgs{
+				id:     "1",
+				claims: model.TokenClaims{Username: "admin", Role: model.RoleAdmin},
+			},
+			wantDecision: model.ApprovalDecision{ID: 1, Approver: "admin", Admin: true},
+		},
+		{
+			name: "invalid id",
+			args: inputArgs{
+				id:     "first",
+				claims: model.TokenClaims{Username: "boss", Role: model.RoleUser},
+			},
+			wantErr: &apierror.ApprovalNotFoundError,
+		},
+		{
+			name: "not a manager",
+			args: inputArgs{
+				id:                        "1",
+				approve:                   true,
+				claims:                    model.TokenClaims{Username: "user", Role: model.RoleUser},
+				decideApprovalOutputError: apierror.NewAPIErrorWithMsg(apierror.ForbiddenError, "mock"),
+			},
+			wantErr: &apierror.ForbiddenError,
+		},
+		{
+			name: "already decided",
+			args: inputArgs{
+				id:                        "1",
+				approve:                   true,
+				claims:                    model.TokenClaims{Username: "boss", Role: model.RoleUser},
+				decideApprovalOutputError: apierror.NewAPIErrorWithMsg(apierror.ApprovalDecidedError, "mock"),
+			},
+			wantErr: &apierror.ApprovalDecidedError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approvalService := new(MockApprovalService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, approvalService, nil, nil)
+			approvalService.On("DecideApproval", mock.Anything, mock.Anything).
+				Return(model.TransferApproval{ID: 1, Status: model.ApprovalStatusApproved}, tt.args.decideApprovalOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(claimsField, tt.args.claims)
+			c.Params = []gin.Param{{Key: "id", Value: tt.args.id}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/approvals/"+tt.args.id, nil)
+
+			if tt.args.approve {
+				h.ApproveTransfer(c)
+			} else {
+				h.RejectTransfer(c)
+			}
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			approvalService.AssertCalled(t, "DecideApproval", tt.wantDecision, (*model.IdempotencyKey)(nil))
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -15,8 +18,13 @@ import (
 const (
 	authHeader    = "Authorization"
 	usernameField = "username"
+	claimsField   = "claims"
 )
 
+// usernamePattern allows 3-32 latin letters, digits, dots, dashes and underscores
+// starting with a letter or a digit.
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{2,31}$`)
+
 func validateAuthInput(input model.AuthInput) error {
 	switch {
 	case input.Username == "":
@@ -31,6 +39,51 @@ func validateAuthInput(input model.AuthInput) error {
 	}
 }
 
+func validateRegisterInput(input model.AuthInput) error {
+	if err := validateAuthInput(input); err != nil {
+		return err
+	}
+
+	if !usernamePattern.MatchString(input.Username) {
+		return apierror.NewAPIErrorWithMsg(apierror.InvalidAuthInput,
+			"username must be 3-32 characters long and contain only latin letters, digits, '.', '-' and '_'")
+	}
+
+	return nil
+}
+
+func (h *Handler) Register(ctx *gin.Context) {
+	const op = "handler.auth.Register"
+	var input model.AuthInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": "+"error while getting data from request body"))
+		return
+	}
+
+	if err := validateRegisterInput(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: validation failed", op))
+		return
+	}
+
+	h.logger.Info("registering user", slog.String("username", input.Username))
+
+	if err := h.authService.Register(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while registering user", op))
+		return
+	}
+
+	h.logger.Info("user registered", slog.String("username", input.Username))
+
+	tokens, err := h.authService.GenerateTokens(input.Username)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while generating token", op))
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, tokens)
+}
+
 func (h *Handler) Auth(ctx *gin.Context) {
 	const op = "handler.auth.Auth"
 	var input model.AuthInput
@@ -54,7 +107,7 @@ func (h *Handler) Auth(ctx *gin.Context) {
 
 	h.logger.Info("user authenticated", slog.String("username", input.Username))
 
-	token, err := h.authService.GenerateToken(input.Username)
+	tokens, err := h.authService.GenerateTokens(input.Username)
 	if err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while generating token", op))
 		return
@@ -62,9 +115,61 @@ func (h *Handler) Auth(ctx *gin.Context) {
 
 	h.logger.Info("token generated", slog.String("username", input.Username))
 
-	ctx.JSON(http.StatusOK, model.AuthOutput{
-		Token: token,
-	})
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) RefreshToken(ctx *gin.Context) {
+	const op = "handler.auth.RefreshToken"
+	var input model.RefreshInput
+	if err := ctx.ShouldBindJSON(&input); err != nil || input.RefreshToken == "" {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": "+"error while getting data from request body"))
+		return
+	}
+
+	tokens, err := h.authService.RefreshTokens(input.RefreshToken)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while refreshing token", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+func (h *Handler) Logout(ctx *gin.Context) {
+	const op = "handler.auth.Logout"
+
+	claims, err := getClaims(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting claims", op))
+		return
+	}
+
+	// the refresh token is optional: without it only the current access token is revoked
+	var input model.RefreshInput
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			apierror.LogAndRespondError(ctx, h.logger,
+				apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+			return
+		}
+	}
+
+	if err := h.authService.Logout(claims, input.RefreshToken); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while logging out", op))
+		return
+	}
+
+	h.logger.Info("user logged out", slog.String("username", claims.Username))
+
+	ctx.Status(http.StatusOK)
+}
+
+// JWKS publishes the token verification keys so that other services
+// can check shop tokens without sharing a secret.
+func (h *Handler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.authService.JWKS())
 }
 
 func getTokenFromHeader(header string) (string, error) {
@@ -94,13 +199,14 @@ func (h *Handler) UserIdentify(ctx *gin.Context) {
 		return
 	}
 
-	username, err := h.authService.ParseToken(token)
+	claims, err := h.authService.ParseToken(token)
 	if err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while parse token", op))
 		return
 	}
 
-	ctx.Set(usernameField, username)
+	ctx.Set(usernameField, claims.Username)
+	ctx.Set(claimsField, claims)
 	ctx.Next()
 }
 
@@ -121,3 +227,114 @@ func getUsername(ctx *gin.Context) (string, error) {
 
 	return username, nil
 }
+
+// RequireRole must follow UserIdentify and lets through only users with one of the given roles.
+func (h *Handler) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		const op = "handler.auth.RequireRole"
+
+		claims, err := getClaims(ctx)
+		if err != nil {
+			apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting claims", op))
+			return
+		}
+
+		if !slices.Contains(roles, claims.Role) {
+			apierror.LogAndRespondError(ctx, h.logger, apierror.NewAPIErrorWithMsg(apierror.ForbiddenError,
+				fmt.Sprintf("%s: role %q of user %s is not allowed", op, claims.Role, claims.Username)))
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func validateRoleInput(input model.RoleInput) error {
+	switch input.Role {
+	case model.RoleUser, model.RoleAdmin, model.RoleAuditor:
+		return nil
+	default:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "unknown role")
+	}
+}
+
+func (h *Handler) SetUserRole(ctx *gin.Context) {
+	const op = "handler.auth.SetUserRole"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.RoleInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateRoleInput(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	username := ctx.Param("username")
+	if err := h.authService.SetRole(username, input.Role); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while setting role", op))
+		return
+	}
+
+	h.logger.Info("role changed",
+		slog.String("admin", admin), slog.String("username", username), slog.String("role", input.Role))
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) SetUserManager(ctx *gin.Context) {
+	const op = "handler.auth.SetUserManager"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.ManagerInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	username := ctx.Param("username")
+	if input.Manager == username {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": user can't be their own manager"))
+		return
+	}
+
+	if err := h.authService.SetManager(username, input.Manager); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while setting manager", op))
+		return
+	}
+
+	h.logger.Info("manager changed",
+		slog.String("admin", admin), slog.String("username", username), slog.String("manager", input.Manager))
+
+	ctx.Status(http.StatusOK)
+}
+
+func getClaims(ctx *gin.Context) (model.TokenClaims, error) {
+	data, ok := ctx.Get(claimsField)
+	if !ok {
+		return model.TokenClaims{}, apierror.NewAPIErrorWithMsg(apierror.UnauthorizedError, "claims field not found in context")
+	}
+
+	claims, ok := data.(model.TokenClaims)
+	if !ok {
+		return model.TokenClaims{}, apierror.NewAPIErrorWithMsg(apierror.UnauthorizedError, "claims are not a token claims type")
+	}
+
+	return claims, nil
+}
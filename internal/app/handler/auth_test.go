@@ -27,14 +27,48 @@ func (m *MockAuthService) Auth(input model.AuthInput) error {
 	return args.Error(0)
 }
 
-func (m *MockAuthService) GenerateToken(username string) (string, error) {
+func (m *MockAuthService) Register(input model.AuthInput) error {
+	args := m.Called(input)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) GenerateTokens(username string) (model.AuthOutput, error) {
 	args := m.Called(username)
-	return args.String(0), args.Error(1)
+	tokens, _ := args.Get(0).(model.AuthOutput)
+	return tokens, args.Error(1)
 }
 
-func (m *MockAuthService) ParseToken(token string) (string, error) {
+func (m *MockAuthService) ParseToken(token string) (model.TokenClaims, error) {
 	args := m.Called(token)
-	return args.String(0), args.Error(1)
+	claims, _ := args.Get(0).(model.TokenClaims)
+	return claims, args.Error(1)
+}
+
+func (m *MockAuthService) RefreshTokens(refreshToken string) (model.AuthOutput, error) {
+	args := m.Called(refreshToken)
+	tokens, _ := args.Get(0).(model.AuthOutput)
+	return tokens, args.Error(1)
+}
+
+func (m *MockAuthService) Logout(claims model.TokenClaims, refreshToken string) error {
+	args := m.Called(claims, refreshToken)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) SetRole(username, role string) error {
+	args := m.Called(username, role)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) SetManager(username, manager string) error {
+	args := m.Called(username, manager)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) JWKS() model.JWKS {
+	args := m.Called()
+	jwks, _ := args.Get(0).(model.JWKS)
+	return jwks
 }
 
 func TestHandler_validateAuthInput(t *testing.T) {
@@ -99,6 +133,153 @@ func TestHandler_validateAuthInput(t *testing.T) {
 
 }
 
+func TestHandler_validateRegisterInput(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           model.AuthInput
+		wantErr        *apierror.APIError
+		wantErrMessage string
+	}{
+		{
+			name: "success",
+			args: model.AuthInput{
+				Username: "ivan.petrov-1_",
+				Password: "123456",
+			},
+		},
+		{
+			name: "empty password",
+			args: model.AuthInput{
+				Username: "Ivan",
+				Password: "",
+			},
+			wantErr:        &apierror.InvalidAuthInput,
+			wantErrMessage: "empty password",
+		},
+		{
+			name: "too short username",
+			args: model.AuthInput{
+				Username: "iv",
+				Password: "123456",
+			},
+			wantErr: &apierror.InvalidAuthInput,
+			wantErrMessage: "username must be 3-32 characters long and contain only latin letters, digits, " +
+				"'.', '-' and '_'",
+		},
+		{
+			name: "forbidden characters",
+			args: model.AuthInput{
+				Username: "ivan petrov",
+				Password: "123456",
+			},
+			wantErr: &apierror.InvalidAuthInput,
+			wantErrMessage: "username must be 3-32 characters long and contain only latin letters, digits, " +
+				"'.', '-' and '_'",
+		},
+		{
+			name: "starts with dot",
+			args: model.AuthInput{
+				Username: ".ivan",
+				Password: "123456",
+			},
+			wantErr: &apierror.InvalidAuthInput,
+			wantErrMessage: "username must be 3-32 characters long and contain only latin letters, digits, " +
+				"'.', '-' and '_'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRegisterInput(tt.args)
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, apiErr.Status, tt.wantErr.Status)
+				assert.Equal(t, apiErr.Error(), fmt.Sprintf("%s: %s", tt.wantErr.Message, tt.wantErrMessage))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler_Register(t *testing.T) {
+	type inputArgs struct {
+		registerOutputError      error
+		generateTokenOutputToken string
+		generateTokenOutputError error
+		body                     string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				generateTokenOutputToken: "test_token",
+				body:                     `{"username": "testuser", "password": "testpass"}`,
+			},
+		},
+		{
+			name: "invalid username",
+			args: inputArgs{
+				body: `{"username": "test user", "password": "testpass"}`,
+			},
+			wantErr: &apierror.InvalidAuthInput,
+		},
+		{
+			name: "user already exists",
+			args: inputArgs{
+				registerOutputError: apierror.NewAPIErrorWithMsg(apierror.UserAlreadyExistsError, "mock"),
+				body:                `{"username": "testuser", "password": "testpass"}`,
+			},
+			wantErr: &apierror.UserAlreadyExistsError,
+		},
+		{
+			name: "err in service.GenerateToken",
+			args: inputArgs{
+				generateTokenOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+				body:                     `{"username": "testuser", "password": "testpass"}`,
+			},
+			wantErr: &apierror.InternalError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+			authService.On("Register", mock.Anything).Return(tt.args.registerOutputError)
+			authService.On("GenerateTokens", mock.Anything).
+				Return(model.AuthOutput{Token: tt.args.generateTokenOutputToken}, tt.args.generateTokenOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/register", bytes.NewBufferString(tt.args.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			h.Register(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Contains(t, w.Body.String(), tt.args.generateTokenOutputToken)
+		})
+	}
+}
+
 func TestHandler_Auth(t *testing.T) {
 	type inputArgs struct {
 		authOutputError          error
@@ -167,10 +348,10 @@ func TestHandler_Auth(t *testing.T) {
 			log := slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
-			h := NewHandler(log, authService, nil)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
 			authService.On("Auth", mock.Anything).Return(tt.args.authOutputError)
-			authService.On("GenerateToken", mock.Anything).
-				Return(tt.args.generateTokenOutputToken, tt.args.generateTokenOutputError)
+			authService.On("GenerateTokens", mock.Anything).
+				Return(model.AuthOutput{Token: tt.args.generateTokenOutputToken}, tt.args.generateTokenOutputError)
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -230,9 +411,9 @@ func TestHandler_UserIdentify(t *testing.T) {
 			log := slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
-			h := NewHandler(log, authService, nil)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
 			authService.On("ParseToken", mock.Anything).
-				Return(tt.args.parseTokeOutputUsername, tt.args.parseTokenOutputError)
+				Return(model.TokenClaims{Username: tt.args.parseTokeOutputUsername}, tt.args.parseTokenOutputError)
 
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
@@ -249,11 +430,157 @@ func TestHandler_UserIdentify(t *testing.T) {
 			username, ok := c.Get("username")
 			assert.True(t, ok)
 			assert.Contains(t, username, tt.args.parseTokeOutputUsername)
+			claims, err := getClaims(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.args.parseTokeOutputUsername, claims.Username)
 		})
 	}
 
 }
 
+func TestHandler_RefreshToken(t *testing.T) {
+	type inputArgs struct {
+		refreshTokensOutputTokens model.AuthOutput
+		refreshTokensOutputError  error
+		body                      string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				refreshTokensOutputTokens: model.AuthOutput{Token: "access_token", RefreshToken: "refresh_token"},
+				body:                      `{"refreshToken": "old_refresh_token"}`,
+			},
+		},
+		{
+			name: "empty refresh token",
+			args: inputArgs{
+				body: `{"refreshToken": ""}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "reused refresh token",
+			args: inputArgs{
+				refreshTokensOutputError: apierror.NewAPIErrorWithMsg(apierror.RefreshTokenReusedError, "mock"),
+				body:                     `{"refreshToken": "old_refresh_token"}`,
+			},
+			wantErr: &apierror.RefreshTokenReusedError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+			authService.On("RefreshTokens", "old_refresh_token").
+				Return(tt.args.refreshTokensOutputTokens, tt.args.refreshTokensOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/token/refresh", bytes.NewBufferString(tt.args.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			h.RefreshToken(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), tt.args.refreshTokensOutputTokens.RefreshToken)
+		})
+	}
+}
+
+func TestHandler_Logout(t *testing.T) {
+	type inputArgs struct {
+		logoutOutputError error
+		claims            any
+		body              string
+	}
+
+	claims := model.TokenClaims{Username: "username", TokenID: "jti"}
+	tests := []struct {
+		name             string
+		args             inputArgs
+		wantRefreshToken string
+		wantErr          *apierror.APIError
+	}{
+		{
+			name: "success without refresh token",
+			args: inputArgs{
+				claims: claims,
+			},
+		},
+		{
+			name: "success with refresh token",
+			args: inputArgs{
+				claims: claims,
+				body:   `{"refreshToken": "refresh_token"}`,
+			},
+			wantRefreshToken: "refresh_token",
+		},
+		{
+			name: "no claims in context",
+			args: inputArgs{
+				claims: nil,
+			},
+			wantErr: &apierror.UnauthorizedError,
+		},
+		{
+			name: "err in service.Logout",
+			args: inputArgs{
+				logoutOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+				claims:            claims,
+			},
+			wantErr: &apierror.InternalError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+			authService.On("Logout", claims, tt.wantRefreshToken).Return(tt.args.logoutOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.args.claims != nil {
+				c.Set(claimsField, tt.args.claims)
+			}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/logout", bytes.NewBufferString(tt.args.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			h.Logout(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			authService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestHandler_getTokenFromHeader(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -371,3 +698,277 @@ func TestHandler_getUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_JWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	authService := new(MockAuthService)
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+	authService.On("JWKS").Return(model.JWKS{Keys: []model.JWK{{KeyType: "OKP", KeyID: "ed-1", Use: "sig",
+		Algorithm: "EdDSA", Curve: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}}})
+
+	w := httptest.NewRecorder()
+	h.InitRoutes().ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys":[{"kty":"OKP","kid":"ed-1","use":"sig","alg":"EdDSA","crv":"Ed25519",
+		"x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}]}`, w.Body.String())
+}
+
+func TestHandler_RequireRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  any
+		roles   []string
+		wantErr *apierror.APIError
+	}{
+		{
+			name:   "allowed",
+			claims: model.TokenClaims{Username: "username", Role: model.RoleAdmin},
+			roles:  []string{model.RoleAdmin},
+		},
+		{
+			name:   "one of allowed",
+			claims: model.TokenClaims{Username: "username", Role: model.RoleAuditor},
+			roles:  []string{model.RoleAdmin, model.RoleAuditor},
+		},
+		{
+			name:    "forbidden",
+			claims:  model.TokenClaims{Username: "username", Role: model.RoleUser},
+			roles:   []string{model.RoleAdmin},
+			wantErr: &apierror.ForbiddenError,
+		},
+		{
+			name:    "no claims",
+			roles:   []string{model.RoleAdmin},
+			wantErr: &apierror.UnauthorizedError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, nil, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.claims != nil {
+				c.Set(claimsField, tt.claims)
+			}
+			c.Request = httptest.NewRequest("GET", "/", nil)
+
+			h.RequireRole(tt.roles...)(c)
+
+			if tt.wantErr != nil {
+				assert.True(t, c.IsAborted())
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.False(t, c.IsAborted())
+		})
+	}
+}
+
+func TestHandler_AdminRoutes(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		method   string
+		path     string
+		wantCode int
+	}{
+		{
+			name:     "admin reads",
+			role:     model.RoleAdmin,
+			method:   http.MethodGet,
+			path:     "/api/admin/history/export",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "auditor reads",
+			role:     model.RoleAuditor,
+			method:   http.MethodGet,
+			path:     "/api/admin/history/export",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "user can't read",
+			role:     model.RoleUser,
+			method:   http.MethodGet,
+			path:     "/api/admin/history/export",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "auditor can't write",
+			role:     model.RoleAuditor,
+			method:   http.MethodPost,
+			path:     "/api/admin/grants",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, shopService, nil, nil, nil, nil, nil, nil)
+			authService.On("ParseToken", "token").Return(model.TokenClaims{Username: "username", Role: tt.role}, nil)
+			shopService.On("ExportHistory", mock.Anything).Return(nil, nil)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set(authHeader, "Bearer token")
+			h.InitRoutes().ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestHandler_SetUserRole(t *testing.T) {
+	type inputArgs struct {
+		setRoleOutputError error
+		body               string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				body: `{"role": "auditor"}`,
+			},
+		},
+		{
+			name: "unknown role",
+			args: inputArgs{
+				body: `{"role": "superuser"}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "unknown user",
+			args: inputArgs{
+				setRoleOutputError: apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, "mock"),
+				body:               `{"role": "auditor"}`,
+			},
+			wantErr: &apierror.NoSuchUserError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+			authService.On("SetRole", "user", model.RoleAuditor).Return(tt.args.setRoleOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "username", Value: "user"}}
+			c.Request = httptest.NewRequest("PUT", "localhost:8080/api/admin/users/user/role",
+				bytes.NewBufferString(tt.args.body))
+
+			h.SetUserRole(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestHandler_SetUserManager(t *testing.T) {
+	type inputArgs struct {
+		setManagerOutputError error
+		body                  string
+	}
+
+	tests := []struct {
+		name        string
+		args        inputArgs
+		wantManager string
+		wantErr     *apierror.APIError
+	}{
+		{
+			name:        "success",
+			args:        inputArgs{body: `{"manager": "boss"}`},
+			wantManager: "boss",
+		},
+		{
+			name: "remove manager",
+			args: inputArgs{body: `{"manager": ""}`},
+		},
+		{
+			name:    "own manager",
+			args:    inputArgs{body: `{"manager": "user"}`},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "invalid request body",
+			args:    inputArgs{body: "invalid json"},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "unknown manager",
+			args: inputArgs{
+				setManagerOutputError: apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, "mock"),
+				body:                  `{"manager": "boss"}`,
+			},
+			wantErr: &apierror.NoSuchUserError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authService := new(MockAuthService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, authService, nil, nil, nil, nil, nil, nil, nil)
+			authService.On("SetManager", "user", mock.Anything).Return(tt.args.setManagerOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "username", Value: "user"}}
+			c.Request = httptest.NewRequest("PUT", "localhost:8080/api/admin/users/user/manager",
+				bytes.NewBufferString(tt.args.body))
+
+			h.SetUserManager(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			authService.AssertCalled(t, "SetManager", "user", tt.wantManager)
+		})
+	}
+}
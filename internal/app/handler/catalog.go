@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	maxItemDescriptionLength = 500
+	defaultItemsLimit        = 20
+	maxItemsLimit            = 100
+)
+
+// item types are used as the path parameter of /api/buy/:item, so they are kept url friendly
+var itemTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+func validateItemPrice(price int) error {
+	if price <= 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "price must be positive")
+	}
+	return nil
+}
+
+func validateItemDescription(description string) error {
+	if utf8.RuneCountInString(description) > maxItemDescriptionLength {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("description must be at most %d characters long", maxItemDescriptionLength))
+	}
+	return nil
+}
+
+func validateItemStock(stock *int) error {
+	if stock != nil && *stock < 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "stock can't be negative")
+	}
+	return nil
+}
+
+func validateLowStockThreshold(threshold int) error {
+	if threshold < 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "low stock threshold can't be negative")
+	}
+	return nil
+}
+
+func validateCatalogItem(item model.CatalogItem) error {
+	if !itemTypePattern.MatchString(item.Type) {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			"type must be 1-64 characters long and contain only lowercase latin letters, digits and '-'")
+	}
+	if err := validateItemPrice(item.Price); err != nil {
+		return err
+	}
+	if err := validateItemStock(item.Stock); err != nil {
+		return err
+	}
+	if err := validateLowStockThreshold(item.LowStockThreshold); err != nil {
+		return err
+	}
+	return validateItemDescription(item.Description)
+}
+
+func validateCatalogItemUpdate(update model.CatalogItemUpdate) error {
+	if update.Price == nil && update.Description == nil && update.Active == nil && update.LowStockThreshold == nil {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "nothing to update")
+	}
+	if update.Price != nil {
+		if err := validateItemPrice(*update.Price); err != nil {
+			return err
+		}
+	}
+	if update.LowStockThreshold != nil {
+		if err := validateLowStockThreshold(*update.LowStockThreshold); err != nil {
+			return err
+		}
+	}
+	if update.Description != nil {
+		return validateItemDescription(*update.Description)
+	}
+	return nil
+}
+
+// queryInt reads a non-negative integer query parameter, def is returned when it's absent.
+func queryInt(ctx *gin.Context, name string, def int) (int, error) {
+	raw, ok := ctx.GetQuery(name)
+	if !ok || raw == "" {
+		return def, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, name+" must be a non-negative integer")
+	}
+
+	return value, nil
+}
+
+func getItemsFilter(ctx *gin.Context) (model.ItemsFilter, error) {
+	filter := model.ItemsFilter{
+		Search: ctx.Query("search"),
+		Sort:   ctx.DefaultQuery("sort", model.ItemsSortType),
+	}
+
+	var err error
+	if filter.Limit, err = queryInt(ctx, "limit", defaultItemsLimit); err != nil {
+		return model.ItemsFilter{}, err
+	}
+	if filter.Offset, err = queryInt(ctx, "offset", 0); err != nil {
+		return model.ItemsFilter{}, err
+	}
+	if filter.MinPrice, err = queryInt(ctx, "minPrice", 0); err != nil {
+		return model.ItemsFilter{}, err
+	}
+	if filter.MaxPrice, err = queryInt(ctx, "maxPrice", 0); err != nil {
+		return model.ItemsFilter{}, err
+	}
+
+	switch {
+	case filter.Limit == 0 || filter.Limit > maxItemsLimit:
+		return model.ItemsFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("limit must be between 1 and %d", maxItemsLimit))
+	case filter.MaxPrice > 0 && filter.MinPrice > filter.MaxPrice:
+		return model.ItemsFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "minPrice is greater than maxPrice")
+	}
+
+	switch filter.Sort {
+	case model.ItemsSortType, model.ItemsSortTypeDesc, model.ItemsSortPrice, model.ItemsSortPriceDesc:
+		return filter, nil
+	default:
+		return model.ItemsFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			"sort must be one of type, -type, price, -price")
+	}
+}
+
+func (h *Handler) GetItems(ctx *gin.Context) {
+	const op = "handler.catalog.GetItems"
+
+	filter, err := getItemsFilter(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	page, err := h.catalogService.GetItems(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting items", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) GetItem(ctx *gin.Context) {
+	const op = "handler.catalog.GetItem"
+
+	item, err := h.catalogService.GetItem(ctx.Param("type"))
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting item", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) ListCatalogItems(ctx *gin.Context) {
+	const op = "handler.catalog.ListCatalogItems"
+
+	items, err := h.catalogService.ListItems()
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting items", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, items)
+}
+
+func (h *Handler) GetCatalogItem(ctx *gin.Context) {
+	const op = "handler.catalog.GetCatalogItem"
+
+	item, err := h.catalogService.GetCatalogItem(ctx.Param("type"))
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting item", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) CreateCatalogItem(ctx *gin.Context) {
+	const op = "handler.catalog.CreateCatalogItem"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	// items are created on sale and with unlimited supply unless the body says otherwise
+	input := model.CatalogItem{Active: true}
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateCatalogItem(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	if err := h.catalogService.CreateItem(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while creating item", op))
+		return
+	}
+
+	h.logger.Info("item created",
+		slog.String("admin", admin), slog.String("item", input.Type), slog.Int("price", input.Price))
+
+	ctx.JSON(http.StatusCreated, input)
+}
+
+func (h *Handler) UpdateCatalogItem(ctx *gin.Context) {
+	const op = "handler.catalog.UpdateCatalogItem"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.CatalogItemUpdate
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateCatalogItemUpdate(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	itemType := ctx.Param("type")
+	item, err := h.catalogService.UpdateItem(itemType, input)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while updating item", op))
+		return
+	}
+
+	h.logger.Info("item updated",
+		slog.String("admin", admin), slog.String("item", item.Type),
+		slog.Int("price", item.Price), slog.Bool("active", item.Active))
+
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) ArchiveCatalogItem(ctx *gin.Context) {
+	const op = "handler.catalog.ArchiveCatalogItem"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	itemType := ctx.Param("type")
+	if err := h.catalogService.ArchiveItem(itemType); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while archiving item", op))
+		return
+	}
+
+	h.logger.Info("item archived", slog.String("admin", admin), slog.String("item", itemType))
+
+	ctx.Status(http.StatusOK)
+}
+
+func (h *Handler) RestockCatalogItem(ctx *gin.Context) {
+	const op = "handler.catalog.RestockCatalogItem"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.RestockInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if input.Quantity <= 0 {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": error while validating input: quantity must be positive"))
+		return
+	}
+
+	itemType := ctx.Param("type")
+	item, err := h.catalogService.RestockItem(itemType, input.Quantity)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while restocking item", op))
+		return
+	}
+
+	h.logger.Info("item restocked",
+		slog.String("admin", admin), slog.String("item", itemType), slog.Int("quantity", input.Quantity))
+
+	ctx.JSON(http.StatusOK, item)
+}
+
+func (h *Handler) SetCatalogItemStock(ctx *gin.Context) {
+	const op = "handler.catalog.SetCatalogItemStock"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.StockInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateItemStock(input.Stock); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	itemType := ctx.Param("type")
+	item, err := h.catalogService.SetStock(itemType, input.Stock)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while setting stock", op))
+		return
+	}
+
+	stock := "unlimited"
+	if input.Stock != nil {
+		stock = strconv.Itoa(*input.Stock)
+	}
+	h.logger.Info("item stock set", slog.String("admin", admin), slog.String("item", itemType), slog.String("stock", stock))
+
+	ctx.JSON(http.StatusOK, item)
+}
@@ -0,0 +1,668 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockCatalogService struct {
+	mock.Mock
+}
+
+func (m *MockCatalogService) ListItems() ([]model.CatalogItem, error) {
+	args := m.Called()
+	items, _ := args.Get(0).([]model.CatalogItem)
+	return items, args.Error(1)
+}
+
+func (m *MockCatalogService) GetItems(filter model.ItemsFilter) (model.ItemsPage, error) {
+	args := m.Called(filter)
+	page, _ := args.Get(0).(model.ItemsPage)
+	return page, args.Error(1)
+}
+
+func (m *MockCatalogService) GetItem(itemType string) (model.ShopItem, error) {
+	args := m.Called(itemType)
+	item, _ := args.Get(0).(model.ShopItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogService) GetCatalogItem(itemType string) (model.CatalogItem, error) {
+	args := m.Called(itemType)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogService) CreateItem(item model.CatalogItem) error {
+	args := m.Called(item)
+	return args.Error(0)
+}
+
+func (m *MockCatalogService) UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error) {
+	args := m.Called(itemType, update)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogService) ArchiveItem(itemType string) error {
+	args := m.Called(itemType)
+	return args.Error(0)
+}
+
+func (m *MockCatalogService) RestockItem(itemType string, quantity int) (model.CatalogItem, error) {
+	args := m.Called(itemType, quantity)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogService) SetStock(itemType string, stock *int) (model.CatalogItem, error) {
+	args := m.Called(itemType, stock)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func TestHandler_validateCatalogItem(t *testing.T) {
+	stock, negativeStock := 10, -1
+
+	tests := []struct {
+		name    string
+		item    model.CatalogItem
+		wantErr bool
+	}{
+		{
+			name: "success",
+			item: model.CatalogItem{Type: "pink-hoody", Price: 500, Description: "pink"},
+		},
+		{
+			name:    "empty type",
+			item:    model.CatalogItem{Price: 500},
+			wantErr: true,
+		},
+		{
+			name:    "uppercase type",
+			item:    model.CatalogItem{Type: "Hoody", Price: 500},
+			wantErr: true,
+		},
+		{
+			name:    "type with slash",
+			item:    model.CatalogItem{Type: "hoody/pink", Price: 500},
+			wantErr: true,
+		},
+		{
+			name:    "zero price",
+			item:    model.CatalogItem{Type: "hoody"},
+			wantErr: true,
+		},
+		{
+			name: "limited stock",
+			item: model.CatalogItem{Type: "hoody", Price: 500, Stock: &stock, LowStockThreshold: 3},
+		},
+		{
+			name:    "negative stock",
+			item:    model.CatalogItem{Type: "hoody", Price: 500, Stock: &negativeStock},
+			wantErr: true,
+		},
+		{
+			name:    "negative low stock threshold",
+			item:    model.CatalogItem{Type: "hoody", Price: 500, LowStockThreshold: -1},
+			wantErr: true,
+		},
+		{
+			name:    "too long description",
+			item:    model.CatalogItem{Type: "hoody", Price: 500, Description: strings.Repeat("я", maxItemDescriptionLength+1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCatalogItem(tt.item)
+			if tt.wantErr {
+				assert.True(t, apierror.Is(err, apierror.BadRequestError))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler_validateCatalogItemUpdate(t *testing.T) {
+	price, negativePrice, active := 100, -1, false
+
+	tests := []struct {
+		name    string
+		update  model.CatalogItemUpdate
+		wantErr bool
+	}{
+		{
+			name:   "price",
+			update: model.CatalogItemUpdate{Price: &price},
+		},
+		{
+			name:   "archive",
+			update: model.CatalogItemUpdate{Active: &active},
+		},
+		{
+			name:    "empty update",
+			wantErr: true,
+		},
+		{
+			name:    "negative price",
+			update:  model.CatalogItemUpdate{Price: &negativePrice},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCatalogItemUpdate(tt.update)
+			if tt.wantErr {
+				assert.True(t, apierror.Is(err, apierror.BadRequestError))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler_CreateCatalogItem(t *testing.T) {
+	type inputArgs struct {
+		createItemOutputError error
+		body                  string
+	}
+
+	tests := []struct {
+		name     string
+		args     inputArgs
+		wantItem model.CatalogItem
+		wantErr  *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				body: `{"type": "cap", "price": 40, "description": "baseball cap"}`,
+			},
+			wantItem: model.CatalogItem{Type: "cap", Price: 40, Description: "baseball cap", Active: true},
+		},
+		{
+			name: "archived from the start",
+			args: inputArgs{
+				body: `{"type": "cap", "price": 40, "active": false}`,
+			},
+			wantItem: model.CatalogItem{Type: "cap", Price: 40},
+		},
+		{
+			name: "invalid price",
+			args: inputArgs{
+				body: `{"type": "cap", "price": 0}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "invalid body",
+			args: inputArgs{
+				body: `{"type": "cap", "price": "40"}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "item exists",
+			args: inputArgs{
+				createItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemAlreadyExistsError, "mock"),
+				body:                  `{"type": "cup", "price": 20}`,
+			},
+			wantItem: model.CatalogItem{Type: "cup", Price: 20, Active: true},
+			wantErr:  &apierror.ItemAlreadyExistsError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("CreateItem", tt.wantItem).Return(tt.args.createItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/admin/items",
+				bytes.NewBufferString(tt.args.body))
+
+			h.CreateCatalogItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			catalogService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_UpdateCatalogItem(t *testing.T) {
+	price := 25
+
+	type inputArgs struct {
+		updateItemOutputError error
+		body                  string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				body: `{"price": 25}`,
+			},
+		},
+		{
+			name: "nothing to update",
+			args: inputArgs{
+				body: `{}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "unknown item",
+			args: inputArgs{
+				updateItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+				body:                  `{"price": 25}`,
+			},
+			wantErr: &apierror.ItemNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("UpdateItem", "cup", model.CatalogItemUpdate{Price: &price}).
+				Return(model.CatalogItem{Type: "cup", Price: price, Active: true}, tt.args.updateItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "type", Value: "cup"}}
+			c.Request = httptest.NewRequest("PATCH", "localhost:8080/api/admin/items/cup",
+				bytes.NewBufferString(tt.args.body))
+
+			h.UpdateCatalogItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"price":25`)
+		})
+	}
+}
+
+func TestHandler_ArchiveCatalogItem(t *testing.T) {
+	tests := []struct {
+		name                   string
+		archiveItemOutputError error
+		wantErr                *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                   "unknown item",
+			archiveItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:                &apierror.ItemNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("ArchiveItem", "cup").Return(tt.archiveItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "type", Value: "cup"}}
+			c.Request = httptest.NewRequest("DELETE", "localhost:8080/api/admin/items/cup", nil)
+
+			h.ArchiveCatalogItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestHandler_GetItems(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter model.ItemsFilter
+		wantErr    *apierror.APIError
+	}{
+		{
+			name:       "defaults",
+			query:      "",
+			wantFilter: model.ItemsFilter{Sort: model.ItemsSortType, Limit: defaultItemsLimit},
+		},
+		{
+			name:  "all parameters",
+			query: "?search=hoody&minPrice=100&maxPrice=400&sort=-price&limit=5&offset=10",
+			wantFilter: model.ItemsFilter{
+				Search:   "hoody",
+				MinPrice: 100,
+				MaxPrice: 400,
+				Sort:     model.ItemsSortPriceDesc,
+				Limit:    5,
+				Offset:   10,
+			},
+		},
+		{
+			name:    "unknown sort",
+			query:   "?sort=description",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "limit too big",
+			query:   "?limit=1000",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "negative offset",
+			query:   "?offset=-1",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "inverted price range",
+			query:   "?minPrice=300&maxPrice=100",
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("GetItems", tt.wantFilter).Return(model.ItemsPage{
+				Items: []model.ShopItem{{Type: "hoody", Price: 300, Available: true}},
+				Total: 1,
+				Limit: tt.wantFilter.Limit,
+			}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/items"+tt.query, nil)
+
+			h.GetItems(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"type":"hoody"`)
+			catalogService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_GetItem(t *testing.T) {
+	tests := []struct {
+		name               string
+		getItemOutputError error
+		wantErr            *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:               "unknown item",
+			getItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:            &apierror.ItemNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("GetItem", "cup").
+				Return(model.ShopItem{Type: "cup", Price: 20, Available: true}, tt.getItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = []gin.Param{{Key: "type", Value: "cup"}}
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/items/cup", nil)
+
+			h.GetItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"available":true`)
+		})
+	}
+}
+
+func TestHandler_GetCatalogItem(t *testing.T) {
+	tests := []struct {
+		name                      string
+		getCatalogItemOutputError error
+		wantErr                   *apierror.APIError
+	}{
+		{
+			name: "archived item",
+		},
+		{
+			name:                      "unknown item",
+			getCatalogItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:                   &apierror.ItemNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("GetCatalogItem", "cup").
+				Return(model.CatalogItem{Type: "cup", Price: 20, Active: false}, tt.getCatalogItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = []gin.Param{{Key: "type", Value: "cup"}}
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/admin/items/cup", nil)
+
+			h.GetCatalogItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"active":false`)
+		})
+	}
+}
+
+func TestHandler_RestockCatalogItem(t *testing.T) {
+	stock := 15
+
+	type inputArgs struct {
+		restockItemOutputError error
+		body                   string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				body: `{"quantity": 10}`,
+			},
+		},
+		{
+			name: "zero quantity",
+			args: inputArgs{
+				body: `{"quantity": 0}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "unknown item",
+			args: inputArgs{
+				restockItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+				body:                   `{"quantity": 10}`,
+			},
+			wantErr: &apierror.ItemNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("RestockItem", "hoody", 10).
+				Return(model.CatalogItem{Type: "hoody", Price: 300, Active: true, Stock: &stock}, tt.args.restockItemOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "type", Value: "hoody"}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/admin/items/hoody/restock",
+				bytes.NewBufferString(tt.args.body))
+
+			h.RestockCatalogItem(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"stock":15`)
+		})
+	}
+}
+
+func TestHandler_SetCatalogItemStock(t *testing.T) {
+	stock := 5
+
+	tests := []struct {
+		name      string
+		body      string
+		wantStock *int
+		wantErr   *apierror.APIError
+	}{
+		{
+			name:      "limited",
+			body:      `{"stock": 5}`,
+			wantStock: &stock,
+		},
+		{
+			name: "unlimited",
+			body: `{"stock": null}`,
+		},
+		{
+			name:    "negative",
+			body:    `{"stock": -5}`,
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalogService := new(MockCatalogService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, catalogService, nil, nil, nil, nil, nil)
+			catalogService.On("SetStock", "hoody", tt.wantStock).
+				Return(model.CatalogItem{Type: "hoody", Price: 300, Active: true, Stock: tt.wantStock}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "type", Value: "hoody"}}
+			c.Request = httptest.NewRequest("PUT", "localhost:8080/api/admin/items/hoody/stock",
+				bytes.NewBufferString(tt.body))
+
+			h.SetCatalogItemStock(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			catalogService.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func validateCoinRequestInput(input model.CoinRequestInput, username string) error {
+	switch {
+	case input.Amount <= 0:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "invalid amount of coin")
+	case input.FromUser == "":
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "empty payer")
+	case username == input.FromUser:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "can't request from yourself")
+	case utf8.RuneCountInString(input.Message) > maxTransferMessageLength:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("message must be at most %d characters long", maxTransferMessageLength))
+	}
+
+	return validateTransferCategory(input.Category)
+}
+
+func getCoinRequestID(ctx *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.CoinRequestNotFoundError, "invalid coin request id")
+	}
+	return id, nil
+}
+
+func (h *Handler) CreateCoinRequest(ctx *gin.Context) {
+	const op = "handler.coinrequest.CreateCoinRequest"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.CoinRequestInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	input.Message = sanitizeTransferMessage(input.Message)
+	if err := validateCoinRequestInput(input, username); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+	if input.Category == "" {
+		input.Category = model.TransferCategoryRepayment
+	}
+
+	request, err := h.coinRequestService.CreateCoinRequest(username, input)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while creating coin request", op))
+		return
+	}
+
+	h.logger.Info("coins requested",
+		slog.Int64("request", request.ID),
+		slog.String("requester", username),
+		slog.String("payer", input.FromUser),
+		slog.Int("amount", input.Amount))
+
+	ctx.JSON(http.StatusCreated, request)
+}
+
+func (h *Handler) GetIncomingCoinRequests(ctx *gin.Context) {
+	h.getCoinRequests(ctx, model.CoinRequestDirectionIncoming)
+}
+
+func (h *Handler) GetOutgoingCoinRequests(ctx *gin.Context) {
+	h.getCoinRequests(ctx, model.CoinRequestDirectionOutgoing)
+}
+
+func (h *Handler) getCoinRequests(ctx *gin.Context, direction string) {
+	const op = "handler.coinrequest.getCoinRequests"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	filter := model.CoinRequestsFilter{Username: username, Direction: direction, Status: ctx.Query("status")}
+	switch filter.Status {
+	case "", model.CoinRequestStatusPending, model.CoinRequestStatusAccepted, model.CoinRequestStatusDeclined:
+	default:
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": unknown coin request status"))
+		return
+	}
+
+	requests, err := h.coinRequestService.GetCoinRequests(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting coin requests", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, requests)
+}
+
+// AcceptCoinRequest pays the request, it responds 202 if the payment waits for an approval.
+func (h *Handler) AcceptCoinRequest(ctx *gin.Context) {
+	const op = "handler.coinrequest.AcceptCoinRequest"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getCoinRequestID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting coin request id", op))
+		return
+	}
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	request, err := h.coinRequestService.AcceptCoinRequest(username, id, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while accepting coin request", op))
+		return
+	}
+
+	h.logger.Info("coin request accepted",
+		slog.Int64("request", id), slog.String("payer", username), slog.Int("amount", request.Amount))
+
+	if request.ApprovalID != nil {
+		ctx.JSON(http.StatusAccepted, request)
+		return
+	}
+	ctx.JSON(http.StatusOK, request)
+}
+
+func (h *Handler) DeclineCoinRequest(ctx *gin.Context) {
+	const op = "handler.coinrequest.DeclineCoinRequest"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getCoinRequestID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting coin request id", op))
+		return
+	}
+
+	request, err := h.coinRequestService.DeclineCoinRequest(username, id)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while declining coin request", op))
+		return
+	}
+
+	h.logger.Info("coin request declined", slog.Int64("request", id), slog.String("payer", username))
+
+	ctx.JSON(http.StatusOK, request)
+}
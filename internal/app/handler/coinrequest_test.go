@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockCoinRequestService struct {
+	mock.Mock
+}
+
+func (m *MockCoinRequestService) CreateCoinRequest(requester string, input model.CoinRequestInput) (model.CoinRequest, error) {
+	args := m.Called(requester, input)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func (m *MockCoinRequestService) GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error) {
+	args := m.Called(filter)
+	requests, _ := args.Get(0).([]model.CoinRequest)
+	return requests, args.Error(1)
+}
+
+func (m *MockCoinRequestService) AcceptCoinRequest(payer string, id int64,
+	key *model.IdempotencyKey) (model.CoinRequest, error) {
+	args := m.Called(payer, id, key)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func (m *MockCoinRequestService) DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error) {
+	args := m.Called(payer, id)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func TestHandler_validateCoinRequestInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   model.CoinRequestInput
+		wantErr bool
+	}{
+		{
+			name:  "success",
+			input: model.CoinRequestInput{FromUser: "user2", Amount: 100, Category: model.TransferCategoryRepayment},
+		},
+		{
+			name:    "invalid amount",
+			input:   model.CoinRequestInput{FromUser: "user2", Amount: 0},
+			wantErr: true,
+		},
+		{
+			name:    "empty payer",
+			input:   model.CoinRequestInput{Amount: 100},
+			wantErr: true,
+		},
+		{
+			name:    "request from yourself",
+			input:   model.CoinRequestInput{FromUser: "user1", Amount: 100},
+			wantErr: true,
+		},
+		{
+			name:    "unknown category",
+			input:   model.CoinRequestInput{FromUser: "user2", Amount: 100, Category: "loan"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoinRequestInput(tt.input, "user1")
+			if tt.wantErr {
+				assert.True(t, apierror.Is(err, apierror.BadRequestError))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler_CreateCoinRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantInput model.CoinRequestInput
+		wantErr   *apierror.APIError
+	}{
+		{
+			name:      "default category",
+			body:      `{"fromUser": "user2", "amount": 100, "message": " for  lunch "}`,
+			wantInput: model.CoinRequestInput{FromUser: "user2", Amount: 100, Message: "for lunch", Category: "repayment"},
+		},
+		{
+			name:    "invalid request body",
+			body:    "invalid json",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "request from yourself",
+			body:    `{"fromUser": "user1", "amount": 100}`,
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coinRequestService := new(MockCoinRequestService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, coinRequestService, nil)
+			coinRequestService.On("CreateCoinRequest", "user1", mock.Anything).
+				Return(model.CoinRequest{ID: 1, Status: model.CoinRequestStatusPending}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "user1")
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/coinRequests", bytes.NewBufferString(tt.body))
+
+			h.CreateCoinRequest(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				coinRequestService.AssertNotCalled(t, "CreateCoinRequest", mock.Anything, mock.Anything)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			coinRequestService.AssertCalled(t, "CreateCoinRequest", "user1", tt.wantInput)
+		})
+	}
+}
+
+func TestHandler_getCoinRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		outgoing   bool
+		query      string
+		wantFilter model.CoinRequestsFilter
+		wantErr    *apierror.APIError
+	}{
+		{
+			name:       "incoming",
+			wantFilter: model.CoinRequestsFilter{Username: "user1", Direction: model.CoinRequestDirectionIncoming},
+		},
+		{
+			name:     "outgoing pending",
+			outgoing: true,
+			query:    "?status=pending",
+			wantFilter: model.CoinRequestsFilter{
+				Username: "user1", Direction: model.CoinRequestDirectionOutgoing, Status: model.CoinRequestStatusPending},
+		},
+		{
+			name:    "unknown status",
+			query:   "?status=paid",
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coinRequestService := new(MockCoinRequestService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, coinRequestService, nil)
+			coinRequestService.On("GetCoinRequests", mock.Anything).Return([]model.CoinRequest{{ID: 1}}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "user1")
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/coinRequests/incoming"+tt.query, nil)
+
+			if tt.outgoing {
+				h.GetOutgoingCoinRequests(c)
+			} else {
+				h.GetIncomingCoinRequests(c)
+			}
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			coinRequestService.AssertCalled(t, "GetCoinRequests", tt.wantFilter)
+		})
+	}
+}
+
+func TestHandler_AcceptCoinRequest(t *testing.T) {
+	approvalID := int64(7)
+
+	tests := []struct {
+		name                         string
+		id                           string
+		acceptCoinRequestOutput      model.CoinRequest
+		acceptCoinRequestOutputError error
+		wantCode                     int
+	}{
+		{
+			name:                    "paid",
+			id:                      "1",
+			acceptCoinRequestOutput: model.CoinRequest{ID: 1, Status: model.CoinRequestStatusAccepted},
+			wantCode:                http.StatusOK,
+		},
+		{
+			name: "waiting for approval",
+			id:   "1",
+			acceptCoinRequestOutput: model.CoinRequest{
+				ID: 1, Status: model.CoinRequestStatusAccepted, ApprovalID: &approvalID},
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "invalid id",
+			id:       "-1",
+			wantCode: apierror.CoinRequestNotFoundError.Status,
+		},
+		{
+			name:                         "not enough money",
+			id:                           "1",
+			acceptCoinRequestOutputError: apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, "mock"),
+			wantCode:                     apierror.NotEnoughMoneyError.Status,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coinRequestService := new(MockCoinRequestService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, coinRequestService, nil)
+			coinRequestService.On("AcceptCoinRequest", "user1", int64(1), mock.Anything).
+				Return(tt.acceptCoinRequestOutput, tt.acceptCoinRequestOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "user1")
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/coinRequests/"+tt.id+"/accept", nil)
+
+			h.AcceptCoinRequest(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	maxGrantLines        = 1000
+	maxGrantAmount       = 1000000
+	maxGrantReasonLength = 500
+	csvContentType       = "text/csv"
+)
+
+// parseGrantsCSV reads a "username,amount" CSV with a header row.
+func parseGrantsCSV(r io.Reader) ([]model.GrantLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, "invalid csv"))
+	}
+	if len(records) == 0 ||
+		!strings.EqualFold(strings.TrimSpace(records[0][0]), "username") ||
+		!strings.EqualFold(strings.TrimSpace(records[0][1]), "amount") {
+		return nil, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, `csv must start with the "username,amount" header`)
+	}
+
+	lines := make([]model.GrantLine, 0, len(records)-1)
+	for i, record := range records[1:] {
+		// the line is counted in the file, the header is line 1
+		line := i + 2
+		amount, err := strconv.Atoi(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+				fmt.Sprintf("line %d: amount must be an integer", line))
+		}
+		lines = append(lines, model.GrantLine{Line: line, Username: strings.TrimSpace(record[0]), Amount: amount})
+	}
+
+	return lines, nil
+}
+
+func validateGrantInput(input model.GrantInput) error {
+	switch {
+	case input.Reason == "":
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "empty reason")
+	case utf8.RuneCountInString(input.Reason) > maxGrantReasonLength:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "reason is too long")
+	case len(input.Grants) == 0 || len(input.Grants) > maxGrantLines:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("batch must contain between 1 and %d grants", maxGrantLines))
+	}
+
+	var lineErrors []model.GrantLineError
+	seen := make(map[string]struct{}, len(input.Grants))
+	for _, line := range input.Grants {
+		lineErr := ""
+		_, duplicate := seen[line.Username]
+		switch {
+		case line.Username == "":
+			lineErr = "empty username"
+		case duplicate:
+			lineErr = "user is already in the batch"
+		case line.Amount <= 0 || line.Amount > maxGrantAmount:
+			lineErr = fmt.Sprintf("amount must be between 1 and %d", maxGrantAmount)
+		}
+		seen[line.Username] = struct{}{}
+
+		if lineErr != "" {
+			lineErrors = append(lineErrors, model.GrantLineError{Line: line.Line, Username: line.Username, Error: lineErr})
+		}
+	}
+
+	if len(lineErrors) > 0 {
+		return apierror.NewAPIErrorWithDetails(apierror.BadRequestError, "some grants are invalid",
+			model.GrantErrorDetails{Lines: lineErrors})
+	}
+
+	return nil
+}
+
+// GrantCoins credits a batch of users from a JSON body or from a CSV body with the reason in the query.
+// With dryRun=true the batch is checked and reported, but nothing is credited.
+func (h *Handler) GrantCoins(ctx *gin.Context) {
+	const op = "handler.grant.GrantCoins"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	dryRun := false
+	if raw := ctx.Query("dryRun"); raw != "" {
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			apierror.LogAndRespondError(ctx, h.logger,
+				apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": dryRun must be a boolean"))
+			return
+		}
+	}
+
+	var input model.GrantInput
+	if ctx.ContentType() == csvContentType {
+		input.Reason = ctx.Query("reason")
+		if input.Grants, err = parseGrantsCSV(ctx.Request.Body); err != nil {
+			apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while parsing csv", op))
+			return
+		}
+	} else {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			apierror.LogAndRespondError(ctx, h.logger,
+				apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+			return
+		}
+		for i := range input.Grants {
+			input.Grants[i].Line = i
+		}
+	}
+
+	input.Reason = strings.TrimSpace(input.Reason)
+	if err := validateGrantInput(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusCreated
+	}
+
+	report, err := h.shopService.GrantCoins(admin, input, dryRun, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while granting coins", op))
+		return
+	}
+
+	h.logger.Info("coins granted",
+		slog.String("admin", admin), slog.Int64("grant", report.ID), slog.Bool("dryRun", dryRun),
+		slog.Int("recipients", report.Recipients), slog.Int("total", report.Total))
+
+	if dryRun {
+		ctx.JSON(http.StatusOK, report)
+		return
+	}
+	ctx.JSON(http.StatusCreated, report)
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func TestHandler_parseGrantsCSV(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		want       []model.GrantLine
+		wantErr    bool
+		wantErrMsg string
+	}{
+		{
+			name: "success",
+			csv:  "username,amount\r\nuser1,500\r\n\"user, 2\", 300\r\n",
+			want: []model.GrantLine{{Line: 2, Username: "user1", Amount: 500}, {Line: 3, Username: "user, 2", Amount: 300}},
+		},
+		{
+			name: "header only",
+			csv:  "Username,Amount\n",
+			want: []model.GrantLine{},
+		},
+		{
+			name:    "no header",
+			csv:     "user1,500\n",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			csv:     "",
+			wantErr: true,
+		},
+		{
+			name:    "wrong number of fields",
+			csv:     "username,amount\nuser1,500,bonus\n",
+			wantErr: true,
+		},
+		{
+			name:       "non-numeric amount",
+			csv:        "username,amount\nuser1,500\nuser2,five\n",
+			wantErr:    true,
+			wantErrMsg: "line 3: amount must be an integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := parseGrantsCSV(strings.NewReader(tt.csv))
+			if tt.wantErr {
+				assert.True(t, apierror.Is(err, apierror.BadRequestError))
+				if tt.wantErrMsg != "" {
+					assert.Contains(t, err.Error(), tt.wantErrMsg)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, lines)
+		})
+	}
+}
+
+func TestHandler_validateGrantInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     model.GrantInput
+		wantErr   bool
+		wantLines []model.GrantLineError
+	}{
+		{
+			name: "success",
+			input: model.GrantInput{
+				Reason: "Q3 bonus",
+				Grants: []model.GrantLine{{Username: "user1", Amount: 500}, {Username: "user2", Amount: 300}},
+			},
+		},
+		{
+			name: "empty reason",
+			input: model.GrantInput{
+				Grants: []model.GrantLine{{Username: "user1", Amount: 500}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "empty batch",
+			input:   model.GrantInput{Reason: "Q3 bonus"},
+			wantErr: true,
+		},
+		{
+			name: "invalid lines",
+			input: model.GrantInput{
+				Reason: "Q3 bonus",
+				Grants: []model.GrantLine{
+					{Line: 2, Username: "user1", Amount: 500},
+					{Line: 3, Username: "", Amount: 500},
+					{Line: 4, Username: "user1", Amount: 100},
+					{Line: 5, Username: "user2", Amount: 0},
+				},
+			},
+			wantErr: true,
+			wantLines: []model.GrantLineError{
+				{Line: 3, Username: "", Error: "empty username"},
+				{Line: 4, Username: "user1", Error: "user is already in the batch"},
+				{Line: 5, Username: "user2", Error: "amount must be between 1 and 1000000"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGrantInput(tt.input)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, apierror.Is(err, apierror.BadRequestError))
+			if tt.wantLines != nil {
+				assert.Equal(t, model.GrantErrorDetails{Lines: tt.wantLines}, apierror.GetAPIError(err).Details)
+			}
+		})
+	}
+}
+
+func TestHandler_GrantCoins(t *testing.T) {
+	jsonGrants := []model.GrantLine{{Line: 0, Username: "user1", Amount: 500}, {Line: 1, Username: "user2", Amount: 300}}
+	csvGrants := []model.GrantLine{{Line: 2, Username: "user1", Amount: 500}, {Line: 3, Username: "user2", Amount: 300}}
+
+	tests := []struct {
+		name        string
+		contentType string
+		query       string
+		body        string
+		wantInput   model.GrantInput
+		wantDryRun  bool
+		wantCode    int
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"reason":" Q3 bonus ","grants":[{"username":"user1","amount":500},{"username":"user2","amount":300}]}`,
+			wantInput:   model.GrantInput{Reason: "Q3 bonus", Grants: jsonGrants},
+			wantCode:    http.StatusCreated,
+		},
+		{
+			name:        "csv dry run",
+			contentType: "text/csv",
+			query:       "?reason=Q3%20bonus&dryRun=true",
+			body:        "username,amount\nuser1,500\nuser2,300\n",
+			wantInput:   model.GrantInput{Reason: "Q3 bonus", Grants: csvGrants},
+			wantDryRun:  true,
+			wantCode:    http.StatusOK,
+		},
+		{
+			name:        "invalid dry run",
+			contentType: "application/json",
+			query:       "?dryRun=maybe",
+			body:        `{"reason":"Q3 bonus","grants":[{"username":"user1","amount":500}]}`,
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "csv without reason",
+			contentType: "text/csv",
+			body:        "username,amount\nuser1,500\n",
+			wantCode:    http.StatusBadRequest,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("GrantCoins", "admin", mock.Anything, mock.Anything, mock.Anything).
+				Return(model.GrantReport{Reason: "Q3 bonus", DryRun: tt.wantDryRun, Recipients: 2, Total: 800}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/admin/grants"+tt.query,
+				bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+
+			h.GrantCoins(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode >= http.StatusBadRequest {
+				shopService.AssertNotCalled(t, "GrantCoins", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			shopService.AssertCalled(t, "GrantCoins", "admin", tt.wantInput, tt.wantDryRun, mock.Anything)
+
+			var report model.GrantReport
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, 800, report.Total)
+		})
+	}
+}
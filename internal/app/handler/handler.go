@@ -10,26 +10,103 @@ import (
 
 type AuthService interface {
 	Auth(input model.AuthInput) error
-	GenerateToken(username string) (string, error)
-	ParseToken(token string) (string, error)
+	Register(input model.AuthInput) error
+	GenerateTokens(username string) (model.AuthOutput, error)
+	ParseToken(token string) (model.TokenClaims, error)
+	RefreshTokens(refreshToken string) (model.AuthOutput, error)
+	Logout(claims model.TokenClaims, refreshToken string) error
+	JWKS() model.JWKS
+	SetRole(username, role string) error
+	SetManager(username, manager string) error
 }
 type ShopService interface {
-	GetInfo(username string) (model.InfoOutput, error)
-	SendCoin(username string, send model.Send) error
-	Buy(username, item string) error
+	GetInfo(username string, filter model.InfoFilter) (model.InfoOutput, error)
+	GetHistory(filter model.HistoryFilter) (model.HistoryPage, error)
+	ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error
+	SendCoin(username string, send model.Send, key *model.IdempotencyKey) (*model.TransferApproval, error)
+	Buy(username, item string, quantity int, key *model.IdempotencyKey) error
+	Checkout(username string, input model.OrderInput, key *model.IdempotencyKey) (model.Order, error)
+	GetPurchases(username string, filter model.PurchasesFilter) ([]model.Purchase, error)
+	GetIdempotencyKey(username, key string) (model.IdempotencyKey, error)
+	SaveIdempotencyKey(key model.IdempotencyKey) error
+	GrantCoins(admin string, input model.GrantInput, dryRun bool, key *model.IdempotencyKey) (model.GrantReport, error)
+}
+
+type WalletService interface {
+	CreateWallet(username string, input model.WalletInput) (model.Wallet, error)
+	GetWallets(username string) ([]model.Wallet, error)
+	GetWallet(username, name string) (model.WalletDetails, error)
+	GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error)
+	SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error)
+	RemoveWalletMember(actor, wallet, username string) error
+	Contribute(username, wallet string, amount int, key *model.IdempotencyKey) (model.WalletActivity, error)
+	WalletSendCoin(owner, wallet string, send model.Send, key *model.IdempotencyKey) (model.WalletActivity, error)
+	WalletBuy(owner, wallet, item string, quantity int, key *model.IdempotencyKey) (model.Order, error)
+}
+
+type ApprovalService interface {
+	GetApprovals(approver string, admin bool) ([]model.TransferApproval, error)
+	DecideApproval(decision model.ApprovalDecision, key *model.IdempotencyKey) (model.TransferApproval, error)
+}
+
+type CoinRequestService interface {
+	CreateCoinRequest(requester string, input model.CoinRequestInput) (model.CoinRequest, error)
+	GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error)
+	AcceptCoinRequest(payer string, id int64, key *model.IdempotencyKey) (model.CoinRequest, error)
+	DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error)
+}
+
+type ScheduleService interface {
+	CreateScheduledTransfer(username string, input model.ScheduledTransferInput) (model.ScheduledTransfer, error)
+	GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error)
+	CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error)
+}
+
+type CatalogService interface {
+	ListItems() ([]model.CatalogItem, error)
+	GetItems(filter model.ItemsFilter) (model.ItemsPage, error)
+	GetItem(itemType string) (model.ShopItem, error)
+	GetCatalogItem(itemType string) (model.CatalogItem, error)
+	CreateItem(item model.CatalogItem) error
+	UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error)
+	ArchiveItem(itemType string) error
+	RestockItem(itemType string, quantity int) (model.CatalogItem, error)
+	SetStock(itemType string, stock *int) (model.CatalogItem, error)
+}
+
+type OrderService interface {
+	GetOrders(filter model.OrdersFilter) ([]model.Order, error)
+	GetOrder(id int64) (model.Order, error)
+	GetUserOrder(username string, id int64) (model.Order, error)
+	UpdateOrderStatus(id int64, status string) (model.Order, error)
+	CancelUserOrder(username string, id int64, key *model.IdempotencyKey) (model.Refund, error)
+	RefundOrder(admin string, id int64, reason string, key *model.IdempotencyKey) (model.Refund, error)
 }
 
 type Handler struct {
-	logger      *slog.Logger
-	authService AuthService
-	shopService ShopService
+	logger             *slog.Logger
+	authService        AuthService
+	shopService        ShopService
+	catalogService     CatalogService
+	orderService       OrderService
+	walletService      WalletService
+	approvalService    ApprovalService
+	coinRequestService CoinRequestService
+	scheduleService    ScheduleService
 }
 
-func NewHandler(logger *slog.Logger, a AuthService, s ShopService) *Handler {
+func NewHandler(logger *slog.Logger, a AuthService, s ShopService, c CatalogService, o OrderService,
+	w WalletService, ap ApprovalService, cr CoinRequestService, sc ScheduleService) *Handler {
 	return &Handler{
-		logger:      logger,
-		authService: a,
-		shopService: s,
+		logger:             logger,
+		authService:        a,
+		shopService:        s,
+		catalogService:     c,
+		orderService:       o,
+		walletService:      w,
+		approvalService:    ap,
+		coinRequestService: cr,
+		scheduleService:    sc,
 	}
 }
 
@@ -37,12 +114,69 @@ func (h *Handler) InitRoutes() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.GET("/.well-known/jwks.json", h.JWKS)
 	apiRouter := router.Group("/api")
 	{
 		apiRouter.GET("/info", h.UserIdentify, h.GetInfo)
-		apiRouter.POST("/sendCoin", h.UserIdentify, h.SendCoin)
-		apiRouter.GET("/buy/:item", h.UserIdentify, h.Buy)
+		apiRouter.GET("/history", h.UserIdentify, h.GetHistory)
+		apiRouter.GET("/history/export", h.UserIdentify, h.ExportHistory)
+		apiRouter.POST("/sendCoin", h.UserIdentify, h.Idempotent, h.SendCoin)
+		apiRouter.GET("/buy/:item", h.UserIdentify, h.Idempotent, h.Buy)
+		apiRouter.POST("/orders", h.UserIdentify, h.Idempotent, h.Checkout)
+		apiRouter.GET("/purchases", h.UserIdentify, h.GetPurchases)
+		apiRouter.GET("/orders", h.UserIdentify, h.GetUserOrders)
+		apiRouter.GET("/orders/:id", h.UserIdentify, h.GetUserOrder)
+		apiRouter.POST("/orders/:id/cancel", h.UserIdentify, h.Idempotent, h.CancelUserOrder)
+		apiRouter.POST("/coinRequests", h.UserIdentify, h.Idempotent, h.CreateCoinRequest)
+		apiRouter.GET("/coinRequests/incoming", h.UserIdentify, h.GetIncomingCoinRequests)
+		apiRouter.GET("/coinRequests/outgoing", h.UserIdentify, h.GetOutgoingCoinRequests)
+		apiRouter.POST("/coinRequests/:id/accept", h.UserIdentify, h.Idempotent, h.AcceptCoinRequest)
+		apiRouter.POST("/coinRequests/:id/decline", h.UserIdentify, h.Idempotent, h.DeclineCoinRequest)
+		apiRouter.POST("/scheduledTransfers", h.UserIdentify, h.Idempotent, h.CreateScheduledTransfer)
+		apiRouter.GET("/scheduledTransfers", h.UserIdentify, h.GetScheduledTransfers)
+		apiRouter.POST("/scheduledTransfers/:id/cancel", h.UserIdentify, h.Idempotent, h.CancelScheduledTransfer)
+		apiRouter.POST("/wallets", h.UserIdentify, h.Idempotent, h.CreateWallet)
+		apiRouter.GET("/wallets", h.UserIdentify, h.GetWallets)
+		apiRouter.GET("/wallets/:name", h.UserIdentify, h.GetWallet)
+		apiRouter.GET("/wallets/:name/activity", h.UserIdentify, h.GetWalletActivity)
+		apiRouter.PUT("/wallets/:name/members/:username", h.UserIdentify, h.Idempotent, h.SetWalletMember)
+		apiRouter.DELETE("/wallets/:name/members/:username", h.UserIdentify, h.Idempotent, h.RemoveWalletMember)
+		apiRouter.POST("/wallets/:name/contribute", h.UserIdentify, h.Idempotent, h.Contribute)
+		apiRouter.POST("/wallets/:name/sendCoin", h.UserIdentify, h.Idempotent, h.WalletSendCoin)
+		apiRouter.GET("/wallets/:name/buy/:item", h.UserIdentify, h.Idempotent, h.WalletBuy)
+		apiRouter.GET("/approvals", h.UserIdentify, h.GetApprovals)
+		apiRouter.POST("/approvals/:id/approve", h.UserIdentify, h.Idempotent, h.ApproveTransfer)
+		apiRouter.POST("/approvals/:id/reject", h.UserIdentify, h.Idempotent, h.RejectTransfer)
+		apiRouter.GET("/items", h.GetItems)
+		apiRouter.GET("/items/:type", h.GetItem)
 		apiRouter.POST("/auth", h.Auth)
+		apiRouter.POST("/register", h.Register)
+		apiRouter.POST("/token/refresh", h.RefreshToken)
+		apiRouter.POST("/logout", h.UserIdentify, h.Logout)
+	}
+
+	// auditors see what admins see, but can't change anything
+	auditRouter := apiRouter.Group("/admin", h.UserIdentify, h.RequireRole(model.RoleAdmin, model.RoleAuditor))
+	{
+		auditRouter.GET("/items", h.ListCatalogItems)
+		auditRouter.GET("/items/:type", h.GetCatalogItem)
+		auditRouter.GET("/orders", h.GetOrders)
+		auditRouter.GET("/orders/:id", h.GetOrder)
+		auditRouter.GET("/history/export", h.ExportAllHistory)
+	}
+
+	adminRouter := apiRouter.Group("/admin", h.UserIdentify, h.RequireRole(model.RoleAdmin))
+	{
+		adminRouter.PUT("/users/:username/role", h.Idempotent, h.SetUserRole)
+		adminRouter.PUT("/users/:username/manager", h.Idempotent, h.SetUserManager)
+		adminRouter.POST("/items", h.Idempotent, h.CreateCatalogItem)
+		adminRouter.PATCH("/items/:type", h.Idempotent, h.UpdateCatalogItem)
+		adminRouter.DELETE("/items/:type", h.Idempotent, h.ArchiveCatalogItem)
+		adminRouter.POST("/items/:type/restock", h.Idempotent, h.RestockCatalogItem)
+		adminRouter.PUT("/items/:type/stock", h.Idempotent, h.SetCatalogItemStock)
+		adminRouter.PUT("/orders/:id/status", h.Idempotent, h.UpdateOrderStatus)
+		adminRouter.POST("/orders/:id/refund", h.Idempotent, h.RefundOrder)
+		adminRouter.POST("/grants", h.Idempotent, h.GrantCoins)
 	}
 
 	return router
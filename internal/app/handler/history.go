@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// queryTime reads an RFC 3339 time query parameter, nil is returned when it's absent.
+func queryTime(ctx *gin.Context, name string) (*time.Time, error) {
+	raw, ok := ctx.GetQuery(name)
+	if !ok || raw == "" {
+		return nil, nil
+	}
+
+	value, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, name+" must be an RFC 3339 time")
+	}
+
+	return &value, nil
+}
+
+func getHistoryFilter(ctx *gin.Context, username string) (model.HistoryFilter, error) {
+	filter := model.HistoryFilter{
+		Username:     username,
+		Direction:    ctx.Query("direction"),
+		Counterparty: ctx.Query("counterparty"),
+	}
+
+	var err error
+	if filter.Limit, err = queryInt(ctx, "limit", defaultHistoryLimit); err != nil {
+		return model.HistoryFilter{}, err
+	}
+	if filter.MinAmount, err = queryInt(ctx, "minAmount", 0); err != nil {
+		return model.HistoryFilter{}, err
+	}
+	if filter.MaxAmount, err = queryInt(ctx, "maxAmount", 0); err != nil {
+		return model.HistoryFilter{}, err
+	}
+	if filter.From, err = queryTime(ctx, "from"); err != nil {
+		return model.HistoryFilter{}, err
+	}
+	if filter.To, err = queryTime(ctx, "to"); err != nil {
+		return model.HistoryFilter{}, err
+	}
+	if token := ctx.Query("cursor"); token != "" {
+		cursor, err := model.ParseHistoryCursor(token)
+		if err != nil {
+			return model.HistoryFilter{}, apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, "invalid cursor"))
+		}
+		filter.After = &cursor
+	}
+
+	switch {
+	case filter.Limit == 0 || filter.Limit > maxHistoryLimit:
+		return model.HistoryFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit))
+	case filter.Direction != "" && filter.Direction != model.HistoryDirectionSent &&
+		filter.Direction != model.HistoryDirectionReceived:
+		return model.HistoryFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			"direction must be either sent or received")
+	case filter.MaxAmount > 0 && filter.MinAmount > filter.MaxAmount:
+		return model.HistoryFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "minAmount is greater than maxAmount")
+	case filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To):
+		return model.HistoryFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "from must be before to")
+	}
+
+	return filter, nil
+}
+
+// GetHistory returns a page of the user's transfers from the latest one, the nextCursor of
+// the page is passed as ?cursor= to get the next one.
+func (h *Handler) GetHistory(ctx *gin.Context) {
+	const op = "handler.history.GetHistory"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	filter, err := getHistoryFilter(ctx, username)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	page, err := h.shopService.GetHistory(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting history", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// ExportHistory streams the user's transfers as CSV or JSON Lines, ?from= and ?to= bound the period.
+// In CSV a sender, receiver or message that starts with =, +, -, @, a tab or a CR is prefixed with '
+// so a spreadsheet doesn't run it as a formula. JSON Lines has the values as they are.
+func (h *Handler) ExportHistory(ctx *gin.Context) {
+	const op = "handler.history.ExportHistory"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	h.exportHistory(ctx, op, username)
+}
+
+// ExportAllHistory streams the transfers of all users, ?username= narrows it down to one user.
+func (h *Handler) ExportAllHistory(ctx *gin.Context) {
+	const op = "handler.history.ExportAllHistory"
+
+	h.exportHistory(ctx, op, ctx.Query("username"))
+}
+
+func (h *Handler) exportHistory(ctx *gin.Context, op, username string) {
+	format := ctx.DefaultQuery("format", model.HistoryExportFormatCSV)
+	filter := model.HistoryExportFilter{Username: username}
+
+	var err error
+	if format != model.HistoryExportFormatCSV && format != model.HistoryExportFormatJSONL {
+		err = apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "format must be either csv or jsonl")
+	}
+	if err == nil {
+		filter.From, err = queryTime(ctx, "from")
+	}
+	if err == nil {
+		filter.To, err = queryTime(ctx, "to")
+	}
+	if err == nil && filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		err = apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "from must be before to")
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	contentType, filename := "text/csv; charset=utf-8", "history.csv"
+	if format == model.HistoryExportFormatJSONL {
+		contentType, filename = "application/x-ndjson", "history.jsonl"
+	}
+	ctx.Header("Content-Type", contentType)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	emit, flush := newTransferWriter(ctx.Writer, format)
+	err = h.shopService.ExportHistory(filter, emit)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		if !ctx.Writer.Written() {
+			// nothing is sent yet, so the client still gets an error response
+			ctx.Writer.Header().Del("Content-Type")
+			ctx.Writer.Header().Del("Content-Disposition")
+			apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while exporting history", op))
+			return
+		}
+		h.logger.Error("history export interrupted", slog.String("error", errors.Wrap(err, op).Error()))
+		ctx.Abort()
+		return
+	}
+
+	h.logger.Info("history exported", slog.String("username", username), slog.String("format", format))
+}
+
+// newTransferWriter returns emit, which writes an exported transfer, and flush, which writes out what is left.
+// The CSV export starts with the header, its rows end with CRLF and the fields are quoted as RFC 4180 says.
+func newTransferWriter(w io.Writer, format string) (func(model.TransferExport) error, func() error) {
+	if format == model.HistoryExportFormatJSONL {
+		encoder := json.NewEncoder(w)
+		emit := func(transfer model.TransferExport) error {
+			return encoder.Encode(transfer)
+		}
+		return emit, func() error { return nil }
+	}
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	header := false
+	writeHeader := func() error {
+		if header {
+			return nil
+		}
+		header = true
+		return writer.Write(model.TransferExportColumns)
+	}
+
+	emit := func(transfer model.TransferExport) error {
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		return writer.Write(transfer.Record())
+	}
+	flush := func() error {
+		if err := writeHeader(); err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return emit, flush
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func TestHandler_GetHistory(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	cursor := model.HistoryCursor{CreatedAt: time.Date(2025, 1, 15, 12, 30, 0, 123456000, time.UTC), ID: 42}
+
+	tests := []struct {
+		name               string
+		query              string
+		getHistoryOutError error
+		wantFilter         model.HistoryFilter
+		wantCode           int
+	}{
+		{
+			name:       "default filter",
+			query:      "",
+			wantFilter: model.HistoryFilter{Username: "username", Limit: defaultHistoryLimit},
+			wantCode:   http.StatusOK,
+		},
+		{
+			name: "all filters",
+			query: "?direction=sent&counterparty=user2&minAmount=10&maxAmount=100" +
+				"&from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00Z&limit=10&cursor=" + cursor.String(),
+			wantFilter: model.HistoryFilter{
+				Username:     "username",
+				Direction:    model.HistoryDirectionSent,
+				Counterparty: "user2",
+				MinAmount:    10,
+				MaxAmount:    100,
+				From:         &from,
+				To:           &to,
+				After:        &cursor,
+				Limit:        10,
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "unknown direction",
+			query:    "?direction=both",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "limit out of range",
+			query:    "?limit=201",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "minAmount greater than maxAmount",
+			query:    "?minAmount=100&maxAmount=10",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid time",
+			query:    "?from=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "from after to",
+			query:    "?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid cursor",
+			query:    "?cursor=not-a-cursor",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:               "error in service",
+			query:              "",
+			getHistoryOutError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantFilter:         model.HistoryFilter{Username: "username", Limit: defaultHistoryLimit},
+			wantCode:           http.StatusInternalServerError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("GetHistory", mock.Anything).Return(model.HistoryPage{}, tt.getHistoryOutError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/history"+tt.query, nil)
+
+			h.GetHistory(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusBadRequest {
+				shopService.AssertNotCalled(t, "GetHistory", mock.Anything)
+				return
+			}
+			shopService.AssertCalled(t, "GetHistory", tt.wantFilter)
+		})
+	}
+}
+
+func TestHandler_ExportHistory(t *testing.T) {
+	createdAt := time.Date(2025, 1, 15, 12, 30, 0, 0, time.UTC)
+	transfers := []model.TransferExport{
+		{ID: 1, CreatedAt: createdAt, Sender: "username", Receiver: "user2", Amount: 100, Category: "gift",
+			Message: `for "lunch", thanks` + "\n" + "see you"},
+		{ID: 2, CreatedAt: createdAt, Sender: "user2", Receiver: "username", Amount: 50, Category: "other",
+			Wallet: "backend-team"},
+		{ID: 3, CreatedAt: createdAt, Sender: "username", Receiver: "@user3", Amount: 10, Category: "other",
+			Message: `=HYPERLINK("http://evil")`, Wallet: "backend-team"},
+		{ID: 4, CreatedAt: createdAt, Sender: "-user4", Receiver: "username", Amount: 5, Category: "other",
+			Message: "\t=1+2"},
+	}
+
+	tests := []struct {
+		name                  string
+		query                 string
+		exportOutputTransfers []model.TransferExport
+		exportOutputError     error
+		wantCode              int
+		wantContentType       string
+		wantBody              string
+	}{
+		{
+			name:                  "csv",
+			query:                 "?format=csv&from=2025-01-01T00:00:00Z",
+			exportOutputTransfers: transfers,
+			wantCode:              http.StatusOK,
+			wantContentType:       "text/csv; charset=utf-8",
+			wantBody: "id,created_at,sender,receiver,amount,category,message,wallet\r\n" +
+				"1,2025-01-15T12:30:00Z,username,user2,100,gift,\"for \"\"lunch\"\", thanks\r\nsee you\",\r\n" +
+				"2,2025-01-15T12:30:00Z,user2,username,50,other,,backend-team\r\n" +
+				"3,2025-01-15T12:30:00Z,username,'@user3,10,other,\"'=HYPERLINK(\"\"http://evil\"\")\",backend-team\r\n" +
+				"4,2025-01-15T12:30:00Z,'-user4,username,5,other,'\t=1+2,\r\n",
+		},
+		{
+			name:            "empty csv has the header",
+			query:           "",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "id,created_at,sender,receiver,amount,category,message,wallet\r\n",
+		},
+		{
+			name:                  "json lines",
+			query:                 "?format=jsonl",
+			exportOutputTransfers: transfers[1:2],
+			wantCode:              http.StatusOK,
+			wantContentType:       "application/x-ndjson",
+			wantBody: `{"id":2,"created_at":"2025-01-15T12:30:00Z","sender":"user2","receiver":"username",` +
+				`"amount":50,"category":"other","message":"","wallet":"backend-team"}` + "\n",
+		},
+		{
+			name:     "unknown format",
+			query:    "?format=xlsx",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "from after to",
+			query:    "?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:              "error before the first row",
+			query:             "?format=csv",
+			exportOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantCode:          http.StatusInternalServerError,
+			wantContentType:   "application/json; charset=utf-8",
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("ExportHistory", mock.Anything).Return(tt.exportOutputTransfers, tt.exportOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/history/export"+tt.query, nil)
+
+			h.ExportHistory(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusBadRequest {
+				shopService.AssertNotCalled(t, "ExportHistory", mock.Anything)
+				return
+			}
+			assert.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			shopService.AssertCalled(t, "ExportHistory", mock.MatchedBy(func(filter model.HistoryExportFilter) bool {
+				return filter.Username == "username"
+			}))
+		})
+	}
+}
+
+func TestHandler_ExportAllHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	shopService := new(MockShopService)
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+	shopService.On("ExportHistory", mock.Anything).Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(usernameField, "admin")
+	c.Request = httptest.NewRequest("GET", "localhost:8080/api/admin/history/export?format=jsonl", nil)
+
+	h.ExportAllHistory(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String())
+	shopService.AssertCalled(t, "ExportHistory", model.HistoryExportFilter{})
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	idempotencyKeyCtx         = "idempotencyKey"
+	maxIdempotencyKeyLength   = 255
+	idempotentResponseContent = "application/json; charset=utf-8"
+)
+
+// responseRecorder keeps a copy of the response body, so it can be stored with the idempotency key.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+func hashRequest(ctx *gin.Context) (string, error) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(ctx.Request.Method + " " + ctx.Request.URL.RequestURI() + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getIdempotencyKey returns the key of the request, or nil if the request doesn't have one.
+func getIdempotencyKey(ctx *gin.Context) *model.IdempotencyKey {
+	key, ok := ctx.Get(idempotencyKeyCtx)
+	if !ok {
+		return nil
+	}
+
+	idempotencyKey, ok := key.(model.IdempotencyKey)
+	if !ok {
+		return nil
+	}
+
+	return &idempotencyKey
+}
+
+// Idempotent replays the stored response for a repeated Idempotency-Key and rejects a key
+// that was used for another request. Handlers that move coins save the key in their own
+// transaction; for the rest it's saved once the response is written. Server errors are
+// not stored, so such requests can be retried with the same key.
+func (h *Handler) Idempotent(ctx *gin.Context) {
+	const op = "handler.idempotency.Idempotent"
+
+	key := ctx.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		ctx.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		apierror.LogAndRespondError(ctx, h.logger, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			op+": idempotency key is too long"))
+		return
+	}
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	requestHash, err := hashRequest(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while reading request body")))
+		return
+	}
+
+	stored, err := h.shopService.GetIdempotencyKey(username, key)
+	switch {
+	case err == nil:
+		if stored.RequestHash != requestHash {
+			apierror.LogAndRespondError(ctx, h.logger, apierror.NewAPIErrorWithMsg(apierror.IdempotencyKeyReusedError,
+				op+": request doesn't match the stored one"))
+			return
+		}
+
+		h.logger.Info("replaying response",
+			slog.String("username", username), slog.String("key", key), slog.Int("status", stored.StatusCode))
+		ctx.Header(idempotentReplayedHeader, "true")
+		if len(stored.Response) == 0 {
+			ctx.AbortWithStatus(stored.StatusCode)
+			return
+		}
+		ctx.Data(stored.StatusCode, idempotentResponseContent, stored.Response)
+		ctx.Abort()
+		return
+	case !apierror.Is(err, apierror.IdempotencyKeyNotFoundError):
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting idempotency key", op))
+		return
+	}
+
+	idempotencyKey := model.IdempotencyKey{
+		Username:    username,
+		Key:         key,
+		RequestHash: requestHash,
+	}
+	ctx.Set(idempotencyKeyCtx, idempotencyKey)
+
+	recorder := &responseRecorder{ResponseWriter: ctx.Writer}
+	ctx.Writer = recorder
+
+	ctx.Next()
+
+	status := recorder.Status()
+	if status >= http.StatusInternalServerError {
+		return
+	}
+
+	idempotencyKey.StatusCode = status
+	idempotencyKey.Response = recorder.body.Bytes()
+	if err := h.shopService.SaveIdempotencyKey(idempotencyKey); err != nil {
+		h.logger.Error(errors.Wrapf(err, "%s: error while saving idempotency key", op).Error())
+	}
+}
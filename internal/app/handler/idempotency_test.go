@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func TestHandler_Idempotent(t *testing.T) {
+	const body = `{"toUser":"user2","amount":100}`
+
+	hashTestRequest := func(body string) string {
+		testContext, _ := gin.CreateTestContext(httptest.NewRecorder())
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/test", bytes.NewBufferString(body))
+		hash, err := hashRequest(testContext)
+		assert.NoError(t, err)
+		return hash
+	}
+
+	type inputArgs struct {
+		key            string
+		stored         model.IdempotencyKey
+		getErr         error
+		handlerStatus  int
+		handlerCalled  bool
+		wantSaved      bool
+		wantReplayed   bool
+		wantStatusCode int
+		wantBody       string
+	}
+	tests := []struct {
+		name string
+		args inputArgs
+	}{
+		{
+			name: "no key",
+			args: inputArgs{
+				handlerStatus:  http.StatusCreated,
+				handlerCalled:  true,
+				wantStatusCode: http.StatusCreated,
+				wantBody:       `{"id":1}`,
+			},
+		},
+		{
+			name: "new key",
+			args: inputArgs{
+				key:            "key",
+				getErr:         apierror.NewAPIErrorWithMsg(apierror.IdempotencyKeyNotFoundError, "mock"),
+				handlerStatus:  http.StatusCreated,
+				handlerCalled:  true,
+				wantSaved:      true,
+				wantStatusCode: http.StatusCreated,
+				wantBody:       `{"id":1}`,
+			},
+		},
+		{
+			name: "server error isn't stored",
+			args: inputArgs{
+				key:            "key",
+				getErr:         apierror.NewAPIErrorWithMsg(apierror.IdempotencyKeyNotFoundError, "mock"),
+				handlerStatus:  http.StatusInternalServerError,
+				handlerCalled:  true,
+				wantStatusCode: http.StatusInternalServerError,
+				wantBody:       `{"id":1}`,
+			},
+		},
+		{
+			name: "replay",
+			args: inputArgs{
+				key: "key",
+				stored: model.IdempotencyKey{
+					RequestHash: hashTestRequest(body),
+					StatusCode:  http.StatusCreated,
+					Response:    []byte(`{"id":1}`),
+				},
+				wantReplayed:   true,
+				wantStatusCode: http.StatusCreated,
+				wantBody:       `{"id":1}`,
+			},
+		},
+		{
+			name: "key reused for another request",
+			args: inputArgs{
+				key: "key",
+				stored: model.IdempotencyKey{
+					RequestHash: hashTestRequest(`{"toUser":"user2","amount":200}`),
+					StatusCode:  http.StatusCreated,
+				},
+				wantStatusCode: apierror.IdempotencyKeyReusedError.Status,
+			},
+		},
+		{
+			name: "too long key",
+			args: inputArgs{
+				key:            strings.Repeat("k", maxIdempotencyKeyLength+1),
+				wantStatusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "error in service",
+			args: inputArgs{
+				key:            "key",
+				getErr:         apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+				wantStatusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("GetIdempotencyKey", "username", tt.args.key).Return(tt.args.stored, tt.args.getErr)
+			shopService.On("SaveIdempotencyKey", mock.Anything).Return(nil)
+
+			handlerCalled := false
+			router := gin.New()
+			router.POST("/api/test", func(ctx *gin.Context) {
+				ctx.Set("username", "username")
+			}, h.Idempotent, func(ctx *gin.Context) {
+				handlerCalled = true
+				if tt.args.key != "" {
+					assert.Equal(t, tt.args.key, getIdempotencyKey(ctx).Key)
+				}
+				ctx.Data(tt.args.handlerStatus, "application/json", []byte(`{"id":1}`))
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/test", bytes.NewBufferString(body))
+			if tt.args.key != "" {
+				req.Header.Set(idempotencyKeyHeader, tt.args.key)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.args.handlerCalled, handlerCalled)
+			assert.Equal(t, tt.args.wantStatusCode, w.Code)
+			if tt.args.wantBody != "" {
+				assert.Equal(t, tt.args.wantBody, w.Body.String())
+			}
+			if tt.args.wantReplayed {
+				assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+			}
+			if tt.args.wantSaved {
+				shopService.AssertCalled(t, "SaveIdempotencyKey", mock.MatchedBy(func(key model.IdempotencyKey) bool {
+					return key.Username == "username" && key.Key == tt.args.key &&
+						key.RequestHash == hashTestRequest(body) &&
+						key.StatusCode == tt.args.handlerStatus && string(key.Response) == `{"id":1}`
+				}))
+			} else {
+				shopService.AssertNotCalled(t, "SaveIdempotencyKey", mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	defaultOrdersLimit    = 20
+	maxOrdersLimit        = 100
+	maxRefundReasonLength = 500
+)
+
+func validateOrderStatus(status string) error {
+	switch status {
+	case model.OrderStatusCreated, model.OrderStatusPaid, model.OrderStatusReadyForPickup,
+		model.OrderStatusDelivered, model.OrderStatusCancelled:
+		return nil
+	default:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "unknown order status")
+	}
+}
+
+func getOrderID(ctx *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.OrderNotFoundError, "invalid order id")
+	}
+	return id, nil
+}
+
+func getOrdersFilter(ctx *gin.Context) (model.OrdersFilter, error) {
+	filter := model.OrdersFilter{
+		Username: ctx.Query("username"),
+		Status:   ctx.Query("status"),
+	}
+
+	var err error
+	if filter.Limit, err = queryInt(ctx, "limit", defaultOrdersLimit); err != nil {
+		return model.OrdersFilter{}, err
+	}
+	if filter.Offset, err = queryInt(ctx, "offset", 0); err != nil {
+		return model.OrdersFilter{}, err
+	}
+	if filter.Limit == 0 || filter.Limit > maxOrdersLimit {
+		return model.OrdersFilter{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "limit is out of range")
+	}
+	if filter.Status != "" {
+		if err := validateOrderStatus(filter.Status); err != nil {
+			return model.OrdersFilter{}, err
+		}
+	}
+
+	return filter, nil
+}
+
+func (h *Handler) GetUserOrders(ctx *gin.Context) {
+	const op = "handler.order.GetUserOrders"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	filter, err := getOrdersFilter(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+	filter.Username = username
+
+	orders, err := h.orderService.GetOrders(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting orders", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+func (h *Handler) GetUserOrder(ctx *gin.Context) {
+	const op = "handler.order.GetUserOrder"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getOrderID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order id", op))
+		return
+	}
+
+	order, err := h.orderService.GetUserOrder(username, id)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) GetOrders(ctx *gin.Context) {
+	const op = "handler.order.GetOrders"
+
+	filter, err := getOrdersFilter(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	orders, err := h.orderService.GetOrders(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting orders", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orders)
+}
+
+func (h *Handler) GetOrder(ctx *gin.Context) {
+	const op = "handler.order.GetOrder"
+
+	id, err := getOrderID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order id", op))
+		return
+	}
+
+	order, err := h.orderService.GetOrder(id)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) UpdateOrderStatus(ctx *gin.Context) {
+	const op = "handler.order.UpdateOrderStatus"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getOrderID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order id", op))
+		return
+	}
+
+	var input model.OrderStatusInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateOrderStatus(input.Status); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	order, err := h.orderService.UpdateOrderStatus(id, input.Status)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while updating order status", op))
+		return
+	}
+
+	h.logger.Info("order status changed",
+		slog.String("admin", admin), slog.Int64("order", id), slog.String("status", order.Status))
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+func (h *Handler) CancelUserOrder(ctx *gin.Context) {
+	const op = "handler.order.CancelUserOrder"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getOrderID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order id", op))
+		return
+	}
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	refund, err := h.orderService.CancelUserOrder(username, id, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while cancelling order", op))
+		return
+	}
+
+	h.logger.Info("order cancelled",
+		slog.String("username", username), slog.Int64("order", id), slog.Int("amount", refund.Amount))
+
+	ctx.JSON(http.StatusOK, refund)
+}
+
+func (h *Handler) RefundOrder(ctx *gin.Context) {
+	const op = "handler.order.RefundOrder"
+
+	admin, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getOrderID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting order id", op))
+		return
+	}
+
+	// the reason is optional, so is the body
+	var input model.RefundInput
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			apierror.LogAndRespondError(ctx, h.logger,
+				apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+			return
+		}
+	}
+
+	if utf8.RuneCountInString(input.Reason) > maxRefundReasonLength {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": error while validating input: reason is too long"))
+		return
+	}
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	refund, err := h.orderService.RefundOrder(admin, id, input.Reason, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while refunding order", op))
+		return
+	}
+
+	h.logger.Info("order refunded",
+		slog.String("admin", admin), slog.Int64("order", id), slog.Int("amount", refund.Amount))
+
+	ctx.JSON(http.StatusOK, refund)
+}
@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockOrderService struct {
+	mock.Mock
+}
+
+func (m *MockOrderService) GetOrders(filter model.OrdersFilter) ([]model.Order, error) {
+	args := m.Called(filter)
+	orders, _ := args.Get(0).([]model.Order)
+	return orders, args.Error(1)
+}
+
+func (m *MockOrderService) GetOrder(id int64) (model.Order, error) {
+	args := m.Called(id)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderService) GetUserOrder(username string, id int64) (model.Order, error) {
+	args := m.Called(username, id)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderService) UpdateOrderStatus(id int64, status string) (model.Order, error) {
+	args := m.Called(id, status)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderService) CancelUserOrder(username string, id int64, key *model.IdempotencyKey) (model.Refund, error) {
+	args := m.Called(username, id, key)
+	refund, _ := args.Get(0).(model.Refund)
+	return refund, args.Error(1)
+}
+
+func (m *MockOrderService) RefundOrder(admin string, id int64, reason string,
+	key *model.IdempotencyKey) (model.Refund, error) {
+	args := m.Called(admin, id, reason, key)
+	refund, _ := args.Get(0).(model.Refund)
+	return refund, args.Error(1)
+}
+
+func TestHandler_GetUserOrders(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		wantFilter model.OrdersFilter
+		wantErr    *apierror.APIError
+	}{
+		{
+			name:       "defaults",
+			wantFilter: model.OrdersFilter{Username: "username", Limit: defaultOrdersLimit},
+		},
+		{
+			name:       "can't look at orders of another user",
+			query:      "?username=another&status=paid&limit=5",
+			wantFilter: model.OrdersFilter{Username: "username", Status: model.OrderStatusPaid, Limit: 5},
+		},
+		{
+			name:    "unknown status",
+			query:   "?status=lost",
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := new(MockOrderService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, orderService, nil, nil, nil, nil)
+			orderService.On("GetOrders", tt.wantFilter).Return([]model.Order{{ID: 1, Username: "username"}}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/orders"+tt.query, nil)
+
+			h.GetUserOrders(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			orderService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandler_GetUserOrder(t *testing.T) {
+	tests := []struct {
+		name                string
+		id                  string
+		getOrderOutputError error
+		wantErr             *apierror.APIError
+	}{
+		{
+			name: "success",
+			id:   "7",
+		},
+		{
+			name:    "invalid id",
+			id:      "seven",
+			wantErr: &apierror.OrderNotFoundError,
+		},
+		{
+			name:                "not found",
+			id:                  "7",
+			getOrderOutputError: apierror.NewAPIErrorWithMsg(apierror.OrderNotFoundError, "mock"),
+			wantErr:             &apierror.OrderNotFoundError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := new(MockOrderService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, orderService, nil, nil, nil, nil)
+			orderService.On("GetUserOrder", "username", int64(7)).
+				Return(model.Order{ID: 7, Username: "username", Status: model.OrderStatusPaid}, tt.getOrderOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/orders/"+tt.id, nil)
+
+			h.GetUserOrder(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"status":"paid"`)
+		})
+	}
+}
+
+func TestHandler_UpdateOrderStatus(t *testing.T) {
+	type inputArgs struct {
+		updateOrderStatusOutputError error
+		body                         string
+	}
+
+	tests := []struct {
+		name    string
+		args    inputArgs
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				body: `{"status": "ready_for_pickup"}`,
+			},
+		},
+		{
+			name: "unknown status",
+			args: inputArgs{
+				body: `{"status": "lost"}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "forbidden transition",
+			args: inputArgs{
+				updateOrderStatusOutputError: apierror.NewAPIErrorWithMsg(apierror.OrderStatusTransitionError, "mock"),
+				body:                         `{"status": "ready_for_pickup"}`,
+			},
+			wantErr: &apierror.OrderStatusTransitionError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := new(MockOrderService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, orderService, nil, nil, nil, nil)
+			orderService.On("UpdateOrderStatus", int64(3), model.OrderStatusReadyForPickup).
+				Return(model.Order{ID: 3, Status: model.OrderStatusReadyForPickup}, tt.args.updateOrderStatusOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "id", Value: "3"}}
+			c.Request = httptest.NewRequest("PUT", "localhost:8080/api/admin/orders/3/status",
+				bytes.NewBufferString(tt.args.body))
+
+			h.UpdateOrderStatus(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"status":"ready_for_pickup"`)
+		})
+	}
+}
+
+func TestHandler_CancelUserOrder(t *testing.T) {
+	tests := []struct {
+		name                   string
+		cancelOrderOutputError error
+		wantErr                *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                   "grace period is over",
+			cancelOrderOutputError: apierror.NewAPIErrorWithMsg(apierror.RefundPeriodExpiredError, "mock"),
+			wantErr:                &apierror.RefundPeriodExpiredError,
+		},
+		{
+			name:                   "delivered",
+			cancelOrderOutputError: apierror.NewAPIErrorWithMsg(apierror.OrderNotRefundableError, "mock"),
+			wantErr:                &apierror.OrderNotRefundableError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := new(MockOrderService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, orderService, nil, nil, nil, nil)
+			orderService.On("CancelUserOrder", "username", int64(3), mock.Anything).
+				Return(model.Refund{OrderID: 3, Amount: 40}, tt.cancelOrderOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "id", Value: "3"}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/orders/3/cancel", nil)
+
+			h.CancelUserOrder(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"amount":40`)
+		})
+	}
+}
+
+func TestHandler_RefundOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantReason string
+		wantErr    *apierror.APIError
+	}{
+		{
+			name:       "with reason",
+			body:       `{"reason": "broken zipper"}`,
+			wantReason: "broken zipper",
+		},
+		{
+			name: "without body",
+		},
+		{
+			name:    "invalid body",
+			body:    `{"reason": 1}`,
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderService := new(MockOrderService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, orderService, nil, nil, nil, nil)
+			orderService.On("RefundOrder", "admin", int64(3), tt.wantReason, mock.Anything).
+				Return(model.Refund{OrderID: 3, Amount: 40, Reason: tt.wantReason}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "admin")
+			c.Params = []gin.Param{{Key: "id", Value: "3"}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/admin/orders/3/refund",
+				bytes.NewBufferString(tt.body))
+
+			h.RefundOrder(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			orderService.AssertExpectations(t)
+		})
+	}
+}
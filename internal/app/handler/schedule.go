@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func getScheduledTransferID(ctx *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.ScheduledTransferNotFoundError, "invalid scheduled transfer id")
+	}
+	return id, nil
+}
+
+// CreateScheduledTransfer schedules a transfer with the same fields as sendCoin, once at runAt
+// or repeatedly by a five-field cron expression in UTC.
+func (h *Handler) CreateScheduledTransfer(ctx *gin.Context) {
+	const op = "handler.schedule.CreateScheduledTransfer"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.ScheduledTransferInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	input.Message = sanitizeTransferMessage(input.Message)
+	if err := validateSendCoinInput(model.Send{
+		ToUser:   input.ToUser,
+		Amount:   input.Amount,
+		Message:  input.Message,
+		Category: input.Category,
+	}, username); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+	if input.Category == "" {
+		input.Category = model.TransferCategoryOther
+	}
+
+	schedule, err := h.scheduleService.CreateScheduledTransfer(username, input)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while scheduling transfer", op))
+		return
+	}
+
+	h.logger.Info("transfer scheduled",
+		slog.Int64("schedule", schedule.ID),
+		slog.String("from", username),
+		slog.String("to", input.ToUser),
+		slog.Int("amount", input.Amount),
+		slog.String("cron", input.Cron))
+
+	ctx.JSON(http.StatusCreated, schedule)
+}
+
+func (h *Handler) GetScheduledTransfers(ctx *gin.Context) {
+	const op = "handler.schedule.GetScheduledTransfers"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	schedules, err := h.scheduleService.GetScheduledTransfers(username)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting scheduled transfers", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, schedules)
+}
+
+func (h *Handler) CancelScheduledTransfer(ctx *gin.Context) {
+	const op = "handler.schedule.CancelScheduledTransfer"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	id, err := getScheduledTransferID(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting scheduled transfer id", op))
+		return
+	}
+
+	schedule, err := h.scheduleService.CancelScheduledTransfer(username, id)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while cancelling scheduled transfer", op))
+		return
+	}
+
+	h.logger.Info("scheduled transfer cancelled", slog.Int64("schedule", id), slog.String("username", username))
+
+	ctx.JSON(http.StatusOK, schedule)
+}
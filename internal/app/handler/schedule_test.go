@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockScheduleService struct {
+	mock.Mock
+}
+
+func (m *MockScheduleService) CreateScheduledTransfer(username string,
+	input model.ScheduledTransferInput) (model.ScheduledTransfer, error) {
+	args := m.Called(username, input)
+	schedule, _ := args.Get(0).(model.ScheduledTransfer)
+	return schedule, args.Error(1)
+}
+
+func (m *MockScheduleService) GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error) {
+	args := m.Called(username)
+	schedules, _ := args.Get(0).([]model.ScheduledTransfer)
+	return schedules, args.Error(1)
+}
+
+func (m *MockScheduleService) CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error) {
+	args := m.Called(username, id)
+	schedule, _ := args.Get(0).(model.ScheduledTransfer)
+	return schedule, args.Error(1)
+}
+
+func TestHandler_CreateScheduledTransfer(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantInput model.ScheduledTransferInput
+		wantErr   *apierror.APIError
+	}{
+		{
+			name: "recurring",
+			body: `{"toUser": "coffee-fund", "amount": 10, "cron": "0 9 * * 1"}`,
+			wantInput: model.ScheduledTransferInput{
+				ToUser: "coffee-fund", Amount: 10, Category: model.TransferCategoryOther, Cron: "0 9 * * 1"},
+		},
+		{
+			name:    "invalid request body",
+			body:    "invalid json",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "send to yourself",
+			body:    `{"toUser": "username", "amount": 10, "cron": "0 9 * * 1"}`,
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "invalid amount",
+			body:    `{"toUser": "coffee-fund", "amount": -10, "cron": "0 9 * * 1"}`,
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduleService := new(MockScheduleService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, nil, scheduleService)
+			scheduleService.On("CreateScheduledTransfer", "username", mock.Anything).
+				Return(model.ScheduledTransfer{ID: 1, Status: model.ScheduleStatusActive}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/scheduledTransfers",
+				bytes.NewBufferString(tt.body))
+
+			h.CreateScheduledTransfer(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				scheduleService.AssertNotCalled(t, "CreateScheduledTransfer", mock.Anything, mock.Anything)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			scheduleService.AssertCalled(t, "CreateScheduledTransfer", "username", tt.wantInput)
+		})
+	}
+}
+
+func TestHandler_CancelScheduledTransfer(t *testing.T) {
+	tests := []struct {
+		name              string
+		id                string
+		cancelOutputError error
+		wantCode          int
+		wantCalled        bool
+	}{
+		{
+			name:       "success",
+			id:         "1",
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:     "invalid id",
+			id:       "abc",
+			wantCode: apierror.ScheduledTransferNotFoundError.Status,
+		},
+		{
+			name:              "already cancelled",
+			id:                "1",
+			cancelOutputError: apierror.NewAPIErrorWithMsg(apierror.ScheduledTransferNotActiveError, "mock"),
+			wantCode:          apierror.ScheduledTransferNotActiveError.Status,
+			wantCalled:        true,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduleService := new(MockScheduleService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, nil, nil, nil, scheduleService)
+			scheduleService.On("CancelScheduledTransfer", "username", int64(1)).
+				Return(model.ScheduledTransfer{ID: 1, Status: model.ScheduleStatusCancelled}, tt.cancelOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/scheduledTransfers/"+tt.id+"/cancel", nil)
+
+			h.CancelScheduledTransfer(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if !tt.wantCalled {
+				scheduleService.AssertNotCalled(t, "CancelScheduledTransfer", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
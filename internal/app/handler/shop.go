@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -11,6 +15,8 @@ import (
 	"github.com/nosikmy/avito-shop/internal/app/model"
 )
 
+// GetInfo returns the user's coins, inventory and history, ?historyLimit= keeps only that many
+// of the latest received and sent transfers and ?aggregate=counterparty sums them up per counterparty.
 func (h *Handler) GetInfo(ctx *gin.Context) {
 	const op = "handler.shop.GetInfo"
 
@@ -20,9 +26,19 @@ func (h *Handler) GetInfo(ctx *gin.Context) {
 		return
 	}
 
+	filter := model.InfoFilter{Aggregate: ctx.Query("aggregate")}
+	filter.HistoryLimit, err = queryInt(ctx, "historyLimit", 0)
+	if err == nil && filter.Aggregate != "" && filter.Aggregate != model.HistoryAggregateCounterparty {
+		err = apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "aggregate must be counterparty")
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
 	h.logger.Info("getting info", slog.String("username", username))
 
-	info, err := h.shopService.GetInfo(username)
+	info, err := h.shopService.GetInfo(username, filter)
 	if err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting info", op))
 		return
@@ -33,6 +49,25 @@ func (h *Handler) GetInfo(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, info)
 }
 
+const maxTransferMessageLength = 200
+
+// sanitizeTransferMessage drops control and invisible formatting characters, which could
+// break the rendering of the history, and collapses runs of whitespace into single spaces.
+func sanitizeTransferMessage(message string) string {
+	message = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		default:
+			return r
+		}
+	}, message)
+
+	return strings.Join(strings.Fields(message), " ")
+}
+
 func validateSendCoinInput(input model.Send, username string) error {
 	switch {
 	case input.Amount <= 0:
@@ -41,8 +76,22 @@ func validateSendCoinInput(input model.Send, username string) error {
 		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "empty receiver")
 	case username == input.ToUser:
 		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "can't send to yourself")
-	default:
+	case utf8.RuneCountInString(input.Message) > maxTransferMessageLength:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("message must be at most %d characters long", maxTransferMessageLength))
+	}
+
+	return validateTransferCategory(input.Category)
+}
+
+// validateTransferCategory accepts an empty category, the default one is set by the caller.
+func validateTransferCategory(category string) error {
+	switch category {
+	case "", model.TransferCategoryGratitude, model.TransferCategoryRepayment, model.TransferCategoryGift,
+		model.TransferCategoryReward, model.TransferCategoryOther:
 		return nil
+	default:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "unknown category")
 	}
 }
 
@@ -62,24 +111,79 @@ func (h *Handler) SendCoin(ctx *gin.Context) {
 		return
 	}
 
+	input.Message = sanitizeTransferMessage(input.Message)
 	if err := validateSendCoinInput(input, username); err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
 		return
 	}
+	if input.Category == "" {
+		input.Category = model.TransferCategoryOther
+	}
 
 	h.logger.Info("Sending coins",
 		slog.String("from", username),
 		slog.String("to", input.ToUser),
-		slog.Int("amount", input.Amount))
+		slog.Int("amount", input.Amount),
+		slog.String("category", input.Category))
 
-	if err = h.shopService.SendCoin(username, input); err != nil {
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	approval, err := h.shopService.SendCoin(username, input, key)
+	if err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting info", op))
 		return
 	}
 
+	if approval != nil {
+		ctx.JSON(http.StatusAccepted, approval)
+		return
+	}
 	ctx.Status(http.StatusOK)
 }
 
+const (
+	maxOrderLines         = 20
+	maxOrderQuantity      = 100
+	defaultPurchasesLimit = 50
+	maxPurchasesLimit     = 200
+)
+
+func validateQuantity(quantity int) error {
+	if quantity <= 0 || quantity > maxOrderQuantity {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("quantity must be between 1 and %d", maxOrderQuantity))
+	}
+	return nil
+}
+
+func validateOrderInput(input model.OrderInput) error {
+	if len(input.Items) == 0 || len(input.Items) > maxOrderLines {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			fmt.Sprintf("order must contain between 1 and %d lines", maxOrderLines))
+	}
+
+	seen := make(map[string]struct{}, len(input.Items))
+	for i, line := range input.Items {
+		if line.Type == "" {
+			return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, fmt.Sprintf("line %d: empty item", i))
+		}
+		if _, ok := seen[line.Type]; ok {
+			return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+				fmt.Sprintf("line %d: item %s is already in the order", i, line.Type))
+		}
+		seen[line.Type] = struct{}{}
+
+		if err := validateQuantity(line.Quantity); err != nil {
+			return errors.Wrapf(err, "line %d", i)
+		}
+	}
+
+	return nil
+}
+
 func (h *Handler) Buy(ctx *gin.Context) {
 	const op = "handler.shop.Buy"
 
@@ -95,13 +199,98 @@ func (h *Handler) Buy(ctx *gin.Context) {
 		return
 	}
 
-	h.logger.Info("buying item", slog.String("username", username), slog.String("item", item))
-	if err = h.shopService.Buy(username, item); err != nil {
+	quantity, err := queryInt(ctx, "quantity", 1)
+	if err == nil {
+		err = validateQuantity(quantity)
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating quantity", op))
+		return
+	}
+
+	h.logger.Info("buying item",
+		slog.String("username", username), slog.String("item", item), slog.Int("quantity", quantity))
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	if err = h.shopService.Buy(username, item, quantity, key); err != nil {
 		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while buying item", op))
 		return
 	}
 
-	h.logger.Info("item was bought", slog.String("username", username), slog.String("item", item))
+	h.logger.Info("item was bought",
+		slog.String("username", username), slog.String("item", item), slog.Int("quantity", quantity))
 
 	ctx.Status(http.StatusOK)
 }
+
+func (h *Handler) Checkout(ctx *gin.Context) {
+	const op = "handler.shop.Checkout"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.OrderInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateOrderInput(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	h.logger.Info("checking out order", slog.String("username", username), slog.Int("lines", len(input.Items)))
+
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusCreated
+	}
+
+	order, err := h.shopService.Checkout(username, input, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while checking out order", op))
+		return
+	}
+
+	h.logger.Info("order was bought", slog.String("username", username), slog.Int("total", order.Total))
+
+	ctx.JSON(http.StatusCreated, order)
+}
+
+func (h *Handler) GetPurchases(ctx *gin.Context) {
+	const op = "handler.shop.GetPurchases"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var filter model.PurchasesFilter
+	if filter.Limit, err = queryInt(ctx, "limit", defaultPurchasesLimit); err == nil {
+		filter.Offset, err = queryInt(ctx, "offset", 0)
+	}
+	if err == nil && (filter.Limit == 0 || filter.Limit > maxPurchasesLimit) {
+		err = apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "limit is out of range")
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	purchases, err := h.shopService.GetPurchases(username, filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting purchases", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, purchases)
+}
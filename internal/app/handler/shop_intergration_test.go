@@ -5,6 +5,8 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"io"
 	"log"
@@ -12,7 +14,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
@@ -55,11 +60,28 @@ func TestMain(m *testing.M) {
 }
 
 func initHandler() *Handler {
-	authService := service.NewAuthService(logger, repository.NewAuthRepository(logger, db))
+	passwordHasher, err := service.NewPasswordHasher(service.HashAlgorithmArgon2id)
+	if err != nil {
+		log.Fatalln("failed create password hasher: ", err)
+	}
+	keyring, err := service.LoadKeyring()
+	if err != nil {
+		log.Fatalln("failed load keyring: ", err)
+	}
+	authService := service.NewAuthService(logger, repository.NewAuthRepository(logger, db),
+		repository.NewTokenRepository(logger, db), passwordHasher, keyring)
+	approvalRepository := repository.NewApprovalRepository(logger, db)
 	shopService := service.NewShopService(logger, repository.NewInfoRepository(logger, db),
-		repository.NewHistoryRepository(logger, db), repository.NewShoppingRepository(logger, db))
+		repository.NewHistoryRepository(logger, db), repository.NewShoppingRepository(logger, db), approvalRepository)
+	catalogService := service.NewCatalogService(logger, repository.NewCatalogRepository(logger, db))
+	orderService := service.NewOrderService(logger, repository.NewOrderRepository(logger, db))
+	walletService := service.NewWalletService(logger, repository.NewWalletRepository(logger, db))
+	approvalService := service.NewApprovalService(logger, approvalRepository)
+	coinRequestService := service.NewCoinRequestService(logger, repository.NewCoinRequestRepository(logger, db))
+	scheduleService := service.NewScheduleService(logger, repository.NewScheduleRepository(logger, db), shopService)
 
-	return NewHandler(logger, authService, shopService)
+	return NewHandler(logger, authService, shopService, catalogService, orderService,
+		walletService, approvalService, coinRequestService, scheduleService)
 }
 
 func createUserDB(username, passwordHash string, balance int) error {
@@ -67,9 +89,27 @@ func createUserDB(username, passwordHash string, balance int) error {
 	if _, err := db.Exec(query, username, passwordHash, balance); err != nil {
 		return err
 	}
+
+	// the start balance is issued through the ledger, as the registration does
+	queryGrant := `WITH posting AS (SELECT nextval('ledger_postings_seq') AS id)
+		INSERT INTO ledger_entries (posting_id, account, amount, kind)
+		SELECT posting.id, entry.account, entry.amount, 'start_grant'
+		FROM posting, (VALUES ('issuance', -$2::INTEGER), ('user:' || $1, $2::INTEGER)) AS entry (account, amount)`
+	if _, err := db.Exec(queryGrant, username, balance); err != nil {
+		return err
+	}
 	return nil
 }
 
+func getLedgerBalance(account string) (int, error) {
+	query := "SELECT COALESCE(SUM(amount), 0) FROM ledger_entries WHERE account = $1"
+	var balance int
+	if err := db.Get(&balance, query, account); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
 func getUsersBalance(username string) (int, error) {
 	query := "SELECT balance FROM users WHERE username=$1"
 	var balance int
@@ -185,6 +225,39 @@ func TestIntegrationHandler_Buy(t *testing.T) {
 	}
 }
 
+func TestIntegrationHandler_BuyArchived(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "archive_user", "password", 1000
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO items (type, price, active) VALUES ('archived-cap', 10, false)"); err != nil {
+		t.Errorf("failed create item: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", username)
+	testContext.AddParam("item", "archived-cap")
+
+	h.Buy(testContext)
+
+	var resp apierror.APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Equal(t, apierror.ItemArchivedError.Message, resp.Message)
+	assert.Equal(t, apierror.ItemArchivedError.Status, w.Code)
+
+	userBalance, err := getUsersBalance(username)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance, userBalance)
+}
+
 func TestIntegrationHandler_SendCoin(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h := initHandler()
@@ -219,6 +292,18 @@ func TestIntegrationHandler_SendCoin(t *testing.T) {
 			contextSenderUser: "user2",
 			wantErr:           nil,
 		},
+		{
+			name:              "send coin with message test",
+			body:              `{"toUser":"user1","amount":10,"message":"for lunch","category":"repayment"}`,
+			contextSenderUser: "user2",
+			wantErr:           nil,
+		},
+		{
+			name:              "unknown category test",
+			body:              `{"toUser":"user2","amount":10,"category":"bribe"}`,
+			contextSenderUser: "user1",
+			wantErr:           &apierror.BadRequestError,
+		},
 		{
 			name:              "not enough balance test",
 			body:              `{"toUser":"user2","amount":50000}`,
@@ -299,3 +384,1024 @@ func TestIntegrationHandler_SendCoin(t *testing.T) {
 		})
 	}
 }
+
+func TestIntegrationHandler_Checkout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "cart_user", "password", 100
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     *apierror.APIError
+		wantBalance int
+	}{
+		{
+			name:        "unknown item rejects the whole order",
+			body:        `{"items":[{"type":"cup","quantity":2},{"type":"something","quantity":1}]}`,
+			wantErr:     &apierror.InvalidItemError,
+			wantBalance: 100,
+		},
+		{
+			name:        "not enough money rejects the whole order",
+			body:        `{"items":[{"type":"cup","quantity":2},{"type":"powerbank","quantity":1}]}`,
+			wantErr:     &apierror.NotEnoughMoneyError,
+			wantBalance: 100,
+		},
+		{
+			name:        "success",
+			body:        `{"items":[{"type":"cup","quantity":2},{"type":"pen","quantity":3}]}`,
+			wantBalance: 30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			testContext, _ := gin.CreateTestContext(w)
+			testContext.Set("username", username)
+			testContext.Request = &http.Request{
+				Body: io.NopCloser(bytes.NewBufferString(tt.body)),
+			}
+
+			h.Checkout(testContext)
+
+			if tt.wantErr != nil {
+				var resp apierror.APIError
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Errorf("failed unmarshal body: %s", err)
+				}
+
+				assert.Equal(t, tt.wantErr.Message, resp.Message)
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.NotNil(t, resp.Details)
+			} else {
+				assert.Equal(t, http.StatusCreated, w.Code)
+			}
+
+			userBalance, err := getUsersBalance(username)
+			if err != nil {
+				t.Errorf("failed get user's balance: %s", err)
+			}
+			assert.Equal(t, tt.wantBalance, userBalance)
+		})
+	}
+}
+
+func TestIntegrationHandler_BuyOutOfStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "stock_user", "password", 1000
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+	if _, err := db.Exec("INSERT INTO items (type, price, stock) VALUES ('limited-hoody', 100, 2)"); err != nil {
+		t.Errorf("failed create item: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		quantity  string
+		wantErr   *apierror.APIError
+		wantStock int
+	}{
+		{
+			name:      "more than in stock",
+			quantity:  "3",
+			wantErr:   &apierror.OutOfStockError,
+			wantStock: 2,
+		},
+		{
+			name:      "whole stock",
+			quantity:  "2",
+			wantStock: 0,
+		},
+		{
+			name:      "sold out",
+			quantity:  "1",
+			wantErr:   &apierror.OutOfStockError,
+			wantStock: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			testContext, _ := gin.CreateTestContext(w)
+			testContext.Set("username", username)
+			testContext.AddParam("item", "limited-hoody")
+			testContext.Request = httptest.NewRequest("GET", "/api/buy/limited-hoody?quantity="+tt.quantity, nil)
+
+			h.Buy(testContext)
+
+			if tt.wantErr != nil {
+				var resp apierror.APIError
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Errorf("failed unmarshal body: %s", err)
+				}
+
+				assert.Equal(t, tt.wantErr.Message, resp.Message)
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+
+			var stock int
+			if err := db.Get(&stock, "SELECT stock FROM items WHERE type = 'limited-hoody'"); err != nil {
+				t.Errorf("failed get stock: %s", err)
+			}
+			assert.Equal(t, tt.wantStock, stock)
+		})
+	}
+}
+
+func TestIntegrationHandler_OrderLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "order_user", "password", 1000
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", username)
+	testContext.Request = &http.Request{
+		Body: io.NopCloser(bytes.NewBufferString(`{"items":[{"type":"book","quantity":2}]}`)),
+	}
+	h.Checkout(testContext)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var order model.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Equal(t, model.OrderStatusPaid, order.Status)
+	assert.NotNil(t, order.PaidAt)
+
+	tests := []struct {
+		name    string
+		status  string
+		wantErr *apierror.APIError
+	}{
+		{
+			name:   "ready for pickup",
+			status: model.OrderStatusReadyForPickup,
+		},
+		{
+			name:    "back to paid",
+			status:  model.OrderStatusPaid,
+			wantErr: &apierror.OrderStatusTransitionError,
+		},
+		{
+			name:   "delivered",
+			status: model.OrderStatusDelivered,
+		},
+		{
+			name:    "delivered orders are final",
+			status:  model.OrderStatusCancelled,
+			wantErr: &apierror.OrderStatusTransitionError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			testContext, _ := gin.CreateTestContext(w)
+			testContext.Set("username", "admin")
+			testContext.AddParam("id", strconv.FormatInt(order.ID, 10))
+			testContext.Request = &http.Request{
+				Body: io.NopCloser(bytes.NewBufferString(`{"status":"` + tt.status + `"}`)),
+			}
+
+			h.UpdateOrderStatus(testContext)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+
+	var quantity int
+	if err := db.Get(&quantity, "SELECT quantity FROM purchases WHERE username = $1 AND item = 'book'", username); err != nil {
+		t.Errorf("failed get inventory: %s", err)
+	}
+	assert.Equal(t, 2, quantity)
+
+	// the price paid stays in the history even if the price changes later
+	if _, err := db.Exec("UPDATE items SET price = 55 WHERE type = 'book'"); err != nil {
+		t.Errorf("failed update price: %s", err)
+	}
+	defer db.Exec("UPDATE items SET price = 50 WHERE type = 'book'") //nolint:errcheck
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Set("username", username)
+	testContext.Request = httptest.NewRequest("GET", "/api/purchases", nil)
+	h.GetPurchases(testContext)
+
+	var purchases []model.Purchase
+	if err := json.Unmarshal(w.Body.Bytes(), &purchases); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	if assert.Len(t, purchases, 1) {
+		assert.Equal(t, 50, purchases[0].UnitPrice)
+		assert.Equal(t, 100, purchases[0].Amount)
+		assert.Equal(t, model.OrderStatusDelivered, purchases[0].Status)
+	}
+}
+
+func TestIntegrationHandler_CancelUserOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "refund_user", "password", 1000
+	os.Setenv(model.EnvRefundGracePeriod, "60")
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", username)
+	testContext.Request = &http.Request{
+		Body: io.NopCloser(bytes.NewBufferString(`{"items":[{"type":"umbrella","quantity":1}]}`)),
+	}
+	h.Checkout(testContext)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var order model.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+
+	for _, wantCode := range []int{http.StatusOK, apierror.OrderNotRefundableError.Status} {
+		w = httptest.NewRecorder()
+		testContext, _ = gin.CreateTestContext(w)
+		testContext.Set("username", username)
+		testContext.AddParam("id", strconv.FormatInt(order.ID, 10))
+		testContext.Request = httptest.NewRequest("POST", "/api/orders/cancel", nil)
+
+		h.CancelUserOrder(testContext)
+		assert.Equal(t, wantCode, w.Code)
+	}
+
+	userBalance, err := getUsersBalance(username)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance, userBalance)
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Set("username", username)
+	h.GetInfo(testContext)
+
+	var info model.InfoOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Empty(t, info.Inventory)
+	assert.Equal(t, []model.RefundHistory{{OrderID: order.ID, Amount: 200}}, info.CoinHistory.Refunds)
+}
+
+func TestIntegrationHandler_SendCoinIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		sender, receiver = "idempotent-sender", "idempotent-receiver"
+		password         = "password"
+		balance          = 1000
+	)
+	os.Setenv(model.EnvIdempotencyKeyTTL, "24")
+
+	if err := createUserDB(sender, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+	if err := createUserDB(receiver, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	router := gin.New()
+	router.POST("/api/sendCoin", func(ctx *gin.Context) {
+		ctx.Set("username", sender)
+	}, h.Idempotent, h.SendCoin)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantReplayed bool
+	}{
+		{
+			name:     "first request",
+			body:     `{"toUser":"idempotent-receiver","amount":100}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "retried request",
+			body:         `{"toUser":"idempotent-receiver","amount":100}`,
+			wantCode:     http.StatusOK,
+			wantReplayed: true,
+		},
+		{
+			name:     "key reused with another amount",
+			body:     `{"toUser":"idempotent-receiver","amount":200}`,
+			wantCode: apierror.IdempotencyKeyReusedError.Status,
+		},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewBufferString(tt.body))
+		req.Header.Set(idempotencyKeyHeader, "send-100")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.wantCode, w.Code, tt.name)
+		assert.Equal(t, tt.wantReplayed, w.Header().Get(idempotentReplayedHeader) == "true", tt.name)
+	}
+
+	senderBalance, err := getUsersBalance(sender)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance-100, senderBalance)
+
+	ledgerBalance, err := getLedgerBalance(model.UserAccount(sender))
+	if err != nil {
+		t.Errorf("failed get ledger balance: %s", err)
+	}
+	assert.Equal(t, senderBalance, ledgerBalance)
+}
+
+func TestIntegrationHandler_CheckoutIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	username, password, balance := "idempotent-buyer", "password", 100
+	os.Setenv(model.EnvIdempotencyKeyTTL, "24")
+
+	if err := createUserDB(username, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	router := gin.New()
+	router.POST("/api/orders", func(ctx *gin.Context) {
+		ctx.Set("username", username)
+	}, h.Idempotent, h.Checkout)
+
+	// both requests pass the lookup of the key, only one of them may claim it and charge the user
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/orders",
+				bytes.NewBufferString(`{"items":[{"type":"pen","quantity":1}]}`))
+			req.Header.Set(idempotencyKeyHeader, "checkout-pen")
+			router.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	assert.Contains(t, codes, http.StatusCreated)
+
+	userBalance, err := getUsersBalance(username)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance-10, userBalance)
+
+	ledgerBalance, err := getLedgerBalance(model.UserAccount(username))
+	if err != nil {
+		t.Errorf("failed get ledger balance: %s", err)
+	}
+	assert.Equal(t, userBalance, ledgerBalance)
+
+	// a retry after both are done gets the saved order back
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders",
+		bytes.NewBufferString(`{"items":[{"type":"pen","quantity":1}]}`))
+	req.Header.Set(idempotencyKeyHeader, "checkout-pen")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+}
+
+func TestIntegrationHandler_GrantCoins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		admin, recipient = "grant-admin", "grant-recipient"
+		password         = "password"
+		balance          = 1000
+	)
+
+	if err := createUserDB(admin, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+	if err := createUserDB(recipient, password, balance); err != nil {
+		t.Errorf("failed create user: %s", err)
+	}
+
+	body := "username,amount\ngrant-recipient,250\n"
+	for _, query := range []string{"?reason=hackathon&dryRun=true", "?reason=hackathon"} {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", admin)
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/admin/grants"+query, bytes.NewBufferString(body))
+		testContext.Request.Header.Set("Content-Type", "text/csv")
+		h.GrantCoins(testContext)
+
+		var report model.GrantReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Errorf("failed unmarshal body: %s", err)
+		}
+		assert.Equal(t, []model.GrantResult{{Username: recipient, Amount: 250, Balance: balance + 250}}, report.Grants)
+	}
+
+	recipientBalance, err := getUsersBalance(recipient)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance+250, recipientBalance)
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", recipient)
+	h.GetInfo(testContext)
+
+	var info model.InfoOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Len(t, info.CoinHistory.Grants, 1)
+	assert.Equal(t, "hackathon", info.CoinHistory.Grants[0].Reason)
+}
+
+func TestIntegrationHandler_TransferApproval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	t.Setenv(model.EnvApprovalThreshold, "500")
+	t.Setenv(model.EnvApprovalTTL, "72")
+
+	var (
+		sender, receiver, manager = "approval-sender", "approval-receiver", "approval-manager"
+		password                  = "password"
+		balance                   = 1000
+	)
+
+	for _, username := range []string{sender, receiver, manager} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+	if _, err := db.Exec("UPDATE users SET manager = $1 WHERE username = $2", manager, receiver); err != nil {
+		t.Errorf("failed set manager: %s", err)
+	}
+
+	sendCoin := func() model.TransferApproval {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", sender)
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/sendCoin",
+			bytes.NewBufferString(`{"toUser":"approval-receiver","amount":600}`))
+		h.SendCoin(testContext)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		var approval model.TransferApproval
+		if err := json.Unmarshal(w.Body.Bytes(), &approval); err != nil {
+			t.Errorf("failed unmarshal body: %s", err)
+		}
+		assert.Equal(t, model.ApprovalStatusPending, approval.Status)
+		return approval
+	}
+	decide := func(approver string, id int64, approve bool) int {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("claims", model.TokenClaims{Username: approver, Role: model.RoleUser})
+		testContext.Params = []gin.Param{{Key: "id", Value: strconv.FormatInt(id, 10)}}
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/approvals", nil)
+		if approve {
+			h.ApproveTransfer(testContext)
+		} else {
+			h.RejectTransfer(testContext)
+		}
+		return w.Code
+	}
+	assertBalances := func(wantSender, wantReceiver, wantEscrow int) {
+		senderBalance, err := getUsersBalance(sender)
+		if err != nil {
+			t.Errorf("failed get user's balance: %s", err)
+		}
+		receiverBalance, err := getUsersBalance(receiver)
+		if err != nil {
+			t.Errorf("failed get user's balance: %s", err)
+		}
+		escrowBalance, err := getLedgerBalance(model.LedgerAccountEscrow)
+		if err != nil {
+			t.Errorf("failed get ledger balance: %s", err)
+		}
+		assert.Equal(t, wantSender, senderBalance)
+		assert.Equal(t, wantReceiver, receiverBalance)
+		assert.Equal(t, wantEscrow, escrowBalance)
+	}
+
+	rejected := sendCoin()
+	assertBalances(balance-600, balance, 600)
+	assert.Equal(t, http.StatusOK, decide(manager, rejected.ID, false))
+	assertBalances(balance, balance, 0)
+
+	approved := sendCoin()
+	assert.Equal(t, apierror.ForbiddenError.Status, decide(receiver, approved.ID, true))
+	assert.Equal(t, http.StatusOK, decide(manager, approved.ID, true))
+	assert.Equal(t, apierror.ApprovalDecidedError.Status, decide(manager, approved.ID, true))
+	assertBalances(balance-600, balance+600, 0)
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", sender)
+	h.GetInfo(testContext)
+
+	var info model.InfoOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Len(t, info.CoinHistory.Approvals, 2)
+	assert.Len(t, info.CoinHistory.Sent, 1)
+}
+
+func TestIntegrationHandler_CoinRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		requester, payer = "coin-requester", "coin-payer"
+		password         = "password"
+		balance          = 1000
+	)
+
+	for _, username := range []string{requester, payer} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", requester)
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/coinRequests",
+		bytes.NewBufferString(`{"fromUser":"coin-payer","amount":150,"message":"lunch"}`))
+	h.CreateCoinRequest(testContext)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var request model.CoinRequest
+	if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+
+	accept := func(username string) int {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", username)
+		testContext.Params = []gin.Param{{Key: "id", Value: strconv.FormatInt(request.ID, 10)}}
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/coinRequests/accept", nil)
+		h.AcceptCoinRequest(testContext)
+		return w.Code
+	}
+
+	assert.Equal(t, apierror.CoinRequestNotFoundError.Status, accept(requester))
+	assert.Equal(t, http.StatusOK, accept(payer))
+	assert.Equal(t, apierror.CoinRequestDecidedError.Status, accept(payer))
+
+	requesterBalance, err := getUsersBalance(requester)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	payerBalance, err := getUsersBalance(payer)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance+150, requesterBalance)
+	assert.Equal(t, balance-150, payerBalance)
+}
+
+func TestIntegrationHandler_CoinRequestApproval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	t.Setenv(model.EnvApprovalThreshold, "500")
+	t.Setenv(model.EnvApprovalTTL, "72")
+
+	var (
+		requester, payer, manager = "approval-requester", "approval-payer", "approval-requester-manager"
+		password                  = "password"
+		balance                   = 1000
+	)
+
+	for _, username := range []string{requester, payer, manager} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+	if _, err := db.Exec("UPDATE users SET manager = $1 WHERE username = $2", manager, requester); err != nil {
+		t.Errorf("failed set manager: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", requester)
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/coinRequests",
+		bytes.NewBufferString(`{"fromUser":"approval-payer","amount":600}`))
+	h.CreateCoinRequest(testContext)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var request model.CoinRequest
+	if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Set("username", payer)
+	testContext.Params = []gin.Param{{Key: "id", Value: strconv.FormatInt(request.ID, 10)}}
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/coinRequests/accept", nil)
+	h.AcceptCoinRequest(testContext)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	if err := json.Unmarshal(w.Body.Bytes(), &request); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	if !assert.NotNil(t, request.ApprovalID) {
+		return
+	}
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Set("claims", model.TokenClaims{Username: manager, Role: model.RoleUser})
+	testContext.Params = []gin.Param{{Key: "id", Value: strconv.FormatInt(*request.ApprovalID, 10)}}
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/approvals", nil)
+	h.RejectTransfer(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var status string
+	if err := db.Get(&status, "SELECT status FROM coin_requests WHERE id = $1", request.ID); err != nil {
+		t.Errorf("failed get coin request: %s", err)
+	}
+	assert.Equal(t, model.CoinRequestStatusPending, status)
+
+	payerBalance, err := getUsersBalance(payer)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance, payerBalance)
+}
+
+func TestIntegrationHandler_ScheduledTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		sender, receiver = "schedule-sender", "schedule-receiver"
+		password         = "password"
+		balance          = 1000
+	)
+
+	for _, username := range []string{sender, receiver} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", sender)
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/scheduledTransfers",
+		bytes.NewBufferString(`{"toUser":"schedule-receiver","amount":10,"runAt":"`+
+			time.Now().Add(time.Hour).Format(time.RFC3339)+`"}`))
+	h.CreateScheduledTransfer(testContext)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var schedule model.ScheduledTransfer
+	if err := json.Unmarshal(w.Body.Bytes(), &schedule); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	if _, err := db.Exec("UPDATE scheduled_transfers SET next_run_at = now() - INTERVAL '1 minute' WHERE id = $1",
+		schedule.ID); err != nil {
+		t.Errorf("failed make schedule due: %s", err)
+	}
+
+	// two schedulers stand for two replicas, the transfer must be made once
+	shopService := service.NewShopService(logger, repository.NewInfoRepository(logger, db),
+		repository.NewHistoryRepository(logger, db), repository.NewShoppingRepository(logger, db),
+		repository.NewApprovalRepository(logger, db))
+	scheduleService := service.NewScheduleService(logger, repository.NewScheduleRepository(logger, db), shopService)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduleService.RunScheduledTransfers(ctx, 10*time.Millisecond)
+		}()
+	}
+	wg.Wait()
+
+	receiverBalance, err := getUsersBalance(receiver)
+	if err != nil {
+		t.Errorf("failed get user's balance: %s", err)
+	}
+	assert.Equal(t, balance+10, receiverBalance)
+
+	var runs int
+	if err := db.Get(&runs, "SELECT runs FROM scheduled_transfers WHERE id = $1", schedule.ID); err != nil {
+		t.Errorf("failed get schedule: %s", err)
+	}
+	assert.Equal(t, 1, runs)
+}
+
+func TestIntegrationHandler_Wallet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+	os.Setenv(model.EnvRefundGracePeriod, "60")
+
+	var (
+		owner, member, receiver = "wallet-owner", "wallet-member", "wallet-receiver"
+		wallet                  = "wallet-team"
+		password                = "password"
+		balance                 = 1000
+	)
+
+	for _, username := range []string{owner, member, receiver} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+
+	call := func(username string, handle gin.HandlerFunc, body string, params ...gin.Param) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", username)
+		testContext.Params = append(gin.Params{{Key: "name", Value: wallet}}, params...)
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/wallets", bytes.NewBufferString(body))
+		handle(testContext)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, call(owner, h.CreateWallet, `{"name":"wallet-team"}`).Code)
+	assert.Equal(t, apierror.WalletAlreadyExistsError.Status, call(member, h.CreateWallet, `{"name":"wallet-team"}`).Code)
+	assert.Equal(t, apierror.WalletNotFoundError.Status, call(member, h.Contribute, `{"amount":300}`).Code)
+
+	assert.Equal(t, http.StatusOK, call(owner, h.SetWalletMember, `{"role":"member"}`,
+		gin.Param{Key: "username", Value: member}).Code)
+	assert.Equal(t, http.StatusOK, call(member, h.Contribute, `{"amount":300}`).Code)
+
+	// members contribute, only owners spend
+	assert.Equal(t, http.StatusForbidden, call(member, h.WalletSendCoin, `{"toUser":"wallet-receiver","amount":100}`).Code)
+	assert.Equal(t, http.StatusOK, call(owner, h.WalletSendCoin, `{"toUser":"wallet-receiver","amount":100}`).Code)
+
+	w := call(owner, h.WalletBuy, "", gin.Param{Key: "item", Value: "umbrella"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var order model.Order
+	if err := json.Unmarshal(w.Body.Bytes(), &order); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+
+	w = httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", owner)
+	testContext.AddParam("id", strconv.FormatInt(order.ID, 10))
+	testContext.Request = httptest.NewRequest(http.MethodPost, "/api/orders/cancel", nil)
+	h.CancelUserOrder(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, apierror.WalletLastOwnerError.Status, call(owner, h.RemoveWalletMember, "",
+		gin.Param{Key: "username", Value: owner}).Code)
+
+	w = call(member, h.GetWallet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var details model.WalletDetails
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Equal(t, 200, details.Balance)
+	assert.Equal(t, model.WalletRoleMember, details.Role)
+	for i := range details.Members {
+		details.Members[i].AddedAt = time.Time{}
+	}
+	// the refunded umbrella isn't counted as spent
+	assert.Equal(t, []model.WalletMember{
+		{Username: member, Role: model.WalletRoleMember, Contributed: 300, AddedBy: owner},
+		{Username: owner, Role: model.WalletRoleOwner, Spent: 100, AddedBy: owner},
+	}, details.Members)
+
+	walletLedgerBalance, err := getLedgerBalance(model.WalletAccount(wallet))
+	if err != nil {
+		t.Errorf("failed get wallet's ledger balance: %s", err)
+	}
+	assert.Equal(t, 200, walletLedgerBalance)
+
+	for username, want := range map[string]int{owner: balance, member: balance - 300, receiver: balance + 100} {
+		userBalance, err := getUsersBalance(username)
+		if err != nil {
+			t.Errorf("failed get user's balance: %s", err)
+		}
+		assert.Equal(t, want, userBalance, username)
+	}
+}
+
+func TestIntegrationHandler_History(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		sender, receiver = "history-sender", "history-receiver"
+		password         = "password"
+		balance          = 1000
+	)
+
+	for _, username := range []string{sender, receiver} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+
+	send := func(from, body string) {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", from)
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewBufferString(body))
+		h.SendCoin(testContext)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	for amount := 1; amount <= 5; amount++ {
+		send(sender, `{"toUser":"history-receiver","amount":`+strconv.Itoa(amount)+`}`)
+	}
+	send(receiver, `{"toUser":"history-sender","amount":7}`)
+
+	getPage := func(query string) model.HistoryPage {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", sender)
+		testContext.Request = httptest.NewRequest(http.MethodGet, "/api/history"+query, nil)
+		h.GetHistory(testContext)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var page model.HistoryPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Errorf("failed unmarshal body: %s", err)
+		}
+		return page
+	}
+
+	// the pages go from the latest transfer and don't overlap
+	var amounts []int
+	page := getPage("?limit=4")
+	for {
+		for _, entry := range page.Entries {
+			assert.False(t, entry.CreatedAt.IsZero())
+			amounts = append(amounts, entry.Amount)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		page = getPage("?limit=4&cursor=" + page.NextCursor)
+	}
+	assert.Equal(t, []int{7, 5, 4, 3, 2, 1}, amounts)
+
+	page = getPage("?direction=sent&minAmount=2&maxAmount=4")
+	amounts = nil
+	for _, entry := range page.Entries {
+		assert.Equal(t, receiver, entry.Counterparty)
+		amounts = append(amounts, entry.Amount)
+	}
+	assert.Equal(t, []int{4, 3, 2}, amounts)
+	assert.Empty(t, page.NextCursor)
+
+	page = getPage("?direction=received")
+	if assert.Len(t, page.Entries, 1) {
+		assert.Equal(t, receiver, page.Entries[0].Counterparty)
+		assert.Equal(t, 7, page.Entries[0].Amount)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", sender)
+	testContext.Request = httptest.NewRequest(http.MethodGet, "/api/info?historyLimit=2", nil)
+	h.GetInfo(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var info model.InfoOutput
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	// the latest transfers are kept, still in the order they were made
+	if assert.Len(t, info.Sent, 2) {
+		assert.Equal(t, 4, info.Sent[0].Amount)
+		assert.Equal(t, 5, info.Sent[1].Amount)
+	}
+	assert.Len(t, info.Received, 1)
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Set("username", sender)
+	testContext.Request = httptest.NewRequest(http.MethodGet, "/api/info?aggregate=counterparty", nil)
+	h.GetInfo(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	info = model.InfoOutput{}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Errorf("failed unmarshal body: %s", err)
+	}
+	assert.Empty(t, info.Sent)
+	assert.Empty(t, info.Received)
+	if assert.Len(t, info.Counterparties, 2) {
+		for i := range info.Counterparties {
+			assert.False(t, info.Counterparties[i].LastAt.Before(info.Counterparties[i].FirstAt))
+			info.Counterparties[i].FirstAt, info.Counterparties[i].LastAt = time.Time{}, time.Time{}
+		}
+		assert.Equal(t, []model.CounterpartyHistory{
+			{Direction: model.HistoryDirectionReceived, Counterparty: receiver, Amount: 7, Count: 1},
+			{Direction: model.HistoryDirectionSent, Counterparty: receiver, Amount: 15, Count: 5},
+		}, info.Counterparties)
+	}
+}
+
+func TestIntegrationHandler_HistoryExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := initHandler()
+
+	var (
+		sender, receiver = "export-sender", "export-receiver"
+		password         = "password"
+		balance          = 1000
+	)
+
+	for _, username := range []string{sender, receiver} {
+		if err := createUserDB(username, password, balance); err != nil {
+			t.Errorf("failed create user: %s", err)
+		}
+	}
+
+	from := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	for _, body := range []string{
+		`{"toUser":"export-receiver","amount":10,"message":"for \"lunch\", thanks"}`,
+		`{"toUser":"export-receiver","amount":20}`,
+	} {
+		w := httptest.NewRecorder()
+		testContext, _ := gin.CreateTestContext(w)
+		testContext.Set("username", sender)
+		testContext.Request = httptest.NewRequest(http.MethodPost, "/api/sendCoin", bytes.NewBufferString(body))
+		h.SendCoin(testContext)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	testContext, _ := gin.CreateTestContext(w)
+	testContext.Set("username", receiver)
+	testContext.Request = httptest.NewRequest(http.MethodGet, "/api/history/export?format=csv&from="+from, nil)
+	h.ExportHistory(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Errorf("failed read csv: %s", err)
+	}
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, model.TransferExportColumns, records[0])
+		assert.Equal(t, []string{sender, receiver, "10", "other", `for "lunch", thanks`, ""}, records[1][2:])
+		assert.Equal(t, []string{sender, receiver, "20", "other", "", ""}, records[2][2:])
+	}
+
+	w = httptest.NewRecorder()
+	testContext, _ = gin.CreateTestContext(w)
+	testContext.Request = httptest.NewRequest(http.MethodGet,
+		"/api/admin/history/export?format=jsonl&username="+sender, nil)
+	h.ExportAllHistory(testContext)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var amounts []int
+	decoder := json.NewDecoder(w.Body)
+	for decoder.More() {
+		var transfer model.TransferExport
+		if err := decoder.Decode(&transfer); err != nil {
+			t.Errorf("failed decode transfer: %s", err)
+			break
+		}
+		amounts = append(amounts, transfer.Amount)
+	}
+	assert.Equal(t, []int{10, 20}, amounts)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -22,33 +23,86 @@ type MockShopService struct {
 	mock.Mock
 }
 
-func (m *MockShopService) GetInfo(username string) (model.InfoOutput, error) {
-	args := m.Called(username)
+func (m *MockShopService) GetInfo(username string, filter model.InfoFilter) (model.InfoOutput, error) {
+	args := m.Called(username, filter)
 	info, _ := args.Get(0).(model.InfoOutput)
 	return info, args.Error(1)
 }
 
-func (m *MockShopService) SendCoin(username string, send model.Send) error {
-	args := m.Called(username, send)
+func (m *MockShopService) GetHistory(filter model.HistoryFilter) (model.HistoryPage, error) {
+	args := m.Called(filter)
+	page, _ := args.Get(0).(model.HistoryPage)
+	return page, args.Error(1)
+}
+
+// ExportHistory emits the transfers given to Return before returning the error.
+func (m *MockShopService) ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error {
+	args := m.Called(filter)
+	transfers, _ := args.Get(0).([]model.TransferExport)
+	for _, transfer := range transfers {
+		if err := emit(transfer); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockShopService) SendCoin(username string, send model.Send,
+	key *model.IdempotencyKey) (*model.TransferApproval, error) {
+	args := m.Called(username, send, key)
+	approval, _ := args.Get(0).(*model.TransferApproval)
+	return approval, args.Error(1)
+}
+
+func (m *MockShopService) Buy(username, item string, quantity int, key *model.IdempotencyKey) error {
+	args := m.Called(username, item, quantity, key)
 	return args.Error(0)
 }
 
-func (m *MockShopService) Buy(username, item string) error {
-	args := m.Called(username, item)
+func (m *MockShopService) Checkout(username string, input model.OrderInput,
+	key *model.IdempotencyKey) (model.Order, error) {
+	args := m.Called(username, input, key)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockShopService) GrantCoins(admin string, input model.GrantInput, dryRun bool,
+	key *model.IdempotencyKey) (model.GrantReport, error) {
+	args := m.Called(admin, input, dryRun, key)
+	report, _ := args.Get(0).(model.GrantReport)
+	return report, args.Error(1)
+}
+
+func (m *MockShopService) GetIdempotencyKey(username, key string) (model.IdempotencyKey, error) {
+	args := m.Called(username, key)
+	idempotencyKey, _ := args.Get(0).(model.IdempotencyKey)
+	return idempotencyKey, args.Error(1)
+}
+
+func (m *MockShopService) SaveIdempotencyKey(key model.IdempotencyKey) error {
+	args := m.Called(key)
 	return args.Error(0)
 }
 
+func (m *MockShopService) GetPurchases(username string, filter model.PurchasesFilter) ([]model.Purchase, error) {
+	args := m.Called(username, filter)
+	purchases, _ := args.Get(0).([]model.Purchase)
+	return purchases, args.Error(1)
+}
+
 func TestHandler_GetInfo(t *testing.T) {
 	type inputArgs struct {
 		getInfoOutputInfo  model.InfoOutput
 		getInfoOutputError error
 		username           any
+		query              string
 	}
 
 	tests := []struct {
-		name    string
-		args    inputArgs
-		wantErr *apierror.APIError
+		name       string
+		args       inputArgs
+		wantFilter model.InfoFilter
+		wantErr    *apierror.APIError
 	}{
 		{
 			name: "success",
@@ -65,6 +119,30 @@ func TestHandler_GetInfo(t *testing.T) {
 				username:           "username",
 			},
 		},
+		{
+			name: "aggregated per counterparty",
+			args: inputArgs{
+				username: "username",
+				query:    "?aggregate=counterparty",
+			},
+			wantFilter: model.InfoFilter{Aggregate: model.HistoryAggregateCounterparty},
+		},
+		{
+			name: "history limit",
+			args: inputArgs{
+				username: "username",
+				query:    "?historyLimit=5",
+			},
+			wantFilter: model.InfoFilter{HistoryLimit: 5},
+		},
+		{
+			name: "unknown aggregate",
+			args: inputArgs{
+				username: "username",
+				query:    "?aggregate=day",
+			},
+			wantErr: &apierror.BadRequestError,
+		},
 		{
 			name: "err in service.GetInfo",
 			args: inputArgs{
@@ -84,12 +162,12 @@ func TestHandler_GetInfo(t *testing.T) {
 			log := slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
-			h := NewHandler(log, nil, shopService)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
 			shopService.On("GetInfo", mock.Anything, mock.Anything).Return(tt.args.getInfoOutputInfo, tt.args.getInfoOutputError)
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Set(usernameField, tt.args.username)
-			c.Request = httptest.NewRequest("POST", "localhost:8080/api/info", bytes.NewBufferString(""))
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/info"+tt.args.query, bytes.NewBufferString(""))
 			h.GetInfo(c)
 
 			if tt.wantErr != nil {
@@ -99,21 +177,24 @@ func TestHandler_GetInfo(t *testing.T) {
 			}
 
 			assert.Equal(t, http.StatusOK, w.Code)
+			shopService.AssertCalled(t, "GetInfo", "username", tt.wantFilter)
 		})
 	}
 }
 
 func TestHandler_SendCoin(t *testing.T) {
 	type inputArgs struct {
-		sendCoinOutputError error
-		username            any
-		body                string
+		sendCoinOutputApproval *model.TransferApproval
+		sendCoinOutputError    error
+		username               any
+		body                   string
 	}
 
 	tests := []struct {
-		name    string
-		args    inputArgs
-		wantErr *apierror.APIError
+		name     string
+		args     inputArgs
+		wantErr  *apierror.APIError
+		wantCode int
 	}{
 		{
 			name: "success",
@@ -122,6 +203,17 @@ func TestHandler_SendCoin(t *testing.T) {
 				username:            "username",
 				body:                `{"toUser": "to_test_user", "amount": 15}`,
 			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "waiting for approval",
+			args: inputArgs{
+				sendCoinOutputApproval: &model.TransferApproval{
+					ID: 1, ToUser: "to_test_user", Amount: 1500, Status: model.ApprovalStatusPending},
+				username: "username",
+				body:     `{"toUser": "to_test_user", "amount": 1500}`,
+			},
+			wantCode: http.StatusAccepted,
 		},
 		{
 			name: "invalid request body",
@@ -151,8 +243,9 @@ func TestHandler_SendCoin(t *testing.T) {
 			log := slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
-			h := NewHandler(log, nil, shopService)
-			shopService.On("SendCoin", mock.Anything, mock.Anything).Return(tt.args.sendCoinOutputError)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("SendCoin", mock.Anything, mock.Anything, mock.Anything).
+				Return(tt.args.sendCoinOutputApproval, tt.args.sendCoinOutputError)
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Set(usernameField, tt.args.username)
@@ -166,7 +259,10 @@ func TestHandler_SendCoin(t *testing.T) {
 				return
 			}
 
-			assert.Equal(t, w.Code, http.StatusOK)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.args.sendCoinOutputApproval != nil {
+				assert.Contains(t, w.Body.String(), `"status":"pending"`)
+			}
 		})
 	}
 
@@ -177,6 +273,7 @@ func TestHandler_Buy(t *testing.T) {
 		buyOutputError error
 		username       any
 		param          string
+		query          string
 	}
 	tests := []struct {
 		name    string
@@ -200,6 +297,32 @@ func TestHandler_Buy(t *testing.T) {
 			},
 			wantErr: &apierror.InvalidItemError,
 		},
+		{
+			name: "several units",
+			args: inputArgs{
+				username: "username",
+				param:    "cup",
+				query:    "?quantity=3",
+			},
+		},
+		{
+			name: "zero quantity",
+			args: inputArgs{
+				username: "username",
+				param:    "cup",
+				query:    "?quantity=0",
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "invalid quantity",
+			args: inputArgs{
+				username: "username",
+				param:    "cup",
+				query:    "?quantity=many",
+			},
+			wantErr: &apierror.BadRequestError,
+		},
 		{
 			name: "error in service.Buy",
 			args: inputArgs{
@@ -218,12 +341,12 @@ func TestHandler_Buy(t *testing.T) {
 			log := slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
-			h := NewHandler(log, nil, shopService)
-			shopService.On("Buy", mock.Anything, mock.Anything).Return(tt.args.buyOutputError)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("Buy", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(tt.args.buyOutputError)
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 			c.Set(usernameField, tt.args.username)
-			c.Request = httptest.NewRequest("POST", "localhost:8080/api/buy/cup", bytes.NewBufferString(""))
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/buy/cup"+tt.args.query, bytes.NewBufferString(""))
 			c.Params = []gin.Param{{Key: "item", Value: tt.args.param}}
 			h.Buy(c)
 
@@ -295,6 +418,44 @@ func TestHandler_validateSendCoinInput(t *testing.T) {
 			wantErr:        &apierror.BadRequestError,
 			wantErrMessage: "can't send to yourself",
 		},
+		{
+			name: "with message and category",
+			args: inputArgs{
+				username: "username",
+				input: model.Send{
+					ToUser:   "toUser",
+					Amount:   100,
+					Message:  "thanks for the code review",
+					Category: model.TransferCategoryGratitude,
+				},
+			},
+		},
+		{
+			name: "too long message",
+			args: inputArgs{
+				username: "username",
+				input: model.Send{
+					ToUser:  "toUser",
+					Amount:  100,
+					Message: strings.Repeat("a", maxTransferMessageLength+1),
+				},
+			},
+			wantErr:        &apierror.BadRequestError,
+			wantErrMessage: "message must be at most 200 characters long",
+		},
+		{
+			name: "unknown category",
+			args: inputArgs{
+				username: "username",
+				input: model.Send{
+					ToUser:   "toUser",
+					Amount:   100,
+					Category: "bribe",
+				},
+			},
+			wantErr:        &apierror.BadRequestError,
+			wantErrMessage: "unknown category",
+		},
 	}
 
 	for _, tt := range tests {
@@ -314,3 +475,248 @@ func TestHandler_validateSendCoinInput(t *testing.T) {
 	}
 
 }
+
+func TestHandler_sanitizeTransferMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "plain",
+			message: "thanks for lunch",
+			want:    "thanks for lunch",
+		},
+		{
+			name:    "surrounding and repeated whitespace",
+			message: "  thanks\n\tfor   lunch ",
+			want:    "thanks for lunch",
+		},
+		{
+			name:    "control and invisible characters",
+			message: "thanks\x00 for\u200b lunch\u202e",
+			want:    "thanks for lunch",
+		},
+		{
+			name:    "unicode is kept",
+			message: "спасибо 🙏",
+			want:    "спасибо 🙏",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeTransferMessage(tt.message))
+		})
+	}
+}
+
+func TestHandler_validateOrderInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   model.OrderInput
+		wantErr bool
+	}{
+		{
+			name:  "success",
+			input: model.OrderInput{Items: []model.OrderLine{{Type: "cup", Quantity: 2}, {Type: "pen", Quantity: 1}}},
+		},
+		{
+			name:    "empty order",
+			input:   model.OrderInput{},
+			wantErr: true,
+		},
+		{
+			name:    "empty item",
+			input:   model.OrderInput{Items: []model.OrderLine{{Quantity: 2}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate item",
+			input:   model.OrderInput{Items: []model.OrderLine{{Type: "cup", Quantity: 2}, {Type: "cup", Quantity: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "zero quantity",
+			input:   model.OrderInput{Items: []model.OrderLine{{Type: "cup"}}},
+			wantErr: true,
+		},
+		{
+			name:    "too big quantity",
+			input:   model.OrderInput{Items: []model.OrderLine{{Type: "cup", Quantity: maxOrderQuantity + 1}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOrderInput(tt.input)
+			if tt.wantErr {
+				assert.True(t, apierror.Is(err, apierror.BadRequestError))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestHandler_Checkout(t *testing.T) {
+	type inputArgs struct {
+		checkoutOutputError error
+		username            any
+		body                string
+	}
+
+	tests := []struct {
+		name        string
+		args        inputArgs
+		wantErr     *apierror.APIError
+		wantDetails string
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				username: "username",
+				body:     `{"items": [{"type": "cup", "quantity": 2}]}`,
+			},
+		},
+		{
+			name: "no username",
+			args: inputArgs{
+				body: `{"items": [{"type": "cup", "quantity": 2}]}`,
+			},
+			wantErr: &apierror.UnauthorizedError,
+		},
+		{
+			name: "invalid body",
+			args: inputArgs{
+				username: "username",
+				body:     `{"items": [{"type": "cup", "quantity": 0}]}`,
+			},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name: "unknown item",
+			args: inputArgs{
+				checkoutOutputError: apierror.NewAPIErrorWithDetails(apierror.InvalidItemError, "mock",
+					model.OrderErrorDetails{Lines: []model.OrderLineError{
+						{Line: 0, Type: "cup", Quantity: 2, Error: apierror.InvalidItemError.Message},
+					}}),
+				username: "username",
+				body:     `{"items": [{"type": "cup", "quantity": 2}]}`,
+			},
+			wantErr:     &apierror.InvalidItemError,
+			wantDetails: `"details":{"lines":[{"line":0,"type":"cup","quantity":2,"error":"no such item exists"}]}`,
+		},
+		{
+			name: "not enough money",
+			args: inputArgs{
+				checkoutOutputError: apierror.NewAPIErrorWithDetails(apierror.NotEnoughMoneyError, "mock",
+					model.OrderErrorDetails{
+						Lines: []model.OrderLineError{
+							{Line: 0, Type: "cup", Quantity: 2, Error: apierror.NotEnoughMoneyError.Message},
+						},
+						Total:   40,
+						Balance: 30,
+					}),
+				username: "username",
+				body:     `{"items": [{"type": "cup", "quantity": 2}]}`,
+			},
+			wantErr:     &apierror.NotEnoughMoneyError,
+			wantDetails: `"total":40,"balance":30`,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("Checkout", "username", mock.Anything, mock.Anything).Return(model.Order{
+				Items: []model.OrderLineOutput{{Type: "cup", Quantity: 2, UnitPrice: 20, Amount: 40}},
+				Total: 40,
+			}, tt.args.checkoutOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, tt.args.username)
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/orders", bytes.NewBufferString(tt.args.body))
+
+			h.Checkout(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				assert.Contains(t, w.Body.String(), tt.wantDetails)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Contains(t, w.Body.String(), `"total":40`)
+		})
+	}
+}
+
+func TestHandler_GetPurchases(t *testing.T) {
+	tests := []struct {
+		name                    string
+		query                   string
+		getPurchasesOutputError error
+		wantFilter              model.PurchasesFilter
+		wantErr                 *apierror.APIError
+	}{
+		{
+			name:       "defaults",
+			wantFilter: model.PurchasesFilter{Limit: defaultPurchasesLimit},
+		},
+		{
+			name:       "page",
+			query:      "?limit=10&offset=20",
+			wantFilter: model.PurchasesFilter{Limit: 10, Offset: 20},
+		},
+		{
+			name:    "limit too big",
+			query:   "?limit=1000",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:                    "error in service.GetPurchases",
+			getPurchasesOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantFilter:              model.PurchasesFilter{Limit: defaultPurchasesLimit},
+			wantErr:                 &apierror.InternalError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shopService := new(MockShopService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, shopService, nil, nil, nil, nil, nil, nil)
+			shopService.On("GetPurchases", "username", tt.wantFilter).Return([]model.Purchase{
+				{OrderID: 1, Type: "cup", Quantity: 2, UnitPrice: 20, Amount: 40, Status: model.OrderStatusPaid},
+			}, tt.getPurchasesOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("GET", "localhost:8080/api/purchases"+tt.query, nil)
+
+			h.GetPurchases(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				assert.Contains(t, w.Body.String(), tt.wantErr.Message)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `"unitPrice":20`)
+		})
+	}
+}
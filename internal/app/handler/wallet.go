@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	defaultWalletActivityLimit = 50
+	maxWalletActivityLimit     = 200
+	maxContributionAmount      = 1000000
+)
+
+// validateWalletName accepts the same names as usernames.
+func validateWalletName(name string) error {
+	if !usernamePattern.MatchString(name) {
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			"wallet name must be 3-32 characters long and contain only latin letters, digits, '.', '-' and '_'")
+	}
+	return nil
+}
+
+func validateWalletMemberInput(input model.WalletMemberInput) error {
+	switch input.Role {
+	case model.WalletRoleOwner, model.WalletRoleMember:
+		return nil
+	default:
+		return apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "unknown wallet role")
+	}
+}
+
+func (h *Handler) CreateWallet(ctx *gin.Context) {
+	const op = "handler.wallet.CreateWallet"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.WalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateWalletName(input.Name); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	wallet, err := h.walletService.CreateWallet(username, input)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while creating wallet", op))
+		return
+	}
+
+	h.logger.Info("wallet created", slog.String("wallet", wallet.Name), slog.String("owner", username))
+
+	ctx.JSON(http.StatusCreated, wallet)
+}
+
+func (h *Handler) GetWallets(ctx *gin.Context) {
+	const op = "handler.wallet.GetWallets"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	wallets, err := h.walletService.GetWallets(username)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting wallets", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wallets)
+}
+
+func (h *Handler) GetWallet(ctx *gin.Context) {
+	const op = "handler.wallet.GetWallet"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	wallet, err := h.walletService.GetWallet(username, ctx.Param("name"))
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting wallet", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, wallet)
+}
+
+// GetWalletActivity returns a page of the wallet's activity, ?member= narrows it down to one member.
+func (h *Handler) GetWalletActivity(ctx *gin.Context) {
+	const op = "handler.wallet.GetWalletActivity"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	filter := model.WalletActivityFilter{Wallet: ctx.Param("name"), Username: username, Member: ctx.Query("member")}
+	if filter.Limit, err = queryInt(ctx, "limit", defaultWalletActivityLimit); err == nil {
+		filter.Offset, err = queryInt(ctx, "offset", 0)
+	}
+	if err == nil && (filter.Limit == 0 || filter.Limit > maxWalletActivityLimit) {
+		err = apierror.NewAPIErrorWithMsg(apierror.BadRequestError, "limit is out of range")
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating query", op))
+		return
+	}
+
+	activity, err := h.walletService.GetWalletActivity(filter)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting wallet activity", op))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, activity)
+}
+
+// SetWalletMember adds a member to the wallet or changes their role, only owners manage the members.
+func (h *Handler) SetWalletMember(ctx *gin.Context) {
+	const op = "handler.wallet.SetWalletMember"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.WalletMemberInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if err := validateWalletMemberInput(input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+
+	membership := model.WalletMembership{
+		Wallet:   ctx.Param("name"),
+		Actor:    username,
+		Username: ctx.Param("username"),
+		Role:     input.Role,
+	}
+	wallet, err := h.walletService.SetWalletMember(membership)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while setting wallet member", op))
+		return
+	}
+
+	h.logger.Info("wallet member set",
+		slog.String("wallet", membership.Wallet), slog.String("by", username),
+		slog.String("member", membership.Username), slog.String("role", membership.Role))
+
+	ctx.JSON(http.StatusOK, wallet)
+}
+
+// RemoveWalletMember removes a member from the wallet, members can remove themselves.
+func (h *Handler) RemoveWalletMember(ctx *gin.Context) {
+	const op = "handler.wallet.RemoveWalletMember"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	wallet, member := ctx.Param("name"), ctx.Param("username")
+	if err := h.walletService.RemoveWalletMember(username, wallet, member); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while removing wallet member", op))
+		return
+	}
+
+	h.logger.Info("wallet member removed",
+		slog.String("wallet", wallet), slog.String("by", username), slog.String("member", member))
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Contribute moves coins from the user to a wallet they are a member of.
+func (h *Handler) Contribute(ctx *gin.Context) {
+	const op = "handler.wallet.Contribute"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.ContributionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	if input.Amount <= 0 || input.Amount > maxContributionAmount {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": invalid amount of coin"))
+		return
+	}
+
+	wallet := ctx.Param("name")
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	activity, err := h.walletService.Contribute(username, wallet, input.Amount, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while contributing", op))
+		return
+	}
+
+	h.logger.Info("coins contributed",
+		slog.String("wallet", wallet), slog.String("username", username), slog.Int("amount", input.Amount))
+
+	ctx.JSON(http.StatusOK, activity)
+}
+
+// WalletSendCoin sends coins from the wallet on behalf of one of its owners.
+func (h *Handler) WalletSendCoin(ctx *gin.Context) {
+	const op = "handler.wallet.WalletSendCoin"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	var input model.Send
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger,
+			apierror.NewAPIError(apierror.BadRequestError, errors.Wrap(err, op+": error while getting data from request body")))
+		return
+	}
+
+	// the owner may pay themselves from the wallet, so the receiver isn't compared with the owner
+	input.Message = sanitizeTransferMessage(input.Message)
+	if err := validateSendCoinInput(input, ""); err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating input", op))
+		return
+	}
+	if input.Category == "" {
+		input.Category = model.TransferCategoryOther
+	}
+
+	wallet := ctx.Param("name")
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	activity, err := h.walletService.WalletSendCoin(username, wallet, input, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while sending coins", op))
+		return
+	}
+
+	h.logger.Info("coins sent from wallet",
+		slog.String("wallet", wallet), slog.String("owner", username),
+		slog.String("to", input.ToUser), slog.Int("amount", input.Amount))
+
+	ctx.JSON(http.StatusOK, activity)
+}
+
+// WalletBuy buys an item from the wallet on behalf of one of its owners, the item goes to the owner.
+func (h *Handler) WalletBuy(ctx *gin.Context) {
+	const op = "handler.wallet.WalletBuy"
+
+	username, err := getUsername(ctx)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while getting username", op))
+		return
+	}
+
+	item := ctx.Param("item")
+	if item == "" {
+		apierror.LogAndRespondError(ctx, h.logger, apierror.NewAPIErrorWithMsg(apierror.InvalidItemError, op+": empty item"))
+		return
+	}
+
+	quantity, err := queryInt(ctx, "quantity", 1)
+	if err == nil {
+		err = validateQuantity(quantity)
+	}
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while validating quantity", op))
+		return
+	}
+
+	wallet := ctx.Param("name")
+	key := getIdempotencyKey(ctx)
+	if key != nil {
+		key.StatusCode = http.StatusOK
+	}
+
+	order, err := h.walletService.WalletBuy(username, wallet, item, quantity, key)
+	if err != nil {
+		apierror.LogAndRespondError(ctx, h.logger, errors.Wrapf(err, "%s: error while buying item", op))
+		return
+	}
+
+	h.logger.Info("item was bought from wallet",
+		slog.String("wallet", wallet), slog.String("owner", username),
+		slog.String("item", item), slog.Int("quantity", quantity))
+
+	ctx.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockWalletService struct {
+	mock.Mock
+}
+
+func (m *MockWalletService) CreateWallet(username string, input model.WalletInput) (model.Wallet, error) {
+	args := m.Called(username, input)
+	wallet, _ := args.Get(0).(model.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletService) GetWallets(username string) ([]model.Wallet, error) {
+	args := m.Called(username)
+	wallets, _ := args.Get(0).([]model.Wallet)
+	return wallets, args.Error(1)
+}
+
+func (m *MockWalletService) GetWallet(username, name string) (model.WalletDetails, error) {
+	args := m.Called(username, name)
+	wallet, _ := args.Get(0).(model.WalletDetails)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletService) GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error) {
+	args := m.Called(filter)
+	activity, _ := args.Get(0).([]model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletService) SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error) {
+	args := m.Called(membership)
+	wallet, _ := args.Get(0).(model.WalletDetails)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletService) RemoveWalletMember(actor, wallet, username string) error {
+	args := m.Called(actor, wallet, username)
+	return args.Error(0)
+}
+
+func (m *MockWalletService) Contribute(username, wallet string, amount int,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	args := m.Called(username, wallet, amount, key)
+	activity, _ := args.Get(0).(model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletService) WalletSendCoin(owner, wallet string, send model.Send,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	args := m.Called(owner, wallet, send, key)
+	activity, _ := args.Get(0).(model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletService) WalletBuy(owner, wallet, item string, quantity int,
+	key *model.IdempotencyKey) (model.Order, error) {
+	args := m.Called(owner, wallet, item, quantity, key)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func TestHandler_CreateWallet(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "success",
+			body: `{"name": "backend-team"}`,
+		},
+		{
+			name:    "invalid request body",
+			body:    "invalid json",
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "invalid name",
+			body:    `{"name": "backend team"}`,
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletService := new(MockWalletService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, walletService, nil, nil, nil)
+			walletService.On("CreateWallet", "username", mock.Anything).
+				Return(model.Wallet{Name: "backend-team", Role: model.WalletRoleOwner}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/wallets", bytes.NewBufferString(tt.body))
+
+			h.CreateWallet(c)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr.Status, w.Code)
+				walletService.AssertNotCalled(t, "CreateWallet", mock.Anything, mock.Anything)
+				return
+			}
+			assert.Equal(t, http.StatusCreated, w.Code)
+			walletService.AssertCalled(t, "CreateWallet", "username", model.WalletInput{Name: "backend-team"})
+		})
+	}
+}
+
+func TestHandler_SetWalletMember(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setOutputError error
+		wantCode       int
+		wantCalled     bool
+	}{
+		{
+			name:       "success",
+			body:       `{"role": "owner"}`,
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:     "unknown role",
+			body:     `{"role": "admin"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:           "not an owner",
+			body:           `{"role": "member"}`,
+			setOutputError: apierror.NewAPIErrorWithMsg(apierror.ForbiddenError, "mock"),
+			wantCode:       http.StatusForbidden,
+			wantCalled:     true,
+		},
+		{
+			name:           "last owner",
+			body:           `{"role": "member"}`,
+			setOutputError: apierror.NewAPIErrorWithMsg(apierror.WalletLastOwnerError, "mock"),
+			wantCode:       apierror.WalletLastOwnerError.Status,
+			wantCalled:     true,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletService := new(MockWalletService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, walletService, nil, nil, nil)
+			walletService.On("SetWalletMember", mock.Anything).Return(model.WalletDetails{}, tt.setOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "name", Value: "backend-team"}, {Key: "username", Value: "user2"}}
+			c.Request = httptest.NewRequest("PUT", "localhost:8080/api/wallets/backend-team/members/user2",
+				bytes.NewBufferString(tt.body))
+
+			h.SetWalletMember(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if !tt.wantCalled {
+				walletService.AssertNotCalled(t, "SetWalletMember", mock.Anything)
+				return
+			}
+			walletService.AssertCalled(t, "SetWalletMember", mock.MatchedBy(func(membership model.WalletMembership) bool {
+				return membership.Wallet == "backend-team" && membership.Actor == "username" &&
+					membership.Username == "user2"
+			}))
+		})
+	}
+}
+
+func TestHandler_WalletSendCoin(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		sendOutputError error
+		wantCode        int
+		wantCalled      bool
+	}{
+		{
+			name:       "success",
+			body:       `{"toUser": "user2", "amount": 100}`,
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:       "owner pays themselves",
+			body:       `{"toUser": "username", "amount": 100}`,
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:     "invalid amount",
+			body:     `{"toUser": "user2", "amount": 0}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:            "not an owner",
+			body:            `{"toUser": "user2", "amount": 100}`,
+			sendOutputError: apierror.NewAPIErrorWithMsg(apierror.ForbiddenError, "mock"),
+			wantCode:        http.StatusForbidden,
+			wantCalled:      true,
+		},
+		{
+			name:            "not enough money in the wallet",
+			body:            `{"toUser": "user2", "amount": 100}`,
+			sendOutputError: apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, "mock"),
+			wantCode:        apierror.NotEnoughMoneyError.Status,
+			wantCalled:      true,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletService := new(MockWalletService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, walletService, nil, nil, nil)
+			walletService.On("WalletSendCoin", "username", "backend-team", mock.Anything, mock.Anything).
+				Return(model.WalletActivity{ID: 1, Kind: model.WalletActivityTransfer}, tt.sendOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "name", Value: "backend-team"}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/wallets/backend-team/sendCoin",
+				bytes.NewBufferString(tt.body))
+
+			h.WalletSendCoin(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if !tt.wantCalled {
+				walletService.AssertNotCalled(t, "WalletSendCoin", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestHandler_Contribute(t *testing.T) {
+	tests := []struct {
+		name                  string
+		body                  string
+		contributeOutputError error
+		wantCode              int
+		wantCalled            bool
+	}{
+		{
+			name:       "success",
+			body:       `{"amount": 100}`,
+			wantCode:   http.StatusOK,
+			wantCalled: true,
+		},
+		{
+			name:     "invalid amount",
+			body:     `{"amount": -100}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:                  "not a member",
+			body:                  `{"amount": 100}`,
+			contributeOutputError: apierror.NewAPIErrorWithMsg(apierror.WalletNotFoundError, "mock"),
+			wantCode:              apierror.WalletNotFoundError.Status,
+			wantCalled:            true,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletService := new(MockWalletService)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			h := NewHandler(log, nil, nil, nil, nil, walletService, nil, nil, nil)
+			walletService.On("Contribute", "username", "backend-team", 100, mock.Anything).
+				Return(model.WalletActivity{ID: 1, Kind: model.WalletActivityContribution}, tt.contributeOutputError)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(usernameField, "username")
+			c.Params = []gin.Param{{Key: "name", Value: "backend-team"}}
+			c.Request = httptest.NewRequest("POST", "localhost:8080/api/wallets/backend-team/contribute",
+				bytes.NewBufferString(tt.body))
+
+			h.Contribute(c)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if !tt.wantCalled {
+				walletService.AssertNotCalled(t, "Contribute", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
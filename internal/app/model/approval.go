@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+	ApprovalStatusExpired  = "expired"
+)
+
+// TransferApproval is a transfer above the approval threshold. Its amount is reserved from the sender
+// until an admin or the receiver's manager decides on it, or until it expires.
+type TransferApproval struct {
+	ID        int64      `json:"id" db:"id"`
+	FromUser  string     `json:"fromUser" db:"sender"`
+	ToUser    string     `json:"toUser" db:"receiver"`
+	Amount    int        `json:"amount" db:"amount"`
+	Message   string     `json:"message,omitempty" db:"message"`
+	Category  string     `json:"category" db:"category"`
+	Status    string     `json:"status" db:"status"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+	ExpiresAt time.Time  `json:"expiresAt" db:"expires_at"`
+	DecidedBy *string    `json:"decidedBy,omitempty" db:"decided_by"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty" db:"decided_at"`
+}
+
+// ApprovalDecision is an approver's decision. Admin approvers may decide on any transfer,
+// the others only on transfers to the users they manage.
+type ApprovalDecision struct {
+	ID       int64
+	Approver string
+	Admin    bool
+	Approve  bool
+}
+
+type ManagerInput struct {
+	Manager string `json:"manager"`
+}
@@ -1,14 +1,67 @@
 package model
 
+import "time"
+
+const (
+	RoleUser    = "user"
+	RoleAdmin   = "admin"
+	RoleAuditor = "auditor"
+)
+
 type AuthInput struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 type AuthOutput struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RoleInput struct {
+	Role string `json:"role"`
 }
 
 type AuthDB struct {
 	Username     string `db:"username"`
 	PasswordHash string `db:"password_hash"`
+	Role         string `db:"role"`
+}
+
+// TokenClaims is what the service extracts from a verified access token.
+type TokenClaims struct {
+	Username  string
+	Role      string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// RefreshToken is a persisted refresh token. Only the SHA-256 of the opaque token is stored;
+// tokens issued by rotation share FamilyID with the token they replaced.
+type RefreshToken struct {
+	TokenHash string     `db:"token_hash"`
+	Username  string     `db:"username"`
+	FamilyID  string     `db:"family_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+// JWKS is the JSON Web Key Set (RFC 7517) with the public token verification keys.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
 }
@@ -0,0 +1,64 @@
+package model
+
+// CatalogItem is an item of the shop as the admin sees it. Archived items
+// (Active is false) can't be bought but stay in the inventories of their owners.
+// Nil Stock means the supply is unlimited; LowStock is set once Stock drops to LowStockThreshold.
+type CatalogItem struct {
+	Type              string `json:"type" db:"type"`
+	Price             int    `json:"price" db:"price"`
+	Description       string `json:"description" db:"description"`
+	Active            bool   `json:"active" db:"active"`
+	Stock             *int   `json:"stock" db:"stock"`
+	LowStockThreshold int    `json:"lowStockThreshold" db:"low_stock_threshold"`
+	LowStock          bool   `json:"lowStock" db:"low_stock"`
+}
+
+// CatalogItemUpdate is a partial update of an item, nil fields are left as is.
+type CatalogItemUpdate struct {
+	Price             *int    `json:"price"`
+	Description       *string `json:"description"`
+	Active            *bool   `json:"active"`
+	LowStockThreshold *int    `json:"lowStockThreshold"`
+}
+
+type RestockInput struct {
+	Quantity int `json:"quantity"`
+}
+
+// StockInput sets the stock of an item, null makes the supply unlimited.
+type StockInput struct {
+	Stock *int `json:"stock"`
+}
+
+const (
+	ItemsSortType      = "type"
+	ItemsSortTypeDesc  = "-type"
+	ItemsSortPrice     = "price"
+	ItemsSortPriceDesc = "-price"
+)
+
+// ItemsFilter selects a page of the public catalog. Zero MinPrice and MaxPrice mean no bound.
+type ItemsFilter struct {
+	Search   string
+	MinPrice int
+	MaxPrice int
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+// ShopItem is an item as the buyers see it. Available is false for archived and sold out items.
+type ShopItem struct {
+	Type        string `json:"type" db:"type"`
+	Price       int    `json:"price" db:"price"`
+	Description string `json:"description" db:"description"`
+	Available   bool   `json:"available" db:"available"`
+	LowStock    bool   `json:"lowStock" db:"low_stock"`
+}
+
+type ItemsPage struct {
+	Items  []ShopItem `json:"items"`
+	Total  int        `json:"total"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+}
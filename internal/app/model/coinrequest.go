@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+const (
+	CoinRequestStatusPending  = "pending"
+	CoinRequestStatusAccepted = "accepted"
+	CoinRequestStatusDeclined = "declined"
+
+	CoinRequestDirectionIncoming = "incoming"
+	CoinRequestDirectionOutgoing = "outgoing"
+)
+
+// CoinRequest is a request of the requester to be paid by the payer. An accepted request is paid
+// like a transfer from the payer, so it may also have to wait for an approval.
+type CoinRequest struct {
+	ID         int64      `json:"id" db:"id"`
+	Requester  string     `json:"requester" db:"requester"`
+	Payer      string     `json:"payer" db:"payer"`
+	Amount     int        `json:"amount" db:"amount"`
+	Message    string     `json:"message,omitempty" db:"message"`
+	Category   string     `json:"category" db:"category"`
+	Status     string     `json:"status" db:"status"`
+	ApprovalID *int64     `json:"approvalId,omitempty" db:"approval_id"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	DecidedAt  *time.Time `json:"decidedAt,omitempty" db:"decided_at"`
+}
+
+type CoinRequestInput struct {
+	FromUser string `json:"fromUser"`
+	Amount   int    `json:"amount"`
+	Message  string `json:"message"`
+	Category string `json:"category"`
+}
+
+// CoinRequestsFilter selects the requests the user received (incoming) or made (outgoing).
+type CoinRequestsFilter struct {
+	Username  string
+	Direction string
+	Status    string
+}
+
+// CoinRequestAcceptance is the payer's acceptance of a request. ApprovalExpiresAt is set
+// when the amount is above the approval threshold, then the transfer is only reserved.
+type CoinRequestAcceptance struct {
+	ID                int64
+	Payer             string
+	Limits            TransferLimits
+	ApprovalExpiresAt *time.Time
+}
@@ -1,10 +1,26 @@
 package model
 
 const (
-	EnvPasswordSalt  = "PASSWORD_SALT"
-	EnvSigningKey    = "SIGNING_KEY"
-	EnvTokenTTLHours = "TOKEN_TTL_HOURS" //nolint:gosec
-	EnvMoneyForStart = "MONEY_FOR_START"
+	EnvPasswordSalt          = "PASSWORD_SALT"
+	EnvPasswordHasher        = "PASSWORD_HASHER"
+	EnvSigningKey            = "SIGNING_KEY"
+	EnvJWTKeysDir            = "JWT_KEYS_DIR"
+	EnvJWTActiveKID          = "JWT_ACTIVE_KID"
+	EnvAccessTokenTTLMinutes = "ACCESS_TOKEN_TTL_MINUTES" //nolint:gosec
+	EnvRefreshTokenTTLHours  = "REFRESH_TOKEN_TTL_HOURS"  //nolint:gosec
+	EnvTokenTTLHours         = "TOKEN_TTL_HOURS"          //nolint:gosec
+	EnvMoneyForStart         = "MONEY_FOR_START"
+	EnvAuthAutoSignUp        = "AUTH_AUTO_SIGNUP"
+	EnvRefundGracePeriod     = "REFUND_GRACE_PERIOD_MINUTES"
+	EnvIdempotencyKeyTTL     = "IDEMPOTENCY_KEY_TTL_HOURS"
+	EnvReconcileInterval     = "RECONCILE_INTERVAL_MINUTES"
+
+	EnvTransferMaxAmount       = "TRANSFER_MAX_AMOUNT"
+	EnvTransferDailyAmount     = "TRANSFER_DAILY_AMOUNT"
+	EnvTransferDailyCount      = "TRANSFER_DAILY_COUNT"
+	EnvTransferDailyRecipients = "TRANSFER_DAILY_RECIPIENTS"
+	EnvApprovalThreshold       = "TRANSFER_APPROVAL_THRESHOLD"
+	EnvApprovalTTL             = "TRANSFER_APPROVAL_TTL_HOURS"
 
 	EnvDatabasePort     = "DATABASE_PORT"
 	EnvDatabaseUser     = "DATABASE_USER"
@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// GrantLine is a line of a batch, Line is where it comes from: the line of the CSV file,
+// or the position in the grants of a JSON body. Errors of the line are reported with it.
+type GrantLine struct {
+	Line     int    `json:"-"`
+	Username string `json:"username"`
+	Amount   int    `json:"amount"`
+}
+
+type GrantInput struct {
+	Reason string      `json:"reason"`
+	Grants []GrantLine `json:"grants"`
+}
+
+// GrantBatch credits every line at once, or none of them. A dry run checks the batch without crediting.
+type GrantBatch struct {
+	Reason    string
+	GrantedBy string
+	Grants    []GrantLine
+	DryRun    bool
+}
+
+type GrantResult struct {
+	Username string `json:"username"`
+	Amount   int    `json:"amount"`
+	Balance  int    `json:"balance"`
+}
+
+// GrantReport is the outcome of a batch, Balance of every line is the recipient's balance after the grant.
+// A dry run has no ID, since nothing is saved.
+type GrantReport struct {
+	ID         int64         `json:"id,omitempty" db:"id"`
+	Reason     string        `json:"reason" db:"reason"`
+	GrantedBy  string        `json:"grantedBy" db:"granted_by"`
+	DryRun     bool          `json:"dryRun"`
+	Recipients int           `json:"recipients"`
+	Total      int           `json:"total" db:"total"`
+	Grants     []GrantResult `json:"grants"`
+	CreatedAt  *time.Time    `json:"createdAt,omitempty" db:"created_at"`
+}
+
+type GrantLineError struct {
+	Line     int    `json:"line"`
+	Username string `json:"username"`
+	Error    string `json:"error"`
+}
+
+type GrantErrorDetails struct {
+	Lines []GrantLineError `json:"lines"`
+}
+
+// GrantHistory is a grant as it's shown in the coin history of its recipient.
+type GrantHistory struct {
+	GrantID int64  `json:"grantId" db:"grant_id"`
+	Amount  int    `json:"amount" db:"amount"`
+	Reason  string `json:"reason" db:"reason"`
+}
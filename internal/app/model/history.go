@@ -0,0 +1,147 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HistoryDirectionSent     = "sent"
+	HistoryDirectionReceived = "received"
+
+	HistoryAggregateCounterparty = "counterparty"
+
+	HistoryExportFormatCSV   = "csv"
+	HistoryExportFormatJSONL = "jsonl"
+)
+
+// HistoryEntry is a transfer as the user sees it. Counterparty is the receiver of a sent transfer and
+// the sender of a received one, Wallet is set if the sender paid it from a shared wallet.
+type HistoryEntry struct {
+	ID           int64     `json:"id" db:"id"`
+	Direction    string    `json:"direction" db:"direction"`
+	Counterparty string    `json:"counterparty" db:"counterparty"`
+	Amount       int       `json:"amount" db:"amount"`
+	Message      string    `json:"message,omitempty" db:"message"`
+	Category     string    `json:"category" db:"category"`
+	Wallet       string    `json:"wallet,omitempty" db:"wallet"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// HistoryCursor points at the last entry of a page, the next page starts right after it.
+// The history is ordered from the latest transfer by (CreatedAt, ID).
+type HistoryCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// String encodes the cursor into an opaque token for the client.
+func (c HistoryCursor) String() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseHistoryCursor decodes a token made by HistoryCursor.String.
+func ParseHistoryCursor(token string) (HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return HistoryCursor{}, err
+	}
+
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return HistoryCursor{}, errors.New("malformed cursor")
+	}
+
+	createdAt, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return HistoryCursor{}, err
+	}
+	cursor := HistoryCursor{CreatedAt: time.UnixMicro(createdAt).UTC()}
+	if cursor.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return HistoryCursor{}, err
+	}
+
+	return cursor, nil
+}
+
+// HistoryFilter selects a page of the user's transfers. Empty Direction matches both directions,
+// zero amounts and nil times mean no bound, From is inclusive and To is exclusive.
+type HistoryFilter struct {
+	Username     string
+	Direction    string
+	Counterparty string
+	MinAmount    int
+	MaxAmount    int
+	From         *time.Time
+	To           *time.Time
+	After        *HistoryCursor
+	Limit        int
+}
+
+// HistoryPage is a page of the history, NextCursor is empty on the last page.
+type HistoryPage struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// CounterpartyHistory sums up the transfers between the user and a counterparty in one direction.
+type CounterpartyHistory struct {
+	Direction    string    `json:"direction" db:"direction"`
+	Counterparty string    `json:"counterparty" db:"counterparty"`
+	Amount       int       `json:"amount" db:"amount"`
+	Count        int       `json:"count" db:"count"`
+	FirstAt      time.Time `json:"firstAt" db:"first_at"`
+	LastAt       time.Time `json:"lastAt" db:"last_at"`
+}
+
+// HistoryExportFilter selects the transfers to export, empty Username exports the transfers of all users.
+// Nil times mean no bound, From is inclusive and To is exclusive.
+type HistoryExportFilter struct {
+	Username string
+	From     *time.Time
+	To       *time.Time
+}
+
+// TransferExportColumns is the header of the CSV export, in the order of TransferExport.Record.
+var TransferExportColumns = []string{"id", "created_at", "sender", "receiver", "amount", "category", "message", "wallet"}
+
+// TransferExport is an exported transfer, Wallet is set if the sender paid it from a shared wallet.
+// The JSON keys follow TransferExportColumns.
+type TransferExport struct {
+	ID        int64     `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Sender    string    `json:"sender" db:"sender"`
+	Receiver  string    `json:"receiver" db:"receiver"`
+	Amount    int       `json:"amount" db:"amount"`
+	Category  string    `json:"category" db:"category"`
+	Message   string    `json:"message" db:"message"`
+	Wallet    string    `json:"wallet" db:"wallet"`
+}
+
+// Record returns the CSV row of the transfer. The sender, the receiver and the message are free text,
+// so such a cell that starts like a spreadsheet formula is prefixed with ' to be shown as text.
+// The other cells are numbers, times or values checked on input and are written as they are.
+func (t TransferExport) Record() []string {
+	return []string{
+		strconv.FormatInt(t.ID, 10),
+		t.CreatedAt.UTC().Format(time.RFC3339Nano),
+		csvText(t.Sender),
+		csvText(t.Receiver),
+		strconv.Itoa(t.Amount),
+		t.Category,
+		csvText(t.Message),
+		t.Wallet,
+	}
+}
+
+// csvText escapes a free-text cell that a spreadsheet would run as a formula.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
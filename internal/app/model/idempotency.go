@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyKey is the Idempotency-Key of a request together with the response that was sent for it.
+// RequestHash covers the method, the URI and the body, so the key can't be reused for another request.
+type IdempotencyKey struct {
+	Username    string    `db:"username"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	StatusCode  int       `db:"status_code"`
+	Response    []byte    `db:"response"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
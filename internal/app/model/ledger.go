@@ -0,0 +1,68 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Ledger accounts. Coins are issued from LedgerAccountIssuance, so its balance is the
+// negative of all the coins in circulation, LedgerAccountShop collects what was spent
+// and LedgerAccountEscrow holds the amounts of transfers waiting for approval. Every user
+// and every shared wallet has an account of its own.
+const (
+	LedgerAccountIssuance = "issuance"
+	LedgerAccountShop     = "shop"
+	LedgerAccountEscrow   = "escrow"
+
+	ledgerUserAccountPrefix   = "user:"
+	ledgerWalletAccountPrefix = "wallet:"
+)
+
+const (
+	LedgerKindStartGrant   = "start_grant"
+	LedgerKindTransfer     = "transfer"
+	LedgerKindPurchase     = "purchase"
+	LedgerKindRefund       = "refund"
+	LedgerKindGrant        = "grant"
+	LedgerKindReserve      = "reserve"
+	LedgerKindRelease      = "release"
+	LedgerKindContribution = "contribution"
+)
+
+func UserAccount(username string) string {
+	return ledgerUserAccountPrefix + username
+}
+
+// AccountUsername returns the user of a user account.
+func AccountUsername(account string) (string, bool) {
+	return strings.CutPrefix(account, ledgerUserAccountPrefix)
+}
+
+func WalletAccount(wallet string) string {
+	return ledgerWalletAccountPrefix + wallet
+}
+
+// AccountWallet returns the wallet of a wallet account.
+func AccountWallet(account string) (string, bool) {
+	return strings.CutPrefix(account, ledgerWalletAccountPrefix)
+}
+
+// Posting moves Amount coins from one account to another. It's written to the ledger as two
+// entries of the same posting: -Amount for From and +Amount for To.
+type Posting struct {
+	From      string
+	To        string
+	Amount    int
+	Kind      string
+	Reference string
+}
+
+type LedgerEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	PostingID int64     `json:"postingId" db:"posting_id"`
+	Account   string    `json:"account" db:"account"`
+	Amount    int       `json:"amount" db:"amount"`
+	Kind      string    `json:"kind" db:"kind"`
+	Reference string    `json:"reference" db:"reference"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,121 @@
+package model
+
+import "time"
+
+const (
+	OrderStatusCreated        = "created"
+	OrderStatusPaid           = "paid"
+	OrderStatusReadyForPickup = "ready_for_pickup"
+	OrderStatusDelivered      = "delivered"
+	OrderStatusCancelled      = "cancelled"
+)
+
+// OrderStatusTransitions lists the statuses an order can be moved to from its current status.
+// Delivered and cancelled orders are final.
+var OrderStatusTransitions = map[string][]string{
+	OrderStatusCreated:        {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:           {OrderStatusReadyForPickup, OrderStatusDelivered},
+	OrderStatusReadyForPickup: {OrderStatusDelivered},
+}
+
+type OrderLine struct {
+	Type     string `json:"type"`
+	Quantity int    `json:"quantity"`
+}
+
+type OrderInput struct {
+	Items []OrderLine `json:"items"`
+}
+
+type OrderLineOutput struct {
+	Type      string `json:"type" db:"item"`
+	Quantity  int    `json:"quantity" db:"quantity"`
+	UnitPrice int    `json:"unitPrice" db:"unit_price"`
+	Amount    int    `json:"amount" db:"amount"`
+}
+
+// Order is paid by the user, or from the shared Wallet if it's set.
+type Order struct {
+	ID               int64             `json:"id" db:"id"`
+	Username         string            `json:"username" db:"username"`
+	Status           string            `json:"status" db:"status"`
+	Items            []OrderLineOutput `json:"items"`
+	Total            int               `json:"total" db:"total"`
+	CreatedAt        time.Time         `json:"createdAt" db:"created_at"`
+	PaidAt           *time.Time        `json:"paidAt,omitempty" db:"paid_at"`
+	ReadyForPickupAt *time.Time        `json:"readyForPickupAt,omitempty" db:"ready_at"`
+	DeliveredAt      *time.Time        `json:"deliveredAt,omitempty" db:"delivered_at"`
+	CancelledAt      *time.Time        `json:"cancelledAt,omitempty" db:"cancelled_at"`
+	Wallet           *string           `json:"wallet,omitempty" db:"wallet"`
+}
+
+// OrdersFilter selects a page of orders, empty Username and Status match any.
+type OrdersFilter struct {
+	Username string
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+type OrderStatusInput struct {
+	Status string `json:"status"`
+}
+
+// RefundRequest describes who cancels the order and under which restrictions.
+// Empty Owner lets any order be refunded, zero PaidAfter disables the grace period check.
+// Delivered orders are refunded only with AllowDelivered, which is how admins accept returns.
+type RefundRequest struct {
+	OrderID        int64
+	Owner          string
+	PaidAfter      time.Time
+	AllowDelivered bool
+	RefundedBy     string
+	Reason         string
+}
+
+type RefundInput struct {
+	Reason string `json:"reason"`
+}
+
+type Refund struct {
+	ID         int64     `json:"id" db:"id"`
+	OrderID    int64     `json:"orderId" db:"order_id"`
+	Username   string    `json:"username" db:"username"`
+	Amount     int       `json:"amount" db:"amount"`
+	Reason     string    `json:"reason" db:"reason"`
+	RefundedBy string    `json:"refundedBy" db:"refunded_by"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+// OrderLineError explains why a line of a rejected order can't be bought.
+// Line is the index of the line in the request.
+type OrderLineError struct {
+	Line     int    `json:"line"`
+	Type     string `json:"type"`
+	Quantity int    `json:"quantity"`
+	Error    string `json:"error"`
+}
+
+// OrderErrorDetails is returned in the details of a rejected order. Total and
+// Balance are filled in only when the order is rejected for lack of money.
+type OrderErrorDetails struct {
+	Lines   []OrderLineError `json:"lines"`
+	Total   int              `json:"total,omitempty"`
+	Balance int              `json:"balance,omitempty"`
+}
+
+// Purchase is a line of an order as it's shown in the purchase history.
+type Purchase struct {
+	OrderID   int64     `json:"orderId" db:"order_id"`
+	Type      string    `json:"type" db:"item"`
+	Quantity  int       `json:"quantity" db:"quantity"`
+	UnitPrice int       `json:"unitPrice" db:"unit_price"`
+	Amount    int       `json:"amount" db:"amount"`
+	Status    string    `json:"status" db:"status"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type PurchasesFilter struct {
+	Limit  int
+	Offset int
+}
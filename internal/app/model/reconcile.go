@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// BalanceCheck is a user's balance as it's cached in users.balance, as it's posted to the ledger
+// and as it's recomputed from start grants, transfers, purchases, refunds, admin grants and reservations.
+type BalanceCheck struct {
+	Username        string `json:"username" db:"username"`
+	Balance         int    `json:"balance" db:"balance"`
+	LedgerBalance   int    `json:"ledgerBalance" db:"ledger_balance"`
+	ExpectedBalance int    `json:"expectedBalance" db:"expected_balance"`
+}
+
+// WalletBalanceCheck is a shared wallet's balance as it's cached in wallets.balance, as it's posted
+// to the ledger and as it's recomputed from the wallet's activity.
+type WalletBalanceCheck struct {
+	Wallet          string `json:"wallet" db:"wallet"`
+	Balance         int    `json:"balance" db:"balance"`
+	LedgerBalance   int    `json:"ledgerBalance" db:"ledger_balance"`
+	ExpectedBalance int    `json:"expectedBalance" db:"expected_balance"`
+}
+
+// CoinConservation checks that every issued coin is either on a user's balance, in a shared wallet,
+// in the shop or reserved for a transfer waiting for approval.
+type CoinConservation struct {
+	Issued         int  `json:"issued" db:"issued"`
+	UsersBalance   int  `json:"usersBalance" db:"users_balance"`
+	WalletsBalance int  `json:"walletsBalance" db:"wallets_balance"`
+	ShopBalance    int  `json:"shopBalance" db:"shop_balance"`
+	EscrowBalance  int  `json:"escrowBalance" db:"escrow_balance"`
+	Conserved      bool `json:"conserved"`
+}
+
+// LedgerSnapshot is everything the reconciliation reads, taken from one consistent snapshot.
+type LedgerSnapshot struct {
+	Balances           []BalanceCheck
+	WalletBalances     []WalletBalanceCheck
+	UnbalancedPostings []int64
+	Conservation       CoinConservation
+}
+
+type ReconciliationReport struct {
+	CheckedAt           time.Time            `json:"checkedAt"`
+	Users               int                  `json:"users"`
+	Discrepancies       []BalanceCheck       `json:"discrepancies"`
+	Wallets             int                  `json:"wallets"`
+	WalletDiscrepancies []WalletBalanceCheck `json:"walletDiscrepancies"`
+	UnbalancedPostings  []int64              `json:"unbalancedPostings"`
+	Conservation        CoinConservation     `json:"conservation"`
+	OK                  bool                 `json:"ok"`
+}
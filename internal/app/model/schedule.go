@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// ScheduledTransfer is a transfer made at NextRunAt, once or repeatedly by its cron expression.
+// LastError is the error of the last run, if it failed.
+type ScheduledTransfer struct {
+	ID        int64      `json:"id" db:"id"`
+	FromUser  string     `json:"fromUser" db:"sender"`
+	ToUser    string     `json:"toUser" db:"receiver"`
+	Amount    int        `json:"amount" db:"amount"`
+	Message   string     `json:"message,omitempty" db:"message"`
+	Category  string     `json:"category" db:"category"`
+	Cron      *string    `json:"cron,omitempty" db:"cron"`
+	Status    string     `json:"status" db:"status"`
+	NextRunAt *time.Time `json:"nextRunAt,omitempty" db:"next_run_at"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty" db:"last_run_at"`
+	LastError *string    `json:"lastError,omitempty" db:"last_error"`
+	Runs      int        `json:"runs" db:"runs"`
+	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// ScheduledTransferInput schedules a transfer either once at RunAt or by the Cron expression in UTC.
+type ScheduledTransferInput struct {
+	ToUser   string     `json:"toUser"`
+	Amount   int        `json:"amount"`
+	Message  string     `json:"message"`
+	Category string     `json:"category"`
+	RunAt    *time.Time `json:"runAt"`
+	Cron     string     `json:"cron"`
+}
@@ -11,19 +11,86 @@ type Item struct {
 	Quantity int    `json:"quantity" db:"quantity"`
 }
 
+// CoinHistory is the history in /api/info. Counterparties is only filled in the aggregated mode,
+// then it stands for Received and Sent.
 type CoinHistory struct {
-	Received []Receive `json:"received"`
-	Sent     []Send    `json:"sent"`
+	Received       []Receive             `json:"received"`
+	Sent           []Send                `json:"sent"`
+	Refunds        []RefundHistory       `json:"refunds"`
+	Grants         []GrantHistory        `json:"grants"`
+	Approvals      []TransferApproval    `json:"approvals"`
+	Counterparties []CounterpartyHistory `json:"counterparties,omitempty"`
 }
 
+// InfoFilter shapes the history in /api/info. A positive HistoryLimit keeps only that many of the
+// latest received and sent transfers, Aggregate set to HistoryAggregateCounterparty sums them up
+// per counterparty instead.
+type InfoFilter struct {
+	HistoryLimit int
+	Aggregate    string
+}
+
+const (
+	TransferCategoryGratitude = "gratitude"
+	TransferCategoryRepayment = "repayment"
+	TransferCategoryGift      = "gift"
+	TransferCategoryReward    = "reward"
+	TransferCategoryOther     = "other"
+)
+
+// Receive is a received transfer, Wallet is set if the sender paid it from a shared wallet.
 type Receive struct {
 	FromUser string `json:"fromUser" db:"sender"`
 	Amount   int    `json:"amount" db:"amount"`
+	Message  string `json:"message,omitempty" db:"message"`
+	Category string `json:"category" db:"category"`
+	Wallet   string `json:"wallet,omitempty" db:"wallet"`
 }
 
 type Send struct {
-	ToUser string `json:"toUser" db:"receiver"`
-	Amount int    `json:"amount" db:"amount"`
+	ToUser   string `json:"toUser" db:"receiver"`
+	Amount   int    `json:"amount" db:"amount"`
+	Message  string `json:"message,omitempty" db:"message"`
+	Category string `json:"category" db:"category"`
+}
+
+// RefundHistory is a refunded order as it's shown in the coin history.
+type RefundHistory struct {
+	OrderID int64 `json:"orderId" db:"order_id"`
+	Amount  int   `json:"amount" db:"amount"`
+}
+
+const (
+	TransferLimitAmount          = "amount"
+	TransferLimitDailyAmount     = "daily_amount"
+	TransferLimitDailyCount      = "daily_count"
+	TransferLimitDailyRecipients = "daily_recipients"
+	// TransferLimitApprovalThreshold caps the transfers from shared wallets, which have no manager to approve them
+	TransferLimitApprovalThreshold = "approval_threshold"
+)
+
+// TransferLimits caps the transfers of a sender, zero means no limit.
+// The daily limits cover the last 24 hours.
+type TransferLimits struct {
+	MaxAmount       int
+	DailyAmount     int
+	DailyCount      int
+	DailyRecipients int
+}
+
+// TransferUsage is what the sender has sent in the last 24 hours.
+type TransferUsage struct {
+	Amount         int  `db:"amount"`
+	Count          int  `db:"count"`
+	Recipients     int  `db:"recipients"`
+	SentToReceiver bool `db:"sent_to_receiver"`
+}
+
+// TransferLimitDetails tells which limit was exceeded and what is left of it.
+type TransferLimitDetails struct {
+	Limit     string `json:"limit"`
+	Max       int    `json:"max"`
+	Remaining int    `json:"remaining"`
 }
 
 type User struct {
@@ -0,0 +1,87 @@
+package model
+
+import "time"
+
+const (
+	WalletRoleOwner  = "owner"
+	WalletRoleMember = "member"
+
+	WalletActivityContribution = "contribution"
+	WalletActivityTransfer     = "transfer"
+	WalletActivityPurchase     = "purchase"
+	WalletActivityRefund       = "refund"
+)
+
+// Wallet is a balance shared by a team. Role is the role of the user who reads the wallet.
+type Wallet struct {
+	Name      string    `json:"name" db:"name"`
+	Balance   int       `json:"balance" db:"balance"`
+	Role      string    `json:"role" db:"role"`
+	CreatedBy string    `json:"createdBy" db:"created_by"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// WalletMember is a member of a wallet with what they have put into it and spent from it.
+type WalletMember struct {
+	Username    string    `json:"username" db:"username"`
+	Role        string    `json:"role" db:"role"`
+	Contributed int       `json:"contributed" db:"contributed"`
+	Spent       int       `json:"spent" db:"spent"`
+	AddedBy     string    `json:"addedBy" db:"added_by"`
+	AddedAt     time.Time `json:"addedAt" db:"added_at"`
+}
+
+type WalletDetails struct {
+	Wallet
+	Members []WalletMember `json:"members"`
+}
+
+// WalletActivity is a coin movement of a wallet attributed to the member who made it.
+// Amount is negative for spending, Counterparty is the receiver of a transfer.
+type WalletActivity struct {
+	ID           int64     `json:"id" db:"id"`
+	Username     string    `json:"username" db:"username"`
+	Kind         string    `json:"kind" db:"kind"`
+	Amount       int       `json:"amount" db:"amount"`
+	Counterparty string    `json:"counterparty,omitempty" db:"counterparty"`
+	Reference    string    `json:"reference,omitempty" db:"reference"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// WalletActivityFilter selects a page of the activity of the wallet, the latest first.
+// Username is the member who reads it, Member narrows it down to one member.
+type WalletActivityFilter struct {
+	Wallet   string
+	Username string
+	Member   string
+	Limit    int
+	Offset   int
+}
+
+type WalletInput struct {
+	Name string `json:"name"`
+}
+
+type WalletMemberInput struct {
+	Role string `json:"role"`
+}
+
+// WalletMembership is a change of a member's role made by Actor, who must be an owner of the wallet.
+type WalletMembership struct {
+	Wallet   string
+	Actor    string
+	Username string
+	Role     string
+}
+
+type ContributionInput struct {
+	Amount int `json:"amount"`
+}
+
+// WalletTransfer is a transfer an owner makes from the wallet, it's limited like the owner's own transfers.
+type WalletTransfer struct {
+	Wallet string
+	Owner  string
+	Send   Send
+	Limits TransferLimits
+}
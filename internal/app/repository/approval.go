@@ -0,0 +1,337 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const approvalColumns = `id, sender, receiver, amount, message, category, status, created_at, expires_at,
+				decided_by, decided_at`
+
+type ApprovalRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewApprovalRepository(logger *slog.Logger, db *sqlx.DB) *ApprovalRepository {
+	return &ApprovalRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// ReserveTransfer moves the amount of a transfer above the approval threshold to escrow and creates
+// a pending approval for it. The transfer is checked against the balance and the limits the same way
+// as SendCoin, so a reserved transfer can always be completed.
+func (a *ApprovalRepository) ReserveTransfer(fromUsername string, send model.Send, limits model.TransferLimits,
+	expiresAt time.Time, key *model.IdempotencyKey) (model.TransferApproval, error) {
+	const op = "repository.approval.ReserveTransfer"
+
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(a.logger, tx)
+
+	if err := prepareTransfer(tx, fromUsername, send, limits); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed reserve transfer)", op)
+	}
+
+	approval, err := reserve(tx, fromUsername, send, expiresAt)
+	if err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed reserve transfer)", op)
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(approval); err != nil {
+			return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal approval)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed reserve transfer)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return approval, nil
+}
+
+// DecideApproval approves or rejects a pending transfer. An approved transfer is paid from escrow
+// to the receiver and appears in the coin history, a rejected one is released back to the sender.
+// A transfer that has expired in the meantime is released and ApprovalExpiredError is returned.
+func (a *ApprovalRepository) DecideApproval(decision model.ApprovalDecision,
+	key *model.IdempotencyKey) (model.TransferApproval, error) {
+	const op = "repository.approval.DecideApproval"
+
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(a.logger, tx)
+
+	approval, err := lockApproval(tx, decision.ID)
+	if err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed get approval)", op)
+	}
+
+	if approval.FromUser == decision.Approver {
+		return model.TransferApproval{}, apierror.NewAPIErrorWithMsg(apierror.ForbiddenError,
+			op+": (failed check approver): can't decide on own transfer")
+	}
+
+	if !decision.Admin {
+		queryGetManager := fmt.Sprintf(`SELECT COALESCE(manager, '') FROM %s WHERE username = $1`, usersTable)
+		var manager string
+		if err := tx.Get(&manager, queryGetManager, approval.ToUser); err != nil {
+			return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed get manager)", op))
+		}
+		if manager != decision.Approver {
+			return model.TransferApproval{}, apierror.NewAPIErrorWithMsg(apierror.ForbiddenError,
+				op+": (failed check approver): approver isn't the receiver's manager")
+		}
+	}
+
+	if approval.Status != model.ApprovalStatusPending {
+		return model.TransferApproval{}, apierror.NewAPIErrorWithMsg(apierror.ApprovalDecidedError,
+			fmt.Sprintf("%s: (failed check status): approval is %s", op, approval.Status))
+	}
+
+	if !approval.ExpiresAt.After(time.Now()) {
+		if _, err := releaseApproval(tx, approval, model.ApprovalStatusExpired, nil); err != nil {
+			return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed expire approval)", op)
+		}
+		if err := tx.Commit(); err != nil {
+			return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed commit)", op))
+		}
+		return model.TransferApproval{}, apierror.NewAPIErrorWithMsg(apierror.ApprovalExpiredError,
+			op+": (failed check expiry): approval has expired")
+	}
+
+	if !decision.Approve {
+		approval, err = releaseApproval(tx, approval, model.ApprovalStatusRejected, &decision.Approver)
+		if err != nil {
+			return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed reject approval)", op)
+		}
+	} else {
+		if approval, err = completeApproval(tx, approval, decision.Approver); err != nil {
+			return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed approve approval)", op)
+		}
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(approval); err != nil {
+			return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal approval)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed decide approval)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return approval, nil
+}
+
+// ExpireApprovals releases the reserved coins of pending transfers that are past their expiry.
+// Approvals locked by a concurrent decision are skipped, so it's safe to run on every replica.
+func (a *ApprovalRepository) ExpireApprovals() (int, error) {
+	const op = "repository.approval.ExpireApprovals"
+
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(a.logger, tx)
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s
+				WHERE status = $1 AND expires_at <= now()
+				ORDER BY id FOR UPDATE SKIP LOCKED`, approvalColumns, approvalsTable)
+	var approvals []model.TransferApproval
+	if err := tx.Select(&approvals, query, model.ApprovalStatusPending); err != nil {
+		return 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get approvals)", op))
+	}
+
+	for _, approval := range approvals {
+		if _, err := releaseApproval(tx, approval, model.ApprovalStatusExpired, nil); err != nil {
+			return 0, errors.Wrapf(err, "%s: (failed expire approval)", op)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return len(approvals), nil
+}
+
+// GetPendingApprovals returns the pending transfers to the users of the manager,
+// or all pending transfers if the manager is empty.
+func (a *ApprovalRepository) GetPendingApprovals(manager string) ([]model.TransferApproval, error) {
+	const op = "repository.approval.GetPendingApprovals"
+
+	query := fmt.Sprintf(
+		`SELECT a.id, a.sender, a.receiver, a.amount, a.message, a.category, a.status, a.created_at, a.expires_at,
+				       a.decided_by, a.decided_at
+				FROM %s a
+				JOIN %s u ON u.username = a.receiver
+				WHERE a.status = $1 AND ($2 = '' OR u.manager = $2)
+				ORDER BY a.created_at, a.id`, approvalsTable, usersTable)
+	approvals := make([]model.TransferApproval, 0)
+	if err := a.db.Select(&approvals, query, model.ApprovalStatusPending, manager); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get approvals)", op))
+	}
+
+	return approvals, nil
+}
+
+// reserve moves the coins prepared by prepareTransfer to escrow and creates a pending approval for the transfer.
+func reserve(tx *sqlx.Tx, fromUsername string, send model.Send, expiresAt time.Time) (model.TransferApproval, error) {
+	const op = "repository.approval.reserve"
+
+	queryAddApproval := fmt.Sprintf(
+		`INSERT INTO %s (sender, receiver, amount, message, category, expires_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING %s`, approvalsTable, approvalColumns)
+	var approval model.TransferApproval
+	if err := tx.Get(&approval, queryAddApproval,
+		fromUsername, send.ToUser, send.Amount, send.Message, send.Category, expiresAt); err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save approval)", op))
+	}
+
+	if err := post(tx, model.Posting{
+		From:      model.UserAccount(fromUsername),
+		To:        model.LedgerAccountEscrow,
+		Amount:    send.Amount,
+		Kind:      model.LedgerKindReserve,
+		Reference: approvalReference(approval.ID),
+	}); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed reserve coins)", op)
+	}
+
+	return approval, nil
+}
+
+func lockApproval(tx *sqlx.Tx, id int64) (model.TransferApproval, error) {
+	const op = "repository.approval.lockApproval"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1 FOR UPDATE`, approvalColumns, approvalsTable)
+	var approval model.TransferApproval
+	if err := tx.Get(&approval, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.TransferApproval{}, apierror.NewAPIError(apierror.ApprovalNotFoundError,
+				errors.Wrapf(err, "%s: (failed find approval)", op))
+		}
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get approval)", op))
+	}
+
+	return approval, nil
+}
+
+// lockApprovalUsers locks the users of the approval in the same order as prepareTransfer does.
+func lockApprovalUsers(tx *sqlx.Tx, approval model.TransferApproval) error {
+	const op = "repository.approval.lockApprovalUsers"
+
+	query := fmt.Sprintf(`SELECT username FROM %s WHERE username IN ($1, $2) FOR UPDATE`, usersTable)
+	var usernames []string
+	if err := tx.Select(&usernames, query, approval.FromUser, approval.ToUser); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed lock users)", op))
+	}
+
+	return nil
+}
+
+// releaseApproval returns the reserved coins to the sender and closes the approval with the status.
+// A coin request paid by the transfer is reopened, so the payer can pay or decline it again.
+func releaseApproval(tx *sqlx.Tx, approval model.TransferApproval, status string,
+	decidedBy *string) (model.TransferApproval, error) {
+	const op = "repository.approval.releaseApproval"
+
+	if err := lockApprovalUsers(tx, approval); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed release coins)", op)
+	}
+
+	if err := post(tx, model.Posting{
+		From:      model.LedgerAccountEscrow,
+		To:        model.UserAccount(approval.FromUser),
+		Amount:    approval.Amount,
+		Kind:      model.LedgerKindRelease,
+		Reference: approvalReference(approval.ID),
+	}); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed release coins)", op)
+	}
+
+	if err := reopenCoinRequest(tx, approval.ID); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed release coins)", op)
+	}
+
+	return closeApproval(tx, approval.ID, status, decidedBy)
+}
+
+// completeApproval pays the reserved coins to the receiver and records the transfer.
+func completeApproval(tx *sqlx.Tx, approval model.TransferApproval, approver string) (model.TransferApproval, error) {
+	const op = "repository.approval.completeApproval"
+
+	if err := lockApprovalUsers(tx, approval); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed pay coins)", op)
+	}
+
+	if err := post(tx, model.Posting{
+		From:      model.LedgerAccountEscrow,
+		To:        model.UserAccount(approval.ToUser),
+		Amount:    approval.Amount,
+		Kind:      model.LedgerKindTransfer,
+		Reference: approvalReference(approval.ID),
+	}); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed pay coins)", op)
+	}
+
+	if err := saveTransaction(tx, approval.FromUser, model.Send{
+		ToUser:   approval.ToUser,
+		Amount:   approval.Amount,
+		Message:  approval.Message,
+		Category: approval.Category,
+	}); err != nil {
+		return model.TransferApproval{}, errors.Wrapf(err, "%s: (failed pay coins)", op)
+	}
+
+	return closeApproval(tx, approval.ID, model.ApprovalStatusApproved, &approver)
+}
+
+func closeApproval(tx *sqlx.Tx, id int64, status string, decidedBy *string) (model.TransferApproval, error) {
+	const op = "repository.approval.closeApproval"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET status = $1, decided_by = $2, decided_at = now() WHERE id = $3
+				RETURNING %s`, approvalsTable, approvalColumns)
+	var approval model.TransferApproval
+	if err := tx.Get(&approval, query, status, decidedBy, id); err != nil {
+		return model.TransferApproval{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed update approval)", op))
+	}
+
+	return approval, nil
+}
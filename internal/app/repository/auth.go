@@ -26,28 +26,25 @@ func NewAuthRepository(logger *slog.Logger, db *sqlx.DB) *AuthRepository {
 	}
 }
 
-func (a *AuthRepository) Auth(username, passwordHash string) error {
-	const op = "repository.auth.Auth"
+func (a *AuthRepository) GetUser(username string) (model.AuthDB, error) {
+	const op = "repository.auth.GetUser"
 
-	query := fmt.Sprintf(`SELECT username, password_hash FROM %s WHERE username = $1`, usersTable)
+	query := fmt.Sprintf(`SELECT username, password_hash, role FROM %s WHERE username = $1`, usersTable)
 	var user model.AuthDB
 
 	if err := a.db.Get(&user, query, username); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return a.createNewUser(username, passwordHash)
+			return model.AuthDB{}, apierror.NewAPIError(apierror.UserNotFoundError,
+				errors.Wrapf(err, "%s: (failed find user)", op))
 		}
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get user)", op))
+		return model.AuthDB{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get user)", op))
 	}
 
-	if passwordHash != user.PasswordHash {
-		return apierror.NewAPIErrorWithMsg(apierror.WrongPasswordError, op+": (failed sign in user): wrong password")
-	}
-
-	return nil
+	return user, nil
 }
 
-func (a *AuthRepository) createNewUser(username, passwordHash string) error {
-	const op = "repository.auth.createNewUser"
+func (a *AuthRepository) CreateUser(username, passwordHash string) error {
+	const op = "repository.auth.CreateUser"
 
 	moneyForStart, err := strconv.Atoi(os.Getenv(model.EnvMoneyForStart))
 	if err != nil {
@@ -55,10 +52,83 @@ func (a *AuthRepository) createNewUser(username, passwordHash string) error {
 			errors.Wrapf(err, "%s: (%s must be numeric)", op, model.EnvMoneyForStart))
 	}
 
-	querySignUp := fmt.Sprintf(`INSERT INTO %s VALUES ($1, $2, $3)`, usersTable)
-	if _, err := a.db.Exec(querySignUp, username, passwordHash, moneyForStart); err != nil {
+	tx, err := a.db.Beginx()
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(a.logger, tx)
+
+	// the user starts with no coins, the start grant is issued through the ledger
+	querySignUp := fmt.Sprintf(`INSERT INTO %s VALUES ($1, $2, 0)`, usersTable)
+	if _, err := tx.Exec(querySignUp, username, passwordHash); err != nil {
+		if isUniqueViolation(err) {
+			return apierror.NewAPIError(apierror.UserAlreadyExistsError, errors.Wrapf(err, "%s: (failed sign up user)", op))
+		}
 		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed sign up user)", op))
 	}
 
+	if moneyForStart > 0 {
+		if err := post(tx, model.Posting{
+			From:   model.LedgerAccountIssuance,
+			To:     model.UserAccount(username),
+			Amount: moneyForStart,
+			Kind:   model.LedgerKindStartGrant,
+		}); err != nil {
+			return errors.Wrapf(err, "%s: (failed issue start coins)", op)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return nil
+}
+
+func (a *AuthRepository) UpdatePasswordHash(username, passwordHash string) error {
+	const op = "repository.auth.UpdatePasswordHash"
+
+	query := fmt.Sprintf(`UPDATE %s SET password_hash = $1 WHERE username = $2`, usersTable)
+	if _, err := a.db.Exec(query, passwordHash, username); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update password hash)", op))
+	}
+
+	return nil
+}
+
+func (a *AuthRepository) UpdateRole(username, role string) error {
+	const op = "repository.auth.UpdateRole"
+
+	query := fmt.Sprintf(`UPDATE %s SET role = $1 WHERE username = $2`, usersTable)
+	res, err := a.db.Exec(query, role, username)
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update role)", op))
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, op+": (failed update role): user not found")
+	}
+
+	return nil
+}
+
+// UpdateManager sets the manager who approves large transfers to the user, an empty manager removes it.
+func (a *AuthRepository) UpdateManager(username, manager string) error {
+	const op = "repository.auth.UpdateManager"
+
+	query := fmt.Sprintf(`UPDATE %s SET manager = NULLIF($1, '') WHERE username = $2`, usersTable)
+	res, err := a.db.Exec(query, manager, username)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return apierror.NewAPIError(apierror.NoSuchUserError,
+				errors.Wrapf(err, "%s: (failed update manager): manager not found", op))
+		}
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update manager)", op))
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, op+": (failed update manager): user not found")
+	}
+
 	return nil
 }
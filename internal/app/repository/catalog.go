@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type CatalogRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewCatalogRepository(logger *slog.Logger, db *sqlx.DB) *CatalogRepository {
+	return &CatalogRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+const (
+	lowStockColumn     = `stock IS NOT NULL AND stock <= low_stock_threshold AS low_stock`
+	catalogItemColumns = `type, price, description, active, stock, low_stock_threshold, ` + lowStockColumn
+	shopItemColumns    = `type, price, description, active AND (stock IS NULL OR stock > 0) AS available, ` + lowStockColumn
+)
+
+func (c *CatalogRepository) ListItems() ([]model.CatalogItem, error) {
+	const op = "repository.catalog.ListItems"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s ORDER BY type`, catalogItemColumns, itemsTable)
+	items := make([]model.CatalogItem, 0)
+	if err := c.db.Select(&items, query); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get items)", op))
+	}
+
+	return items, nil
+}
+
+var itemsOrderBy = map[string]string{
+	model.ItemsSortType:      "type",
+	model.ItemsSortTypeDesc:  "type DESC",
+	model.ItemsSortPrice:     "price, type",
+	model.ItemsSortPriceDesc: "price DESC, type",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetItems returns a page of the items that can be bought.
+func (c *CatalogRepository) GetItems(filter model.ItemsFilter) ([]model.ShopItem, int, error) {
+	const op = "repository.catalog.GetItems"
+
+	orderBy, ok := itemsOrderBy[filter.Sort]
+	if !ok {
+		return nil, 0, apierror.NewAPIErrorWithMsg(apierror.BadRequestError, op+": (failed get items): unknown sort")
+	}
+
+	conditions := []string{"active"}
+	var args []interface{}
+	if filter.Search != "" {
+		args = append(args, likeEscaper.Replace(filter.Search))
+		conditions = append(conditions, fmt.Sprintf(`type ILIKE '%%' || $%d || '%%'`, len(args)))
+	}
+	if filter.MinPrice > 0 {
+		args = append(args, filter.MinPrice)
+		conditions = append(conditions, fmt.Sprintf(`price >= $%d`, len(args)))
+	}
+	if filter.MaxPrice > 0 {
+		args = append(args, filter.MaxPrice)
+		conditions = append(conditions, fmt.Sprintf(`price <= $%d`, len(args)))
+	}
+	where := strings.Join(conditions, " AND ")
+
+	queryCount := fmt.Sprintf(`SELECT count(*) FROM %s WHERE %s`, itemsTable, where)
+	var total int
+	if err := c.db.Get(&total, queryCount, args...); err != nil {
+		return nil, 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed count items)", op))
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d`,
+		shopItemColumns, itemsTable, where, orderBy, len(args)+1, len(args)+2)
+	items := make([]model.ShopItem, 0)
+	if err := c.db.Select(&items, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get items)", op))
+	}
+
+	return items, total, nil
+}
+
+// GetItem returns an item that is on sale, archived items aren't found.
+func (c *CatalogRepository) GetItem(itemType string) (model.ShopItem, error) {
+	const op = "repository.catalog.GetItem"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE type = $1 AND active`, shopItemColumns, itemsTable)
+	var item model.ShopItem
+	if err := c.db.Get(&item, query, itemType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ShopItem{}, apierror.NewAPIError(apierror.ItemNotFoundError, errors.Wrapf(err, "%s: (failed find item)", op))
+		}
+		return model.ShopItem{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get item)", op))
+	}
+
+	return item, nil
+}
+
+// GetCatalogItem returns the item whether it's on sale or archived.
+func (c *CatalogRepository) GetCatalogItem(itemType string) (model.CatalogItem, error) {
+	const op = "repository.catalog.GetCatalogItem"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE type = $1`, catalogItemColumns, itemsTable)
+	var item model.CatalogItem
+	if err := c.db.Get(&item, query, itemType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CatalogItem{}, apierror.NewAPIError(apierror.ItemNotFoundError,
+				errors.Wrapf(err, "%s: (failed find item)", op))
+		}
+		return model.CatalogItem{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get item)", op))
+	}
+
+	return item, nil
+}
+
+func (c *CatalogRepository) CreateItem(item model.CatalogItem) error {
+	const op = "repository.catalog.CreateItem"
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (type, price, description, active, stock, low_stock_threshold) VALUES ($1, $2, $3, $4, $5, $6)`,
+		itemsTable)
+	if _, err := c.db.Exec(query,
+		item.Type, item.Price, item.Description, item.Active, item.Stock, item.LowStockThreshold); err != nil {
+		if isUniqueViolation(err) {
+			return apierror.NewAPIError(apierror.ItemAlreadyExistsError, errors.Wrapf(err, "%s: (failed create item)", op))
+		}
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed create item)", op))
+	}
+
+	return nil
+}
+
+func (c *CatalogRepository) UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error) {
+	const op = "repository.catalog.UpdateItem"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET price = COALESCE($1, price),
+                  description = COALESCE($2, description),
+                  active = COALESCE($3, active),
+                  low_stock_threshold = COALESCE($4, low_stock_threshold)
+				WHERE type = $5
+				RETURNING %s`, itemsTable, catalogItemColumns)
+	var item model.CatalogItem
+	if err := c.db.Get(&item, query,
+		update.Price, update.Description, update.Active, update.LowStockThreshold, itemType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CatalogItem{}, apierror.NewAPIError(apierror.ItemNotFoundError,
+				errors.Wrapf(err, "%s: (failed find item)", op))
+		}
+		return model.CatalogItem{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed update item)", op))
+	}
+
+	return item, nil
+}
+
+func (c *CatalogRepository) ArchiveItem(itemType string) error {
+	const op = "repository.catalog.ArchiveItem"
+
+	query := fmt.Sprintf(`UPDATE %s SET active = false WHERE type = $1`, itemsTable)
+	res, err := c.db.Exec(query, itemType)
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed archive item)", op))
+	}
+
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, op+": (failed archive item): item not found")
+	}
+
+	return nil
+}
+
+// RestockItem adds quantity units to the stock of the item. Items with unlimited supply stay unlimited.
+func (c *CatalogRepository) RestockItem(itemType string, quantity int) (model.CatalogItem, error) {
+	const op = "repository.catalog.RestockItem"
+
+	query := fmt.Sprintf(`UPDATE %s SET stock = stock + $1 WHERE type = $2 RETURNING %s`,
+		itemsTable, catalogItemColumns)
+	var item model.CatalogItem
+	if err := c.db.Get(&item, query, quantity, itemType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CatalogItem{}, apierror.NewAPIError(apierror.ItemNotFoundError,
+				errors.Wrapf(err, "%s: (failed find item)", op))
+		}
+		return model.CatalogItem{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed restock item)", op))
+	}
+
+	return item, nil
+}
+
+// SetStock overwrites the stock of the item, nil stock makes the supply unlimited.
+func (c *CatalogRepository) SetStock(itemType string, stock *int) (model.CatalogItem, error) {
+	const op = "repository.catalog.SetStock"
+
+	query := fmt.Sprintf(`UPDATE %s SET stock = $1 WHERE type = $2 RETURNING %s`, itemsTable, catalogItemColumns)
+	var item model.CatalogItem
+	if err := c.db.Get(&item, query, stock, itemType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CatalogItem{}, apierror.NewAPIError(apierror.ItemNotFoundError,
+				errors.Wrapf(err, "%s: (failed find item)", op))
+		}
+		return model.CatalogItem{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed set stock)", op))
+	}
+
+	return item, nil
+}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const coinRequestColumns = `id, requester, payer, amount, message, category, status, approval_id, created_at, decided_at`
+
+type CoinRequestRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewCoinRequestRepository(logger *slog.Logger, db *sqlx.DB) *CoinRequestRepository {
+	return &CoinRequestRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (c *CoinRequestRepository) CreateCoinRequest(request model.CoinRequest) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.CreateCoinRequest"
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (requester, payer, amount, message, category) VALUES ($1, $2, $3, $4, $5)
+				RETURNING %s`, coinRequestsTable, coinRequestColumns)
+	var created model.CoinRequest
+	if err := c.db.Get(&created, query,
+		request.Requester, request.Payer, request.Amount, request.Message, request.Category); err != nil {
+		if isForeignKeyViolation(err) {
+			return model.CoinRequest{}, apierror.NewAPIError(apierror.NoSuchUserError,
+				errors.Wrapf(err, "%s: (failed save coin request): payer not found", op))
+		}
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save coin request)", op))
+	}
+
+	return created, nil
+}
+
+func (c *CoinRequestRepository) GetCoinRequest(id int64) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.GetCoinRequest"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1`, coinRequestColumns, coinRequestsTable)
+	var request model.CoinRequest
+	if err := c.db.Get(&request, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CoinRequest{}, apierror.NewAPIError(apierror.CoinRequestNotFoundError,
+				errors.Wrapf(err, "%s: (failed find coin request)", op))
+		}
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get coin request)", op))
+	}
+
+	return request, nil
+}
+
+// GetCoinRequests returns the requests the user has to pay (incoming) or has made (outgoing), the latest first.
+func (c *CoinRequestRepository) GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error) {
+	const op = "repository.coinrequest.GetCoinRequests"
+
+	column := "payer"
+	if filter.Direction == model.CoinRequestDirectionOutgoing {
+		column = "requester"
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s
+				WHERE %s = $1 AND ($2 = '' OR status = $2)
+				ORDER BY created_at DESC, id DESC`, coinRequestColumns, coinRequestsTable, column)
+	requests := make([]model.CoinRequest, 0)
+	if err := c.db.Select(&requests, query, filter.Username, filter.Status); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get coin requests)", op))
+	}
+
+	return requests, nil
+}
+
+// AcceptCoinRequest pays a pending request from the payer through the same checks and locks as SendCoin.
+// If the acceptance has an approval expiry, the transfer is reserved until it's approved instead,
+// and the request is reopened if the approval is rejected or expires.
+func (c *CoinRequestRepository) AcceptCoinRequest(acceptance model.CoinRequestAcceptance,
+	key *model.IdempotencyKey) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.AcceptCoinRequest"
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(c.logger, tx)
+
+	request, err := lockPendingCoinRequest(tx, acceptance.ID, acceptance.Payer)
+	if err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed get coin request)", op)
+	}
+
+	send := model.Send{
+		ToUser:   request.Requester,
+		Amount:   request.Amount,
+		Message:  request.Message,
+		Category: request.Category,
+	}
+	if err := prepareTransfer(tx, request.Payer, send, acceptance.Limits); err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed pay coin request)", op)
+	}
+
+	var approvalID *int64
+	if acceptance.ApprovalExpiresAt != nil {
+		approval, err := reserve(tx, request.Payer, send, *acceptance.ApprovalExpiresAt)
+		if err != nil {
+			return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed pay coin request)", op)
+		}
+		approvalID = &approval.ID
+	} else if err := transfer(tx, request.Payer, send, coinRequestReference(request.ID)); err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed pay coin request)", op)
+	}
+
+	if request, err = closeCoinRequest(tx, request.ID, model.CoinRequestStatusAccepted, approvalID); err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed accept coin request)", op)
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(request); err != nil {
+			return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal coin request)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed accept coin request)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return request, nil
+}
+
+func (c *CoinRequestRepository) DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.DeclineCoinRequest"
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(c.logger, tx)
+
+	if _, err := lockPendingCoinRequest(tx, id, payer); err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed get coin request)", op)
+	}
+
+	request, err := closeCoinRequest(tx, id, model.CoinRequestStatusDeclined, nil)
+	if err != nil {
+		return model.CoinRequest{}, errors.Wrapf(err, "%s: (failed decline coin request)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return request, nil
+}
+
+// lockPendingCoinRequest locks a pending request of the payer. Requests to other users
+// are reported as not found, so their existence isn't disclosed.
+func lockPendingCoinRequest(tx *sqlx.Tx, id int64, payer string) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.lockPendingCoinRequest"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1 AND payer = $2 FOR UPDATE`,
+		coinRequestColumns, coinRequestsTable)
+	var request model.CoinRequest
+	if err := tx.Get(&request, query, id, payer); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.CoinRequest{}, apierror.NewAPIError(apierror.CoinRequestNotFoundError,
+				errors.Wrapf(err, "%s: (failed find coin request)", op))
+		}
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get coin request)", op))
+	}
+
+	if request.Status != model.CoinRequestStatusPending {
+		return model.CoinRequest{}, apierror.NewAPIErrorWithMsg(apierror.CoinRequestDecidedError,
+			fmt.Sprintf("%s: (failed check status): coin request is %s", op, request.Status))
+	}
+
+	return request, nil
+}
+
+func closeCoinRequest(tx *sqlx.Tx, id int64, status string, approvalID *int64) (model.CoinRequest, error) {
+	const op = "repository.coinrequest.closeCoinRequest"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET status = $1, approval_id = $2, decided_at = now() WHERE id = $3
+				RETURNING %s`, coinRequestsTable, coinRequestColumns)
+	var request model.CoinRequest
+	if err := tx.Get(&request, query, status, approvalID, id); err != nil {
+		return model.CoinRequest{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed update coin request)", op))
+	}
+
+	return request, nil
+}
+
+// reopenCoinRequest returns the request paid by the approval's transfer, if any, to pending.
+func reopenCoinRequest(tx *sqlx.Tx, approvalID int64) error {
+	const op = "repository.coinrequest.reopenCoinRequest"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET status = $1, approval_id = NULL, decided_at = NULL WHERE approval_id = $2`, coinRequestsTable)
+	if _, err := tx.Exec(query, model.CoinRequestStatusPending, approvalID); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update coin request)", op))
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+// GrantCoins issues new coins to every recipient of the batch in one transaction. Unknown recipients
+// are reported in the details of the returned error. A dry run locks and checks the recipients the same
+// way, but the transaction is rolled back, so the report shows what the batch would do.
+// The idempotency key, if any, is saved in the same transaction, a dry run leaves it unclaimed.
+func (s *ShoppingRepository) GrantCoins(batch model.GrantBatch, key *model.IdempotencyKey) (model.GrantReport, error) {
+	const op = "repository.grant.GrantCoins"
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(s.logger, tx)
+
+	usernames := make([]string, 0, len(batch.Grants))
+	for _, line := range batch.Grants {
+		usernames = append(usernames, line.Username)
+	}
+
+	// the users are locked in the same order by every batch, so concurrent batches can't deadlock
+	queryLockUsers := fmt.Sprintf(
+		`SELECT username, COALESCE(balance, 0) AS balance FROM %s
+				WHERE username = ANY($1) ORDER BY username FOR UPDATE`, usersTable)
+	var users []model.User
+	if err := tx.Select(&users, queryLockUsers, pq.Array(usernames)); err != nil {
+		return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get users)", op))
+	}
+
+	balances := make(map[string]int, len(users))
+	for _, user := range users {
+		balances[user.Username] = user.Balance
+	}
+
+	report := model.GrantReport{
+		Reason:     batch.Reason,
+		GrantedBy:  batch.GrantedBy,
+		DryRun:     batch.DryRun,
+		Recipients: len(batch.Grants),
+		Grants:     make([]model.GrantResult, 0, len(batch.Grants)),
+	}
+	var lineErrors []model.GrantLineError
+	for _, line := range batch.Grants {
+		balance, ok := balances[line.Username]
+		if !ok {
+			lineErrors = append(lineErrors, model.GrantLineError{
+				Line: line.Line, Username: line.Username, Error: apierror.NoSuchUserError.Message})
+			continue
+		}
+
+		report.Total += line.Amount
+		report.Grants = append(report.Grants, model.GrantResult{
+			Username: line.Username, Amount: line.Amount, Balance: balance + line.Amount})
+	}
+
+	if len(lineErrors) > 0 {
+		return model.GrantReport{}, apierror.NewAPIErrorWithDetails(apierror.NoSuchUserError,
+			op+": (failed check recipients): some users don't exist", model.GrantErrorDetails{Lines: lineErrors})
+	}
+
+	if batch.DryRun {
+		return report, nil
+	}
+
+	queryAddGrant := fmt.Sprintf(
+		`INSERT INTO %s (reason, granted_by, total) VALUES ($1, $2, $3) RETURNING id, created_at`, grantsTable)
+	if err := tx.QueryRowx(queryAddGrant, batch.Reason, batch.GrantedBy, report.Total).
+		Scan(&report.ID, &report.CreatedAt); err != nil {
+		return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save grant)", op))
+	}
+
+	queryAddGrantItem := fmt.Sprintf(`INSERT INTO %s (grant_id, username, amount) VALUES ($1, $2, $3)`, grantItemsTable)
+	for _, line := range batch.Grants {
+		if _, err := tx.Exec(queryAddGrantItem, report.ID, line.Username, line.Amount); err != nil {
+			return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed save grant item)", op))
+		}
+
+		if err := post(tx, model.Posting{
+			From:      model.LedgerAccountIssuance,
+			To:        model.UserAccount(line.Username),
+			Amount:    line.Amount,
+			Kind:      model.LedgerKindGrant,
+			Reference: grantReference(report.ID),
+		}); err != nil {
+			return model.GrantReport{}, errors.Wrapf(err, "%s: (failed issue coins)", op)
+		}
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(report); err != nil {
+			return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal report)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.GrantReport{}, errors.Wrapf(err, "%s: (failed grant coins)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.GrantReport{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return report, nil
+}
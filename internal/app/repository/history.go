@@ -3,6 +3,7 @@ package repository
 import (
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -23,13 +24,24 @@ func NewHistoryRepository(logger *slog.Logger, db *sqlx.DB) *HistoryRepository {
 	}
 }
 
-func (h *HistoryRepository) GetCoinReceivedHistory(username string) ([]model.Receive, error) {
+// GetCoinReceivedHistory returns the transfers received by the user in the order they were made.
+// A positive limit keeps only that many of the latest ones.
+func (h *HistoryRepository) GetCoinReceivedHistory(username string, limit int) ([]model.Receive, error) {
 	const op = "repository.history.GetCoinReceivedHistory"
 
-	query := fmt.Sprintf(`SELECT sender, amount FROM %s WHERE receiver = $1 ORDER BY created_at`, transactionsTable)
+	query := fmt.Sprintf(
+		`SELECT sender, amount, message, category, wallet
+				FROM (
+				    SELECT id, sender, amount, message, category, COALESCE(wallet, '') AS wallet, created_at
+				    FROM %s
+				    WHERE receiver = $1
+				    ORDER BY created_at DESC, id DESC
+				    LIMIT NULLIF($2, 0)
+				) latest
+				ORDER BY created_at, id`, transactionsTable)
 	var received []model.Receive
 
-	if err := h.db.Select(&received, query, username); err != nil {
+	if err := h.db.Select(&received, query, username, limit); err != nil {
 		return nil, apierror.NewAPIError(apierror.InternalError,
 			errors.Wrapf(err, "%s: (failed get user's received history)", op))
 	}
@@ -37,16 +49,285 @@ func (h *HistoryRepository) GetCoinReceivedHistory(username string) ([]model.Rec
 	return received, nil
 }
 
-func (h *HistoryRepository) GetCoinSentHistory(username string) ([]model.Send, error) {
+// GetCoinSentHistory returns the transfers the user paid in the order they were made, the ones sent
+// from a shared wallet are in its activity. A positive limit keeps only that many of the latest ones.
+func (h *HistoryRepository) GetCoinSentHistory(username string, limit int) ([]model.Send, error) {
 	const op = "repository.history.GetCoinSentHistory"
 
-	query := fmt.Sprintf(`SELECT receiver, amount FROM %s WHERE sender = $1 ORDER BY created_at`, transactionsTable)
+	query := fmt.Sprintf(
+		`SELECT receiver, amount, message, category
+				FROM (
+				    SELECT id, receiver, amount, message, category, created_at
+				    FROM %s
+				    WHERE sender = $1 AND wallet IS NULL
+				    ORDER BY created_at DESC, id DESC
+				    LIMIT NULLIF($2, 0)
+				) latest
+				ORDER BY created_at, id`, transactionsTable)
 	var sent []model.Send
 
-	if err := h.db.Select(&sent, query, username); err != nil {
+	if err := h.db.Select(&sent, query, username, limit); err != nil {
 		return nil, apierror.NewAPIError(apierror.InternalError,
 			errors.Wrapf(err, "%s: (failed get user's sent history)", op))
 	}
 
 	return sent, nil
 }
+
+// historyEntries selects the side of the user $1 of every transfer, sent and received ones, as history
+// entries. Transfers paid from a shared wallet are only in the receiver's history.
+var historyEntries = fmt.Sprintf(
+	`SELECT id, '%[2]s' AS direction, receiver AS counterparty, amount, message, category, '' AS wallet, created_at
+			FROM %[1]s
+			WHERE sender = $1 AND wallet IS NULL
+			UNION ALL
+			SELECT id, '%[3]s' AS direction, sender AS counterparty, amount, message, category,
+			       COALESCE(wallet, '') AS wallet, created_at
+			FROM %[1]s
+			WHERE receiver = $1`, transactionsTable, model.HistoryDirectionSent, model.HistoryDirectionReceived)
+
+// GetHistory returns a page of the user's transfers from the latest one. The page goes on after the cursor
+// of the filter, so it's stable while new transfers are made.
+func (h *HistoryRepository) GetHistory(filter model.HistoryFilter) (model.HistoryPage, error) {
+	const op = "repository.history.GetHistory"
+
+	var conditions []string
+	args := []interface{}{filter.Username}
+	if filter.Direction != "" {
+		args = append(args, filter.Direction)
+		conditions = append(conditions, fmt.Sprintf(`direction = $%d`, len(args)))
+	}
+	if filter.Counterparty != "" {
+		args = append(args, filter.Counterparty)
+		conditions = append(conditions, fmt.Sprintf(`counterparty = $%d`, len(args)))
+	}
+	if filter.MinAmount > 0 {
+		args = append(args, filter.MinAmount)
+		conditions = append(conditions, fmt.Sprintf(`amount >= $%d`, len(args)))
+	}
+	if filter.MaxAmount > 0 {
+		args = append(args, filter.MaxAmount)
+		conditions = append(conditions, fmt.Sprintf(`amount <= $%d`, len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf(`created_at >= $%d`, len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf(`created_at < $%d`, len(args)))
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.CreatedAt, filter.After.ID)
+		conditions = append(conditions, fmt.Sprintf(`(created_at, id) < ($%d, $%d)`, len(args)-1, len(args)))
+	}
+	where := "true"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+
+	// one entry more than the page tells whether there is a next page
+	query := fmt.Sprintf(
+		`SELECT id, direction, counterparty, amount, message, category, wallet, created_at
+				FROM (%s) history
+				WHERE %s
+				ORDER BY created_at DESC, id DESC
+				LIMIT $%d`, historyEntries, where, len(args)+1)
+	page := model.HistoryPage{Entries: make([]model.HistoryEntry, 0, filter.Limit+1)}
+	if err := h.db.Select(&page.Entries, query, append(args, filter.Limit+1)...); err != nil {
+		return model.HistoryPage{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's history)", op))
+	}
+
+	if len(page.Entries) > filter.Limit {
+		page.Entries = page.Entries[:filter.Limit]
+		last := page.Entries[len(page.Entries)-1]
+		page.NextCursor = model.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	return page, nil
+}
+
+// GetCounterpartyHistory sums up the user's transfers per counterparty and direction,
+// the counterparties the user got the most from come first.
+func (h *HistoryRepository) GetCounterpartyHistory(username string) ([]model.CounterpartyHistory, error) {
+	const op = "repository.history.GetCounterpartyHistory"
+
+	query := fmt.Sprintf(
+		`SELECT direction, counterparty, SUM(amount) AS amount, COUNT(*) AS count,
+       				MIN(created_at) AS first_at, MAX(created_at) AS last_at
+				FROM (%s) history
+				GROUP BY direction, counterparty
+				ORDER BY direction, amount DESC, counterparty`, historyEntries)
+	counterparties := make([]model.CounterpartyHistory, 0)
+
+	if err := h.db.Select(&counterparties, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's history per counterparty)", op))
+	}
+
+	return counterparties, nil
+}
+
+// historyExportBatch is how many rows are fetched from the export cursor at once.
+const historyExportBatch = 500
+
+// ExportHistory passes the transfers selected by the filter to emit one by one, in the order they were made.
+// The rows are read through a server-side cursor, so an export of any size doesn't pile up in memory.
+// An error of emit stops the export and is returned.
+func (h *HistoryRepository) ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error {
+	const op = "repository.history.ExportHistory"
+
+	var conditions []string
+	var args []interface{}
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		conditions = append(conditions, fmt.Sprintf(`((sender = $%[1]d AND wallet IS NULL) OR receiver = $%[1]d)`, len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		conditions = append(conditions, fmt.Sprintf(`created_at >= $%d`, len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		conditions = append(conditions, fmt.Sprintf(`created_at < $%d`, len(args)))
+	}
+	where := "true"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+
+	// a cursor lives in a transaction
+	tx, err := h.db.Beginx()
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(h.logger, tx)
+
+	queryDeclare := fmt.Sprintf(
+		`DECLARE history_export NO SCROLL CURSOR FOR
+				SELECT id, created_at, sender, receiver, amount, category, message, COALESCE(wallet, '') AS wallet
+				FROM %s
+				WHERE %s
+				ORDER BY created_at, id`, transactionsTable, where)
+	if _, err := tx.Exec(queryDeclare, args...); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed declare cursor)", op))
+	}
+
+	queryFetch := fmt.Sprintf(`FETCH FORWARD %d FROM history_export`, historyExportBatch)
+	for {
+		rows, err := tx.Queryx(queryFetch)
+		if err != nil {
+			return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed fetch transfers)", op))
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var transfer model.TransferExport
+			if err := rows.StructScan(&transfer); err != nil {
+				rows.Close()
+				return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed scan transfer)", op))
+			}
+			fetched++
+
+			transfer.CreatedAt = transfer.CreatedAt.UTC()
+			if err := emit(transfer); err != nil {
+				rows.Close()
+				return errors.Wrapf(err, "%s: (failed emit transfer)", op)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed fetch transfers)", op))
+		}
+		if fetched < historyExportBatch {
+			break
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return nil
+}
+
+// GetRefundHistory returns the refunds credited to the user, orders paid from a shared wallet are refunded to the wallet.
+func (h *HistoryRepository) GetRefundHistory(username string) ([]model.RefundHistory, error) {
+	const op = "repository.history.GetRefundHistory"
+
+	query := fmt.Sprintf(
+		`SELECT r.order_id, r.amount
+				FROM %s r
+				JOIN %s o ON o.id = r.order_id
+				WHERE r.username = $1 AND o.wallet IS NULL
+				ORDER BY r.created_at`, refundsTable, ordersTable)
+	var refunds []model.RefundHistory
+
+	if err := h.db.Select(&refunds, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's refund history)", op))
+	}
+
+	return refunds, nil
+}
+
+func (h *HistoryRepository) GetGrantHistory(username string) ([]model.GrantHistory, error) {
+	const op = "repository.history.GetGrantHistory"
+
+	query := fmt.Sprintf(
+		`SELECT gi.grant_id, gi.amount, g.reason
+				FROM %s gi
+				JOIN %s g ON g.id = gi.grant_id
+				WHERE gi.username = $1
+				ORDER BY g.created_at`, grantItemsTable, grantsTable)
+	var grants []model.GrantHistory
+
+	if err := h.db.Select(&grants, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's grant history)", op))
+	}
+
+	return grants, nil
+}
+
+// GetApprovalHistory returns the transfers above the approval threshold sent or received by the user, in every state.
+func (h *HistoryRepository) GetApprovalHistory(username string) ([]model.TransferApproval, error) {
+	const op = "repository.history.GetApprovalHistory"
+
+	query := fmt.Sprintf(
+		`SELECT id, sender, receiver, amount, message, category, status, created_at, expires_at, decided_by, decided_at
+				FROM %s
+				WHERE sender = $1 OR receiver = $1
+				ORDER BY created_at, id`, approvalsTable)
+	var approvals []model.TransferApproval
+
+	if err := h.db.Select(&approvals, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's approval history)", op))
+	}
+
+	return approvals, nil
+}
+
+// GetPurchaseHistory returns the purchased lines of the user, the latest first. Lines of
+// cancelled orders are kept, their status shows that they were refunded.
+func (h *HistoryRepository) GetPurchaseHistory(username string, filter model.PurchasesFilter) ([]model.Purchase, error) {
+	const op = "repository.history.GetPurchaseHistory"
+
+	query := fmt.Sprintf(
+		`SELECT oi.order_id, oi.item, oi.quantity, oi.unit_price, oi.quantity * oi.unit_price AS amount,
+       				o.status, oi.created_at
+				FROM %s oi
+				JOIN %s o ON o.id = oi.order_id
+				WHERE o.username = $1
+				ORDER BY oi.created_at DESC, oi.order_id DESC, oi.item
+				LIMIT $2 OFFSET $3`, orderItemsTable, ordersTable)
+	purchases := make([]model.Purchase, 0)
+
+	if err := h.db.Select(&purchases, query, username, filter.Limit, filter.Offset); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user's purchase history)", op))
+	}
+
+	return purchases, nil
+}
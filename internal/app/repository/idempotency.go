@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func (s *ShoppingRepository) GetIdempotencyKey(username, key string) (model.IdempotencyKey, error) {
+	const op = "repository.idempotency.GetIdempotencyKey"
+
+	query := fmt.Sprintf(
+		`SELECT username, key, request_hash, status_code, response, expires_at
+				FROM %s WHERE username = $1 AND key = $2 AND expires_at > now()`, idempotencyTable)
+	var idempotencyKey model.IdempotencyKey
+	if err := s.db.Get(&idempotencyKey, query, username, key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.IdempotencyKey{}, apierror.NewAPIError(apierror.IdempotencyKeyNotFoundError,
+				errors.Wrapf(err, "%s: (failed find idempotency key)", op))
+		}
+		return model.IdempotencyKey{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get idempotency key)", op))
+	}
+
+	return idempotencyKey, nil
+}
+
+// SaveIdempotencyKey stores the response of a request that didn't save its key in its own transaction.
+// A key that is already stored is left as is.
+func (s *ShoppingRepository) SaveIdempotencyKey(key model.IdempotencyKey) error {
+	const op = "repository.idempotency.SaveIdempotencyKey"
+
+	queryCleanUp := fmt.Sprintf(`DELETE FROM %s WHERE expires_at < now()`, idempotencyTable)
+	if _, err := s.db.Exec(queryCleanUp); err != nil {
+		s.logger.Error(fmt.Sprintf("%s: (failed clean up expired idempotency keys): %s", op, err))
+	}
+
+	if _, err := saveIdempotencyKey(s.db, key); err != nil {
+		return errors.Wrapf(err, "%s: (failed save idempotency key)", op)
+	}
+
+	return nil
+}
+
+// claimIdempotencyKey saves the key in the transaction of the request, so the key is stored
+// if and only if the request is committed. A concurrent request with the same key waits
+// for this transaction and then fails to claim the key.
+func claimIdempotencyKey(tx *sqlx.Tx, key *model.IdempotencyKey) error {
+	const op = "repository.idempotency.claimIdempotencyKey"
+
+	if key == nil {
+		return nil
+	}
+
+	saved, err := saveIdempotencyKey(tx, *key)
+	if err != nil {
+		return errors.Wrapf(err, "%s: (failed save idempotency key)", op)
+	}
+	if !saved {
+		return apierror.NewAPIErrorWithMsg(apierror.IdempotencyKeyInProgressError, op+": (failed claim idempotency key)")
+	}
+
+	return nil
+}
+
+// saveIdempotencyKey inserts the key unless an unexpired key with the same name is already stored.
+func saveIdempotencyKey(e sqlx.Execer, key model.IdempotencyKey) (bool, error) {
+	const op = "repository.idempotency.saveIdempotencyKey"
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (username, key, request_hash, status_code, response, expires_at)
+				VALUES ($1, $2, $3, $4, COALESCE($5, ''::BYTEA), $6)
+				ON CONFLICT (username, key) DO UPDATE
+				SET request_hash = EXCLUDED.request_hash,
+				    status_code = EXCLUDED.status_code,
+				    response = EXCLUDED.response,
+				    created_at = now(),
+				    expires_at = EXCLUDED.expires_at
+				WHERE %s.expires_at <= now()`, idempotencyTable, idempotencyTable)
+	res, err := e.Exec(query, key.Username, key.Key, key.RequestHash, key.StatusCode, key.Response, key.ExpiresAt)
+	if err != nil {
+		return false, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save idempotency key)", op))
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save idempotency key)", op))
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+// post writes the posting to the ledger and applies it to users.balance and wallets.balance, which are
+// only cached projections of the user and wallet accounts. Every coin movement must go through post
+// in the transaction that makes it, and the user and wallet rows must already be locked by that transaction.
+func post(tx *sqlx.Tx, posting model.Posting) error {
+	const op = "repository.ledger.post"
+
+	queryAddEntries := fmt.Sprintf(
+		`WITH posting AS (SELECT nextval('%s') AS id)
+				INSERT INTO %s (posting_id, account, amount, kind, reference)
+				SELECT posting.id, entry.account, entry.amount, $4, $5
+				FROM posting, (VALUES ($1::VARCHAR, -$3::INTEGER), ($2::VARCHAR, $3::INTEGER)) AS entry (account, amount)`,
+		ledgerPostingsSequence, ledgerEntriesTable)
+	if _, err := tx.Exec(queryAddEntries,
+		posting.From, posting.To, posting.Amount, posting.Kind, posting.Reference); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save ledger entries)", op))
+	}
+
+	queryUpdateUserBalance := fmt.Sprintf(`UPDATE %s SET balance = balance + $1 WHERE username = $2`, usersTable)
+	queryUpdateWalletBalance := fmt.Sprintf(`UPDATE %s SET balance = balance + $1 WHERE name = $2`, walletsTable)
+	entries := []struct {
+		account string
+		amount  int
+	}{
+		{account: posting.From, amount: -posting.Amount},
+		{account: posting.To, amount: posting.Amount},
+	}
+	for _, entry := range entries {
+		query, owner := "", ""
+		if username, ok := model.AccountUsername(entry.account); ok {
+			query, owner = queryUpdateUserBalance, username
+		} else if wallet, ok := model.AccountWallet(entry.account); ok {
+			query, owner = queryUpdateWalletBalance, wallet
+		} else {
+			continue
+		}
+
+		if _, err := tx.Exec(query, entry.amount, owner); err != nil {
+			return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update balance)", op))
+		}
+	}
+
+	return nil
+}
+
+func orderReference(orderID int64) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+func grantReference(grantID int64) string {
+	return fmt.Sprintf("grant:%d", grantID)
+}
+
+func coinRequestReference(requestID int64) string {
+	return fmt.Sprintf("coin_request:%d", requestID)
+}
+
+func approvalReference(approvalID int64) string {
+	return fmt.Sprintf("approval:%d", approvalID)
+}
+
+func walletActivityReference(activityID int64) string {
+	return fmt.Sprintf("wallet_activity:%d", activityID)
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+// checkTransferLimits must be called after the sender's row is locked, so concurrent transfers
+// of the same sender are checked one after another and can't exceed the limits together.
+// Transfers waiting for approval count towards the limits as well.
+func checkTransferLimits(tx *sqlx.Tx, fromUsername string, send model.Send, limits model.TransferLimits) error {
+	const op = "repository.limits.checkTransferLimits"
+
+	var usage model.TransferUsage
+	if limits.DailyAmount > 0 || limits.DailyCount > 0 || limits.DailyRecipients > 0 {
+		query := fmt.Sprintf(
+			`SELECT COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count, COUNT(DISTINCT receiver) AS recipients,
+				       COALESCE(BOOL_OR(receiver = $2), false) AS sent_to_receiver
+				FROM (
+				    SELECT receiver, amount FROM %s
+				    WHERE sender = $1 AND created_at > now() - INTERVAL '24 hours'
+				    UNION ALL
+				    SELECT receiver, amount FROM %s
+				    WHERE sender = $1 AND status = $3 AND created_at > now() - INTERVAL '24 hours'
+				) AS sent`, transactionsTable, approvalsTable)
+		if err := tx.Get(&usage, query, fromUsername, send.ToUser, model.ApprovalStatusPending); err != nil {
+			return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get transfer usage)", op))
+		}
+	}
+
+	if details := exceededTransferLimit(limits, usage, send); details != nil {
+		return apierror.NewAPIErrorWithDetails(apierror.TransferLimitExceededError,
+			fmt.Sprintf("%s: (failed check limits): %s limit exceeded", op, details.Limit), *details)
+	}
+
+	return nil
+}
+
+// exceededTransferLimit returns the first limit the transfer would exceed, or nil if it fits into all of them.
+func exceededTransferLimit(limits model.TransferLimits, usage model.TransferUsage, send model.Send) *model.TransferLimitDetails {
+	switch {
+	case limits.MaxAmount > 0 && send.Amount > limits.MaxAmount:
+		return &model.TransferLimitDetails{
+			Limit: model.TransferLimitAmount, Max: limits.MaxAmount, Remaining: limits.MaxAmount}
+	case limits.DailyAmount > 0 && usage.Amount+send.Amount > limits.DailyAmount:
+		return &model.TransferLimitDetails{
+			Limit: model.TransferLimitDailyAmount, Max: limits.DailyAmount, Remaining: max(limits.DailyAmount-usage.Amount, 0)}
+	case limits.DailyCount > 0 && usage.Count >= limits.DailyCount:
+		return &model.TransferLimitDetails{
+			Limit: model.TransferLimitDailyCount, Max: limits.DailyCount, Remaining: 0}
+	case limits.DailyRecipients > 0 && !usage.SentToReceiver && usage.Recipients >= limits.DailyRecipients:
+		return &model.TransferLimitDetails{
+			Limit: model.TransferLimitDailyRecipients, Max: limits.DailyRecipients, Remaining: 0}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func TestExceededTransferLimit(t *testing.T) {
+	limits := model.TransferLimits{MaxAmount: 500, DailyAmount: 1000, DailyCount: 5, DailyRecipients: 3}
+
+	tests := []struct {
+		name   string
+		limits model.TransferLimits
+		usage  model.TransferUsage
+		send   model.Send
+		want   *model.TransferLimitDetails
+	}{
+		{
+			name:   "no limits",
+			limits: model.TransferLimits{},
+			usage:  model.TransferUsage{Amount: 100000, Count: 100, Recipients: 100},
+			send:   model.Send{ToUser: "user2", Amount: 100000},
+		},
+		{
+			name:   "within limits",
+			limits: limits,
+			usage:  model.TransferUsage{Amount: 500, Count: 4, Recipients: 2},
+			send:   model.Send{ToUser: "user2", Amount: 500},
+		},
+		{
+			name:   "single transfer too large",
+			limits: limits,
+			send:   model.Send{ToUser: "user2", Amount: 501},
+			want:   &model.TransferLimitDetails{Limit: model.TransferLimitAmount, Max: 500, Remaining: 500},
+		},
+		{
+			name:   "daily amount",
+			limits: limits,
+			usage:  model.TransferUsage{Amount: 800, Count: 2, Recipients: 1},
+			send:   model.Send{ToUser: "user2", Amount: 300},
+			want:   &model.TransferLimitDetails{Limit: model.TransferLimitDailyAmount, Max: 1000, Remaining: 200},
+		},
+		{
+			name:   "daily count",
+			limits: limits,
+			usage:  model.TransferUsage{Amount: 50, Count: 5, Recipients: 1, SentToReceiver: true},
+			send:   model.Send{ToUser: "user2", Amount: 10},
+			want:   &model.TransferLimitDetails{Limit: model.TransferLimitDailyCount, Max: 5, Remaining: 0},
+		},
+		{
+			name:   "new recipient over the limit",
+			limits: limits,
+			usage:  model.TransferUsage{Amount: 50, Count: 3, Recipients: 3},
+			send:   model.Send{ToUser: "user5", Amount: 10},
+			want:   &model.TransferLimitDetails{Limit: model.TransferLimitDailyRecipients, Max: 3, Remaining: 0},
+		},
+		{
+			name:   "known recipient doesn't count twice",
+			limits: limits,
+			usage:  model.TransferUsage{Amount: 50, Count: 3, Recipients: 3, SentToReceiver: true},
+			send:   model.Send{ToUser: "user2", Amount: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exceededTransferLimit(tt.limits, tt.usage, tt.send))
+		})
+	}
+}
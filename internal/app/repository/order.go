@@ -0,0 +1,274 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const orderColumns = `id, username, status, total, created_at, paid_at, ready_at, delivered_at, cancelled_at, wallet`
+
+// orderStatusTimeColumns maps a status to the column that records when the order got it.
+var orderStatusTimeColumns = map[string]string{
+	model.OrderStatusPaid:           "paid_at",
+	model.OrderStatusReadyForPickup: "ready_at",
+	model.OrderStatusDelivered:      "delivered_at",
+	model.OrderStatusCancelled:      "cancelled_at",
+}
+
+type OrderRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewOrderRepository(logger *slog.Logger, db *sqlx.DB) *OrderRepository {
+	return &OrderRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (o *OrderRepository) GetOrders(filter model.OrdersFilter) ([]model.Order, error) {
+	const op = "repository.order.GetOrders"
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if filter.Username != "" {
+		args = append(args, filter.Username)
+		conditions = append(conditions, fmt.Sprintf(`username = $%d`, len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf(`status = $%d`, len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s %s ORDER BY id DESC LIMIT $%d OFFSET $%d`,
+		orderColumns, ordersTable, where, len(args)+1, len(args)+2)
+	orders := make([]model.Order, 0)
+	if err := o.db.Select(&orders, query, append(args, filter.Limit, filter.Offset)...); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get orders)", op))
+	}
+
+	if err := getOrderLines(o.db, orders); err != nil {
+		return nil, errors.Wrapf(err, "%s: (failed get order lines)", op)
+	}
+
+	return orders, nil
+}
+
+func (o *OrderRepository) GetOrder(id int64) (model.Order, error) {
+	const op = "repository.order.GetOrder"
+
+	order, err := getOrder(o.db, id, false)
+	if err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed get order)", op)
+	}
+
+	return order, nil
+}
+
+// UpdateOrderStatus moves the order to the given status if model.OrderStatusTransitions allows it.
+func (o *OrderRepository) UpdateOrderStatus(id int64, status string) (model.Order, error) {
+	const op = "repository.order.UpdateOrderStatus"
+
+	tx, err := o.db.Beginx()
+	if err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(o.logger, tx)
+
+	order, err := getOrder(tx, id, true)
+	if err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed get order)", op)
+	}
+
+	if !slices.Contains(model.OrderStatusTransitions[order.Status], status) {
+		return model.Order{}, apierror.NewAPIErrorWithMsg(apierror.OrderStatusTransitionError,
+			fmt.Sprintf("%s: (failed update status): can't move order from %s to %s", op, order.Status, status))
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET status = $1, %s = now() WHERE id = $2 RETURNING %s`,
+		ordersTable, orderStatusTimeColumns[status], orderColumns)
+	items := order.Items
+	if err := tx.Get(&order, query, status, id); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed update status)", op))
+	}
+	order.Items = items
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return order, nil
+}
+
+// RefundOrder cancels a paid order, puts its items back in stock and credits the price paid back to the buyer,
+// or to the wallet the order was paid from. The idempotency key, if any, is saved in the same transaction.
+func (o *OrderRepository) RefundOrder(request model.RefundRequest, key *model.IdempotencyKey) (model.Refund, error) {
+	const op = "repository.order.RefundOrder"
+
+	tx, err := o.db.Beginx()
+	if err != nil {
+		return model.Refund{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(o.logger, tx)
+
+	order, err := getOrder(tx, request.OrderID, true)
+	if err != nil {
+		return model.Refund{}, errors.Wrapf(err, "%s: (failed get order)", op)
+	}
+
+	switch {
+	case request.Owner != "" && order.Username != request.Owner:
+		return model.Refund{}, apierror.NewAPIErrorWithMsg(apierror.OrderNotFoundError,
+			op+": (failed refund order): order belongs to another user")
+	case order.Status == model.OrderStatusDelivered && !request.AllowDelivered,
+		order.Status != model.OrderStatusPaid && order.Status != model.OrderStatusReadyForPickup &&
+			order.Status != model.OrderStatusDelivered:
+		return model.Refund{}, apierror.NewAPIErrorWithMsg(apierror.OrderNotRefundableError,
+			fmt.Sprintf("%s: (failed refund order): order is %s", op, order.Status))
+	case order.PaidAt == nil || order.PaidAt.Before(request.PaidAfter):
+		return model.Refund{}, apierror.NewAPIErrorWithMsg(apierror.RefundPeriodExpiredError,
+			op+": (failed refund order): order was paid too long ago")
+	}
+
+	queryCancel := fmt.Sprintf(`UPDATE %s SET status = $1, cancelled_at = now() WHERE id = $2`, ordersTable)
+	if _, err := tx.Exec(queryCancel, model.OrderStatusCancelled, order.ID); err != nil {
+		return model.Refund{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed cancel order)", op))
+	}
+
+	// items are locked before the user, in the same order as buying does
+	queryRestock := fmt.Sprintf(`UPDATE %s SET stock = stock + $1 WHERE type = $2 AND stock IS NOT NULL`, itemsTable)
+	for _, line := range order.Items {
+		if _, err := tx.Exec(queryRestock, line.Quantity, line.Type); err != nil {
+			return model.Refund{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed restock item)", op))
+		}
+	}
+
+	// an order paid from a shared wallet is refunded to the wallet
+	to := model.UserAccount(order.Username)
+	if order.Wallet != nil {
+		to = model.WalletAccount(*order.Wallet)
+	}
+	if err := post(tx, model.Posting{
+		From:      model.LedgerAccountShop,
+		To:        to,
+		Amount:    order.Total,
+		Kind:      model.LedgerKindRefund,
+		Reference: orderReference(order.ID),
+	}); err != nil {
+		return model.Refund{}, errors.Wrapf(err, "%s: (failed credit coins)", op)
+	}
+
+	if order.Wallet != nil {
+		if _, err := addWalletActivity(tx, *order.Wallet, model.WalletActivity{
+			Username:  order.Username,
+			Kind:      model.WalletActivityRefund,
+			Amount:    order.Total,
+			Reference: orderReference(order.ID),
+		}); err != nil {
+			return model.Refund{}, errors.Wrapf(err, "%s: (failed credit coins)", op)
+		}
+	}
+
+	queryAddRefund := fmt.Sprintf(
+		`INSERT INTO %s (order_id, username, amount, reason, refunded_by) VALUES ($1, $2, $3, $4, $5)
+				RETURNING id, order_id, username, amount, reason, refunded_by, created_at`, refundsTable)
+	var refund model.Refund
+	if err := tx.Get(&refund, queryAddRefund,
+		order.ID, order.Username, order.Total, request.Reason, request.RefundedBy); err != nil {
+		return model.Refund{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save refund)", op))
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(refund); err != nil {
+			return model.Refund{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal refund)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.Refund{}, errors.Wrapf(err, "%s: (failed refund order)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Refund{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return refund, nil
+}
+
+// getOrder reads the order with its lines, forUpdate locks the order row until the end of the transaction.
+func getOrder(q sqlx.Queryer, id int64, forUpdate bool) (model.Order, error) {
+	const op = "repository.order.getOrder"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1`, orderColumns, ordersTable)
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var order model.Order
+	if err := sqlx.Get(q, &order, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Order{}, apierror.NewAPIError(apierror.OrderNotFoundError, errors.Wrapf(err, "%s: (failed find order)", op))
+		}
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get order)", op))
+	}
+
+	orders := []model.Order{order}
+	if err := getOrderLines(q, orders); err != nil {
+		return model.Order{}, err
+	}
+
+	return orders[0], nil
+}
+
+// getOrderLines fills in the lines of the orders with a single query.
+func getOrderLines(q sqlx.Queryer, orders []model.Order) error {
+	const op = "repository.order.getOrderLines"
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT order_id, item, quantity, unit_price, quantity * unit_price AS amount
+				FROM %s WHERE order_id = ANY($1) ORDER BY order_id, item`, orderItemsTable)
+	var lines []struct {
+		OrderID int64 `db:"order_id"`
+		model.OrderLineOutput
+	}
+	if err := sqlx.Select(q, &lines, query, pq.Array(ids)); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get order lines)", op))
+	}
+
+	linesByOrder := make(map[int64][]model.OrderLineOutput, len(orders))
+	for _, line := range lines {
+		linesByOrder[line.OrderID] = append(linesByOrder[line.OrderID], line.OrderLineOutput)
+	}
+	for i := range orders {
+		orders[i].Items = linesByOrder[orders[i].ID]
+	}
+
+	return nil
+}
@@ -1,18 +1,62 @@
 package repository
 
 import (
+	"database/sql"
 	"fmt"
+	"log/slog"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 )
 
 const (
-	usersTable        = "users"
-	itemsTable        = "items"
-	transactionsTable = "transactions"
-	purchasesTable    = "purchases"
+	usersTable          = "users"
+	itemsTable          = "items"
+	transactionsTable   = "transactions"
+	purchasesTable      = "purchases"
+	ordersTable         = "orders"
+	orderItemsTable     = "order_items"
+	refundsTable        = "refunds"
+	idempotencyTable    = "idempotency_keys"
+	ledgerEntriesTable  = "ledger_entries"
+	grantsTable         = "coin_grants"
+	grantItemsTable     = "coin_grant_items"
+	approvalsTable      = "transfer_approvals"
+	coinRequestsTable   = "coin_requests"
+	schedulesTable      = "scheduled_transfers"
+	walletsTable        = "wallets"
+	walletMembersTable  = "wallet_members"
+	walletActivityTable = "wallet_activity"
+	refreshTokensTable  = "refresh_tokens"
+	revokedTokensTable  = "revoked_tokens"
+
+	ledgerPostingsSequence = "ledger_postings_seq"
+)
+
+const (
+	uniqueViolationCode     = "23505"
+	foreignKeyViolationCode = "23503"
 )
 
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolationCode
+}
+
+// rollback is meant to be deferred right after a transaction begins,
+// so it ignores transactions that have already been committed.
+func rollback(logger *slog.Logger, tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Error("error while rollback: " + err.Error())
+	}
+}
+
 type Config struct {
 	Host     string
 	Port     string
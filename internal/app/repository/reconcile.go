@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type ReconcileRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewReconcileRepository(logger *slog.Logger, db *sqlx.DB) *ReconcileRepository {
+	return &ReconcileRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// GetLedgerSnapshot reads the balances and the ledger in one read-only repeatable read transaction,
+// so money moving while the checks run can't show up as a discrepancy.
+func (r *ReconcileRepository) GetLedgerSnapshot(ctx context.Context) (model.LedgerSnapshot, error) {
+	const op = "repository.reconcile.GetLedgerSnapshot"
+
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return model.LedgerSnapshot{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(r.logger, tx)
+
+	var snapshot model.LedgerSnapshot
+
+	queryBalances := fmt.Sprintf(
+		`SELECT u.username, COALESCE(u.balance, 0) AS balance,
+				       COALESCE((SELECT SUM(amount) FROM %[2]s WHERE account = 'user:' || u.username), 0) AS ledger_balance,
+				       COALESCE((SELECT SUM(amount) FROM %[2]s
+				                 WHERE account = 'user:' || u.username AND kind = $1), 0)
+				           + COALESCE((SELECT SUM(amount) FROM %[3]s WHERE receiver = u.username), 0)
+				           - COALESCE((SELECT SUM(amount) FROM %[3]s WHERE sender = u.username AND wallet IS NULL), 0)
+				           - COALESCE((SELECT SUM(total) FROM %[4]s
+				                       WHERE username = u.username AND paid_at IS NOT NULL AND wallet IS NULL), 0)
+				           + COALESCE((SELECT SUM(r.amount) FROM %[5]s r JOIN %[4]s o ON o.id = r.order_id
+				                       WHERE r.username = u.username AND o.wallet IS NULL), 0)
+				           + COALESCE((SELECT SUM(amount) FROM %[6]s WHERE username = u.username), 0)
+				           - COALESCE((SELECT SUM(amount) FROM %[7]s WHERE sender = u.username AND status = $2), 0)
+				           - COALESCE((SELECT SUM(amount) FROM %[8]s WHERE username = u.username AND kind = $3), 0)
+				               AS expected_balance
+				FROM %[1]s u
+				ORDER BY u.username`,
+		usersTable, ledgerEntriesTable, transactionsTable, ordersTable, refundsTable, grantItemsTable, approvalsTable,
+		walletActivityTable)
+	if err := tx.SelectContext(ctx, &snapshot.Balances, queryBalances,
+		model.LedgerKindStartGrant, model.ApprovalStatusPending, model.WalletActivityContribution); err != nil {
+		return model.LedgerSnapshot{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get balances)", op))
+	}
+
+	queryWalletBalances := fmt.Sprintf(
+		`SELECT w.name AS wallet, w.balance,
+				       COALESCE((SELECT SUM(amount) FROM %[2]s WHERE account = 'wallet:' || w.name), 0) AS ledger_balance,
+				       COALESCE((SELECT SUM(amount) FROM %[3]s WHERE wallet = w.name), 0) AS expected_balance
+				FROM %[1]s w
+				ORDER BY w.name`, walletsTable, ledgerEntriesTable, walletActivityTable)
+	if err := tx.SelectContext(ctx, &snapshot.WalletBalances, queryWalletBalances); err != nil {
+		return model.LedgerSnapshot{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get wallet balances)", op))
+	}
+
+	queryUnbalanced := fmt.Sprintf(
+		`SELECT posting_id FROM %s GROUP BY posting_id HAVING SUM(amount) <> 0 ORDER BY posting_id`, ledgerEntriesTable)
+	if err := tx.SelectContext(ctx, &snapshot.UnbalancedPostings, queryUnbalanced); err != nil {
+		return model.LedgerSnapshot{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get unbalanced postings)", op))
+	}
+
+	queryConservation := fmt.Sprintf(
+		`SELECT COALESCE(-SUM(amount) FILTER (WHERE account = $1), 0) AS issued,
+				       COALESCE(SUM(amount) FILTER (WHERE account = $2), 0) AS shop_balance,
+				       COALESCE(SUM(amount) FILTER (WHERE account = $3), 0) AS escrow_balance,
+				       (SELECT COALESCE(SUM(balance), 0) FROM %s) AS users_balance,
+				       (SELECT COALESCE(SUM(balance), 0) FROM %s) AS wallets_balance
+				FROM %s`, usersTable, walletsTable, ledgerEntriesTable)
+	if err := tx.GetContext(ctx, &snapshot.Conservation, queryConservation,
+		model.LedgerAccountIssuance, model.LedgerAccountShop, model.LedgerAccountEscrow); err != nil {
+		return model.LedgerSnapshot{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get coin totals)", op))
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const scheduleColumns = `id, sender, receiver, amount, message, category, cron, status, next_run_at, last_run_at,
+				last_error, runs, created_at`
+
+type ScheduleRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewScheduleRepository(logger *slog.Logger, db *sqlx.DB) *ScheduleRepository {
+	return &ScheduleRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (s *ScheduleRepository) CreateScheduledTransfer(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	const op = "repository.schedule.CreateScheduledTransfer"
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (sender, receiver, amount, message, category, cron, next_run_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)
+				RETURNING %s`, schedulesTable, scheduleColumns)
+	var created model.ScheduledTransfer
+	if err := s.db.Get(&created, query, schedule.FromUser, schedule.ToUser, schedule.Amount,
+		schedule.Message, schedule.Category, schedule.Cron, schedule.NextRunAt); err != nil {
+		if isForeignKeyViolation(err) {
+			return model.ScheduledTransfer{}, apierror.NewAPIError(apierror.NoSuchUserError,
+				errors.Wrapf(err, "%s: (failed save scheduled transfer): receiver not found", op))
+		}
+		return model.ScheduledTransfer{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save scheduled transfer)", op))
+	}
+
+	return created, nil
+}
+
+func (s *ScheduleRepository) GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error) {
+	const op = "repository.schedule.GetScheduledTransfers"
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE sender = $1 ORDER BY created_at DESC, id DESC`,
+		scheduleColumns, schedulesTable)
+	schedules := make([]model.ScheduledTransfer, 0)
+	if err := s.db.Select(&schedules, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get scheduled transfers)", op))
+	}
+
+	return schedules, nil
+}
+
+// CancelScheduledTransfer stops an active schedule of the sender. A run that is already claimed still completes.
+func (s *ScheduleRepository) CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error) {
+	const op = "repository.schedule.CancelScheduledTransfer"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET status = $1, next_run_at = NULL
+				WHERE id = $2 AND sender = $3 AND status = $4
+				RETURNING %s`, schedulesTable, scheduleColumns)
+	var schedule model.ScheduledTransfer
+	err := s.db.Get(&schedule, query, model.ScheduleStatusCancelled, id, username, model.ScheduleStatusActive)
+	if err == nil {
+		return schedule, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return model.ScheduledTransfer{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed cancel scheduled transfer)", op))
+	}
+
+	queryExists := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND sender = $2)`, schedulesTable)
+	var exists bool
+	if err := s.db.Get(&exists, queryExists, id, username); err != nil {
+		return model.ScheduledTransfer{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get scheduled transfer)", op))
+	}
+	if !exists {
+		return model.ScheduledTransfer{}, apierror.NewAPIErrorWithMsg(apierror.ScheduledTransferNotFoundError,
+			op+": (failed find scheduled transfer)")
+	}
+
+	return model.ScheduledTransfer{}, apierror.NewAPIErrorWithMsg(apierror.ScheduledTransferNotActiveError,
+		op+": (failed cancel scheduled transfer): schedule is completed or cancelled")
+}
+
+// ClaimDueScheduledTransfers takes up to limit due schedules and moves them to their next run, which next
+// returns (nil completes the schedule), before any of them is executed. Once the claim is committed no other
+// replica can take the same run, so a run is executed at most once: if the process dies before executing it,
+// the run is skipped rather than repeated. Schedules claimed by a concurrent replica are skipped.
+func (s *ScheduleRepository) ClaimDueScheduledTransfers(limit int,
+	next func(model.ScheduledTransfer) *time.Time) ([]model.ScheduledTransfer, error) {
+	const op = "repository.schedule.ClaimDueScheduledTransfers"
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(s.logger, tx)
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s
+				WHERE status = $1 AND next_run_at <= now()
+				ORDER BY next_run_at, id
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED`, scheduleColumns, schedulesTable)
+	var schedules []model.ScheduledTransfer
+	if err := tx.Select(&schedules, query, model.ScheduleStatusActive, limit); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get due schedules)", op))
+	}
+
+	queryAdvance := fmt.Sprintf(
+		`UPDATE %s SET next_run_at = $1, status = CASE WHEN $1::TIMESTAMPTZ IS NULL THEN $2 ELSE status END
+				WHERE id = $3`, schedulesTable)
+	for _, schedule := range schedules {
+		if _, err := tx.Exec(queryAdvance, next(schedule), model.ScheduleStatusCompleted, schedule.ID); err != nil {
+			return nil, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed advance schedule)", op))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return schedules, nil
+}
+
+// FinishScheduledTransferRun records the outcome of a claimed run, an empty runErr means it succeeded.
+func (s *ScheduleRepository) FinishScheduledTransferRun(id int64, runErr string) error {
+	const op = "repository.schedule.FinishScheduledTransferRun"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET last_run_at = now(), last_error = NULLIF($1, ''), runs = runs + 1 WHERE id = $2`, schedulesTable)
+	if _, err := s.db.Exec(query, runErr, id); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save run)", op))
+	}
+
+	return nil
+}
@@ -1,11 +1,12 @@
 package repository
 
 import (
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 
 	"github.com/nosikmy/avito-shop/internal/app/apierror"
@@ -24,18 +25,61 @@ func NewShoppingRepository(logger *slog.Logger, db *sqlx.DB) *ShoppingRepository
 	}
 }
 
-func (s *ShoppingRepository) SendCoin(fromUsername, toUsername string, amount int) error {
+// SendCoin moves coins between users if the transfer fits into the sender's limits.
+// The idempotency key, if any, is saved in the same transaction.
+func (s *ShoppingRepository) SendCoin(fromUsername string, send model.Send, limits model.TransferLimits,
+	key *model.IdempotencyKey) error {
 	const op = "repository.shopping.SendCoin"
 
 	tx, err := s.db.Beginx()
 	if err != nil {
 		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			s.logger.Error("error while rollback: " + err.Error())
-		}
-	}()
+	defer rollback(s.logger, tx)
+
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	if err := prepareTransfer(tx, fromUsername, send, limits); err != nil {
+		return errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	if err := transfer(tx, fromUsername, send, ""); err != nil {
+		return errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return nil
+}
+
+// transfer moves the coins prepared by prepareTransfer and records the transfer in the coin history.
+func transfer(tx *sqlx.Tx, fromUsername string, send model.Send, reference string) error {
+	const op = "repository.shopping.transfer"
+
+	if err := post(tx, model.Posting{
+		From:      model.UserAccount(fromUsername),
+		To:        model.UserAccount(send.ToUser),
+		Amount:    send.Amount,
+		Kind:      model.LedgerKindTransfer,
+		Reference: reference,
+	}); err != nil {
+		return errors.Wrapf(err, "%s: (failed send money)", op)
+	}
+
+	if err := saveTransaction(tx, fromUsername, send); err != nil {
+		return errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	return nil
+}
+
+// prepareTransfer locks both users and checks that the sender can afford the transfer within the limits.
+func prepareTransfer(tx *sqlx.Tx, fromUsername string, send model.Send, limits model.TransferLimits) error {
+	const op = "repository.shopping.prepareTransfer"
 
 	querySelectForUpdate := fmt.Sprintf(
 		`WITH locked_users AS (
@@ -48,29 +92,53 @@ func (s *ShoppingRepository) SendCoin(fromUsername, toUsername string, amount in
 				WHERE username = $3`, usersTable)
 
 	var user model.User
-	if err := tx.Get(&user, querySelectForUpdate, fromUsername, toUsername, fromUsername); err != nil {
+	if err := tx.Get(&user, querySelectForUpdate, fromUsername, send.ToUser, fromUsername); err != nil {
 		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get user)", op))
 	}
 
-	if user.Balance < amount {
+	if user.Balance < send.Amount {
 		return apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, op+": (failed get user): not enough money")
 	}
 
-	querySend := fmt.Sprintf(`UPDATE %s SET balance = balance - $1 WHERE username = $2`, usersTable)
-	if _, err := tx.Exec(querySend, amount, fromUsername); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed send money)", op))
+	if err := checkTransferLimits(tx, fromUsername, send, limits); err != nil {
+		return errors.Wrapf(err, "%s: (failed check limits)", op)
 	}
 
-	queryReceive := fmt.Sprintf(`UPDATE %s SET balance = balance + $1 WHERE username = $2`, usersTable)
-	if _, err := tx.Exec(queryReceive, amount, toUsername); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed receive money)", op))
-	}
+	return nil
+}
+
+// saveTransaction records the transfer in the coin history.
+func saveTransaction(tx *sqlx.Tx, fromUsername string, send model.Send) error {
+	const op = "repository.shopping.saveTransaction"
 
-	queryAddTransaction := fmt.Sprintf(`INSERT INTO %s VALUES ($1, $2, $3)`, transactionsTable)
-	if _, err := tx.Exec(queryAddTransaction, fromUsername, toUsername, amount); err != nil {
+	queryAddTransaction := fmt.Sprintf(
+		`INSERT INTO %s (sender, receiver, amount, message, category) VALUES ($1, $2, $3, $4, $5)`, transactionsTable)
+	if _, err := tx.Exec(queryAddTransaction,
+		fromUsername, send.ToUser, send.Amount, send.Message, send.Category); err != nil {
 		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save transaction)", op))
 	}
 
+	return nil
+}
+
+// Buy buys quantity units of the item. The idempotency key, if any, is saved in the same transaction.
+func (s *ShoppingRepository) Buy(username, item string, quantity int, key *model.IdempotencyKey) error {
+	const op = "repository.shopping.Buy"
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(s.logger, tx)
+
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return errors.Wrapf(err, "%s: (failed buy item)", op)
+	}
+
+	if _, err := buyItems(s.logger, tx, username, "", []model.OrderLine{{Type: item, Quantity: quantity}}); err != nil {
+		return errors.Wrapf(err, "%s: (failed buy item)", op)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
 	}
@@ -78,54 +146,211 @@ func (s *ShoppingRepository) SendCoin(fromUsername, toUsername string, amount in
 	return nil
 }
 
-func (s *ShoppingRepository) Buy(username, item string) error {
-	const op = "repository.shopping.Buy"
+// Checkout buys all the lines of the order in one transaction, so either every line is bought or none.
+// The idempotency key, if any, is saved in the same transaction.
+func (s *ShoppingRepository) Checkout(username string, lines []model.OrderLine,
+	key *model.IdempotencyKey) (model.Order, error) {
+	const op = "repository.shopping.Checkout"
 
 	tx, err := s.db.Beginx()
 	if err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(s.logger, tx)
+
+	order, err := buyItems(s.logger, tx, username, "", lines)
+	if err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed checkout)", op)
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(order); err != nil {
+			return model.Order{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal order)", op))
+		}
 	}
-	defer func() {
-		if err := tx.Rollback(); err != nil {
-			s.logger.Error("error while rollback: " + err.Error())
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed checkout)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return order, nil
+}
+
+// buyItems prices the lines, charges the user, takes the items from the stock and saves them as a paid order.
+// If the wallet is set, the user must be its owner and the order is paid from the wallet instead.
+// Every line that can't be bought is reported in the details of the returned error.
+func buyItems(logger *slog.Logger, tx *sqlx.Tx, username, wallet string, lines []model.OrderLine) (model.Order, error) {
+	const op = "repository.shopping.buyItems"
+
+	types := make([]string, 0, len(lines))
+	for _, line := range lines {
+		types = append(types, line.Type)
+	}
+
+	// the items with a limited stock are locked for update and the rest for share, so unlimited items
+	// don't serialize orders. Every buyer locks the rows in the same order, so orders can't deadlock on them
+	queryLockLimitedItems := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE type = ANY($1) AND stock IS NOT NULL ORDER BY type FOR UPDATE`,
+		catalogItemColumns, itemsTable)
+	var limitedItems []model.CatalogItem
+	if err := tx.Select(&limitedItems, queryLockLimitedItems, pq.Array(types)); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get items)", op))
+	}
+
+	limitedTypes := make([]string, 0, len(limitedItems))
+	for _, item := range limitedItems {
+		limitedTypes = append(limitedTypes, item.Type)
+	}
+
+	queryLockItems := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE type = ANY($1) AND NOT type = ANY($2) ORDER BY type FOR SHARE`,
+		catalogItemColumns, itemsTable)
+	var catalogItems []model.CatalogItem
+	if err := tx.Select(&catalogItems, queryLockItems, pq.Array(types), pq.Array(limitedTypes)); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get items)", op))
+	}
+
+	itemsByType := make(map[string]model.CatalogItem, len(limitedItems)+len(catalogItems))
+	for _, item := range append(limitedItems, catalogItems...) {
+		itemsByType[item.Type] = item
+	}
+
+	var (
+		order      = model.Order{Items: make([]model.OrderLineOutput, 0, len(lines))}
+		lineErrors []model.OrderLineError
+		// the most severe of the line errors becomes the error of the order
+		orderErr     apierror.APIError
+		orderErrRank int
+	)
+	addLineError := func(i int, line model.OrderLine, apiErr apierror.APIError, rank int) {
+		lineErrors = append(lineErrors, model.OrderLineError{
+			Line: i, Type: line.Type, Quantity: line.Quantity, Error: apiErr.Message})
+		if rank > orderErrRank {
+			orderErr, orderErrRank = apiErr, rank
+		}
+	}
+	for i, line := range lines {
+		item, ok := itemsByType[line.Type]
+		switch {
+		case !ok:
+			addLineError(i, line, apierror.InvalidItemError, 3)
+		case !item.Active:
+			addLineError(i, line, apierror.ItemArchivedError, 2)
+		case item.Stock != nil && *item.Stock < line.Quantity:
+			addLineError(i, line, apierror.OutOfStockError, 1)
+		default:
+			amount := item.Price * line.Quantity
+			order.Items = append(order.Items, model.OrderLineOutput{
+				Type: line.Type, Quantity: line.Quantity, UnitPrice: item.Price, Amount: amount})
+			order.Total += amount
 		}
-	}()
+	}
+
+	if len(lineErrors) > 0 {
+		return model.Order{}, apierror.NewAPIErrorWithDetails(orderErr, op+": (failed price items): some items can't be bought",
+			model.OrderErrorDetails{Lines: lineErrors})
+	}
 
-	queryGetItemPrice := fmt.Sprintf(`SELECT price FROM %s WHERE type = $1 FOR SHARE`, itemsTable)
-	var itemPrice int
-	if err := tx.Get(&itemPrice, queryGetItemPrice, item); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return apierror.NewAPIError(apierror.InvalidItemError, errors.Wrapf(err, "%s: (failed find item)", op))
+	payer, balance, err := lockPayer(tx, username, wallet)
+	if err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed get payer)", op)
+	}
+
+	if balance < order.Total {
+		// the lines are paid in the requested order, the ones that don't fit into the balance are reported
+		spent := 0
+		for i, line := range order.Items {
+			spent += line.Amount
+			if spent > balance {
+				lineErrors = append(lineErrors, model.OrderLineError{
+					Line: i, Type: line.Type, Quantity: line.Quantity, Error: apierror.NotEnoughMoneyError.Message})
+			}
 		}
+		return model.Order{}, apierror.NewAPIErrorWithDetails(apierror.NotEnoughMoneyError,
+			op+": (failed get payer): not enough money",
+			model.OrderErrorDetails{Lines: lineErrors, Total: order.Total, Balance: balance})
+	}
 
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get item)", op))
+	// the coins are taken right away, so the order starts its life already paid
+	queryAddOrder := fmt.Sprintf(
+		`INSERT INTO %s (username, status, total, paid_at, wallet) VALUES ($1, $2, $3, now(), NULLIF($4, '')) RETURNING %s`,
+		ordersTable, orderColumns)
+	items := order.Items
+	if err := tx.Get(&order, queryAddOrder, username, model.OrderStatusPaid, order.Total, wallet); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save order)", op))
 	}
+	order.Items = items
 
-	querySelectForUpdate := fmt.Sprintf(`SELECT username, balance FROM %s WHERE username = $1 FOR UPDATE`, usersTable)
-	var user model.User
-	if err = tx.Get(&user, querySelectForUpdate, username); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get user)", op))
+	if err := post(tx, model.Posting{
+		From:      payer,
+		To:        model.LedgerAccountShop,
+		Amount:    order.Total,
+		Kind:      model.LedgerKindPurchase,
+		Reference: orderReference(order.ID),
+	}); err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed buy items)", op)
 	}
 
-	if user.Balance < itemPrice {
-		return apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, op+": (failed get user): not enough money")
+	if wallet != "" {
+		if _, err := addWalletActivity(tx, wallet, model.WalletActivity{
+			Username:  username,
+			Kind:      model.WalletActivityPurchase,
+			Amount:    -order.Total,
+			Reference: orderReference(order.ID),
+		}); err != nil {
+			return model.Order{}, errors.Wrapf(err, "%s: (failed buy items)", op)
+		}
+	}
+
+	queryAddOrderItem := fmt.Sprintf(`INSERT INTO %s (order_id, item, quantity, unit_price) VALUES ($1, $2, $3, $4)`,
+		orderItemsTable)
+	for _, line := range order.Items {
+		if _, err := tx.Exec(queryAddOrderItem, order.ID, line.Type, line.Quantity, line.UnitPrice); err != nil {
+			return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save order item)", op))
+		}
 	}
 
-	queryBuy := fmt.Sprintf(`UPDATE %s SET balance = balance - $1 WHERE username = $2`, usersTable)
-	if _, err = tx.Exec(queryBuy, itemPrice, username); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed buy item)", op))
+	queryTakeFromStock := fmt.Sprintf(`UPDATE %s SET stock = stock - $1 WHERE type = $2 AND stock IS NOT NULL`, itemsTable)
+	for _, line := range order.Items {
+		item := itemsByType[line.Type]
+		if item.Stock == nil {
+			continue
+		}
+
+		if _, err := tx.Exec(queryTakeFromStock, line.Quantity, line.Type); err != nil {
+			return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed take from stock)", op))
+		}
+
+		if left := *item.Stock - line.Quantity; left <= item.LowStockThreshold {
+			logger.Warn("item is running out of stock",
+				slog.String("item", line.Type), slog.Int("stock", left), slog.Int("threshold", item.LowStockThreshold))
+		}
 	}
 
-	queryAddPurchases := fmt.Sprintf(
-		`INSERT into %s VALUES ($1, $2, 1) ON CONFLICT (username, item) DO UPDATE SET quantity = %s.quantity + 1`,
-		purchasesTable, purchasesTable)
-	if _, err = tx.Exec(queryAddPurchases, username, item); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save purchas)", op))
+	return order, nil
+}
+
+// lockPayer locks the user, or the wallet if it's set, and returns the ledger account that pays and its balance.
+func lockPayer(tx *sqlx.Tx, username, wallet string) (string, int, error) {
+	const op = "repository.shopping.lockPayer"
+
+	if wallet != "" {
+		locked, err := lockWalletForOwner(tx, wallet, username)
+		if err != nil {
+			return "", 0, errors.Wrapf(err, "%s: (failed get wallet)", op)
+		}
+		return model.WalletAccount(wallet), locked.Balance, nil
 	}
 
-	if err := tx.Commit(); err != nil {
-		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	querySelectForUpdate := fmt.Sprintf(`SELECT username, balance FROM %s WHERE username = $1 FOR UPDATE`, usersTable)
+	var user model.User
+	if err := tx.Get(&user, querySelectForUpdate, username); err != nil {
+		return "", 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get user)", op))
 	}
 
-	return nil
+	return model.UserAccount(username), user.Balance, nil
 }
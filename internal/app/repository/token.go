@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type TokenRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewTokenRepository(logger *slog.Logger, db *sqlx.DB) *TokenRepository {
+	return &TokenRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (t *TokenRepository) SaveRefreshToken(token model.RefreshToken) error {
+	const op = "repository.token.SaveRefreshToken"
+
+	query := fmt.Sprintf(`INSERT INTO %s (token_hash, username, family_id, expires_at) VALUES ($1, $2, $3, $4)`,
+		refreshTokensTable)
+	if _, err := t.db.Exec(query, token.TokenHash, token.Username, token.FamilyID, token.ExpiresAt); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save refresh token)", op))
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the presented token as used and stores its replacement in the same family.
+// Presenting a token that was already used or revoked revokes the whole family, since it means
+// the token has leaked; that revocation is committed even though an error is returned.
+func (t *TokenRepository) RotateRefreshToken(oldTokenHash string, newToken model.RefreshToken) (string, error) {
+	const op = "repository.token.RotateRefreshToken"
+
+	tx, err := t.db.Beginx()
+	if err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(t.logger, tx)
+
+	querySelectForUpdate := fmt.Sprintf(
+		`SELECT token_hash, username, family_id, expires_at, used_at, revoked_at
+				FROM %s WHERE token_hash = $1 FOR UPDATE`, refreshTokensTable)
+	var oldToken model.RefreshToken
+	if err := tx.Get(&oldToken, querySelectForUpdate, oldTokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", apierror.NewAPIError(apierror.BadTokenError, errors.Wrapf(err, "%s: (failed find refresh token)", op))
+		}
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get refresh token)", op))
+	}
+
+	if oldToken.UsedAt != nil || oldToken.RevokedAt != nil {
+		if err := revokeRefreshTokenFamily(tx, oldToken.FamilyID); err != nil {
+			return "", errors.Wrapf(err, "%s: (failed revoke reused token family)", op)
+		}
+		if err := tx.Commit(); err != nil {
+			return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+		}
+
+		t.logger.Warn("refresh token reuse detected, token family revoked",
+			slog.String("username", oldToken.Username), slog.String("family", oldToken.FamilyID))
+
+		return "", apierror.NewAPIErrorWithMsg(apierror.RefreshTokenReusedError,
+			op+": (failed rotate refresh token): token family revoked")
+	}
+
+	if time.Now().After(oldToken.ExpiresAt) {
+		return "", apierror.NewAPIErrorWithMsg(apierror.BadTokenError, op+": (failed rotate refresh token): token expired")
+	}
+
+	queryMarkUsed := fmt.Sprintf(`UPDATE %s SET used_at = now() WHERE token_hash = $1`, refreshTokensTable)
+	if _, err := tx.Exec(queryMarkUsed, oldTokenHash); err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed mark token used)", op))
+	}
+
+	queryInsert := fmt.Sprintf(`INSERT INTO %s (token_hash, username, family_id, expires_at) VALUES ($1, $2, $3, $4)`,
+		refreshTokensTable)
+	if _, err := tx.Exec(queryInsert, newToken.TokenHash, oldToken.Username, oldToken.FamilyID, newToken.ExpiresAt); err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save refresh token)", op))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return oldToken.Username, nil
+}
+
+// RevokeRefreshTokenFamily revokes the family of the given token if it belongs to username.
+func (t *TokenRepository) RevokeRefreshTokenFamily(username, tokenHash string) error {
+	const op = "repository.token.RevokeRefreshTokenFamily"
+
+	query := fmt.Sprintf(
+		`UPDATE %s SET revoked_at = now()
+				WHERE revoked_at IS NULL AND family_id = (
+				    SELECT family_id FROM %s WHERE token_hash = $1 AND username = $2
+				)`, refreshTokensTable, refreshTokensTable)
+	if _, err := t.db.Exec(query, tokenHash, username); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed revoke refresh tokens)", op))
+	}
+
+	return nil
+}
+
+func revokeRefreshTokenFamily(tx *sqlx.Tx, familyID string) error {
+	const op = "repository.token.revokeRefreshTokenFamily"
+
+	query := fmt.Sprintf(`UPDATE %s SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`,
+		refreshTokensTable)
+	if _, err := tx.Exec(query, familyID); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed revoke refresh tokens)", op))
+	}
+
+	return nil
+}
+
+// RevokeAccessToken adds the token id to the denylist until the token would have expired anyway.
+func (t *TokenRepository) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	const op = "repository.token.RevokeAccessToken"
+
+	queryCleanUp := fmt.Sprintf(`DELETE FROM %s WHERE expires_at < now()`, revokedTokensTable)
+	if _, err := t.db.Exec(queryCleanUp); err != nil {
+		t.logger.Error(fmt.Sprintf("%s: (failed clean up expired revoked tokens): %s", op, err))
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		revokedTokensTable)
+	if _, err := t.db.Exec(query, tokenID, expiresAt); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed revoke access token)", op))
+	}
+
+	return nil
+}
+
+func (t *TokenRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	const op = "repository.token.IsAccessTokenRevoked"
+
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE jti = $1)`, revokedTokensTable)
+	var revoked bool
+	if err := t.db.Get(&revoked, query, tokenID); err != nil {
+		return false, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed check token)", op))
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,498 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const walletActivityColumns = `id, username, kind, amount, counterparty, reference, created_at`
+
+type WalletRepository struct {
+	logger *slog.Logger
+	db     *sqlx.DB
+}
+
+func NewWalletRepository(logger *slog.Logger, db *sqlx.DB) *WalletRepository {
+	return &WalletRepository{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateWallet creates an empty wallet with the creator as its owner.
+func (w *WalletRepository) CreateWallet(name, owner string) (model.Wallet, error) {
+	const op = "repository.wallet.CreateWallet"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return model.Wallet{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	queryAddWallet := fmt.Sprintf(
+		`INSERT INTO %s (name, created_by) VALUES ($1, $2) RETURNING name, balance, created_by, created_at`, walletsTable)
+	var wallet model.Wallet
+	if err := tx.Get(&wallet, queryAddWallet, name, owner); err != nil {
+		if isUniqueViolation(err) {
+			return model.Wallet{}, apierror.NewAPIError(apierror.WalletAlreadyExistsError,
+				errors.Wrapf(err, "%s: (failed save wallet)", op))
+		}
+		return model.Wallet{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save wallet)", op))
+	}
+
+	queryAddOwner := fmt.Sprintf(
+		`INSERT INTO %s (wallet, username, role, added_by) VALUES ($1, $2, $3, $2)`, walletMembersTable)
+	if _, err := tx.Exec(queryAddOwner, name, owner, model.WalletRoleOwner); err != nil {
+		return model.Wallet{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed save owner)", op))
+	}
+	wallet.Role = model.WalletRoleOwner
+
+	if err := tx.Commit(); err != nil {
+		return model.Wallet{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return wallet, nil
+}
+
+// GetWallets returns the wallets the user is a member of.
+func (w *WalletRepository) GetWallets(username string) ([]model.Wallet, error) {
+	const op = "repository.wallet.GetWallets"
+
+	query := fmt.Sprintf(
+		`SELECT w.name, w.balance, m.role, w.created_by, w.created_at
+				FROM %s w
+				JOIN %s m ON m.wallet = w.name
+				WHERE m.username = $1
+				ORDER BY w.name`, walletsTable, walletMembersTable)
+	wallets := make([]model.Wallet, 0)
+	if err := w.db.Select(&wallets, query, username); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get wallets)", op))
+	}
+
+	return wallets, nil
+}
+
+// GetWallet returns the wallet with its members to one of the members.
+func (w *WalletRepository) GetWallet(name, username string) (model.WalletDetails, error) {
+	const op = "repository.wallet.GetWallet"
+
+	details, err := getWalletDetails(w.db, name, username)
+	if err != nil {
+		return model.WalletDetails{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	return details, nil
+}
+
+// GetWalletActivity returns a page of the wallet's activity to one of the members.
+func (w *WalletRepository) GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error) {
+	const op = "repository.wallet.GetWalletActivity"
+
+	if _, err := getWallet(w.db, filter.Wallet, filter.Username, false); err != nil {
+		return nil, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s FROM %s
+				WHERE wallet = $1 AND ($2 = '' OR username = $2)
+				ORDER BY id DESC
+				LIMIT $3 OFFSET $4`, walletActivityColumns, walletActivityTable)
+	activity := make([]model.WalletActivity, 0)
+	if err := w.db.Select(&activity, query, filter.Wallet, filter.Member, filter.Limit, filter.Offset); err != nil {
+		return nil, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get wallet activity)", op))
+	}
+
+	return activity, nil
+}
+
+// SetWalletMember adds a member to the wallet or changes the role of a member. Only owners manage
+// the members, and the last owner can't be turned into a plain member.
+func (w *WalletRepository) SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error) {
+	const op = "repository.wallet.SetWalletMember"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return model.WalletDetails{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	if _, err := lockWalletForOwner(tx, membership.Wallet, membership.Actor); err != nil {
+		return model.WalletDetails{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	role, owners, err := getWalletRole(tx, membership.Wallet, membership.Username)
+	if err != nil {
+		return model.WalletDetails{}, errors.Wrapf(err, "%s: (failed get member)", op)
+	}
+	if role == model.WalletRoleOwner && membership.Role != model.WalletRoleOwner && owners == 1 {
+		return model.WalletDetails{}, apierror.NewAPIErrorWithMsg(apierror.WalletLastOwnerError,
+			op+": (failed set member): member is the last owner")
+	}
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (wallet, username, role, added_by) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (wallet, username) DO UPDATE SET role = EXCLUDED.role`, walletMembersTable)
+	if _, err := tx.Exec(query, membership.Wallet, membership.Username, membership.Role, membership.Actor); err != nil {
+		if isForeignKeyViolation(err) {
+			return model.WalletDetails{}, apierror.NewAPIError(apierror.NoSuchUserError,
+				errors.Wrapf(err, "%s: (failed set member): user not found", op))
+		}
+		return model.WalletDetails{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed set member)", op))
+	}
+
+	details, err := getWalletDetails(tx, membership.Wallet, membership.Actor)
+	if err != nil {
+		return model.WalletDetails{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WalletDetails{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return details, nil
+}
+
+// RemoveWalletMember removes a member from the wallet. Owners remove anyone, members can only leave,
+// and the last owner can't be removed. What the member did stays in the wallet's activity.
+func (w *WalletRepository) RemoveWalletMember(wallet, actor, username string) error {
+	const op = "repository.wallet.RemoveWalletMember"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	locked, err := getWallet(tx, wallet, actor, true)
+	if err != nil {
+		return errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+	if actor != username && locked.Role != model.WalletRoleOwner {
+		return apierror.NewAPIErrorWithMsg(apierror.ForbiddenError,
+			op+": (failed remove member): only owners can remove other members")
+	}
+
+	role, owners, err := getWalletRole(tx, wallet, username)
+	if err != nil {
+		return errors.Wrapf(err, "%s: (failed get member)", op)
+	}
+	switch {
+	case role == "":
+		return apierror.NewAPIErrorWithMsg(apierror.WalletMemberNotFoundError,
+			op+": (failed remove member): user isn't a member")
+	case role == model.WalletRoleOwner && owners == 1:
+		return apierror.NewAPIErrorWithMsg(apierror.WalletLastOwnerError,
+			op+": (failed remove member): member is the last owner")
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE wallet = $1 AND username = $2`, walletMembersTable)
+	if _, err := tx.Exec(query, wallet, username); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed remove member)", op))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return nil
+}
+
+// Contribute moves coins from a member to the wallet. The idempotency key, if any, is saved in the same transaction.
+func (w *WalletRepository) Contribute(wallet, username string, amount int,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	const op = "repository.wallet.Contribute"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	// the wallet is locked before the users by every wallet operation, so they can't deadlock
+	if _, err := getWallet(tx, wallet, username, true); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	querySelectForUpdate := fmt.Sprintf(`SELECT username, balance FROM %s WHERE username = $1 FOR UPDATE`, usersTable)
+	var user model.User
+	if err := tx.Get(&user, querySelectForUpdate, username); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get user)", op))
+	}
+	if user.Balance < amount {
+		return model.WalletActivity{}, apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError,
+			op+": (failed get user): not enough money")
+	}
+
+	activity, err := addWalletActivity(tx, wallet, model.WalletActivity{
+		Username: username,
+		Kind:     model.WalletActivityContribution,
+		Amount:   amount,
+	})
+	if err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed contribute)", op)
+	}
+
+	if err := post(tx, model.Posting{
+		From:      model.UserAccount(username),
+		To:        model.WalletAccount(wallet),
+		Amount:    amount,
+		Kind:      model.LedgerKindContribution,
+		Reference: walletActivityReference(activity.ID),
+	}); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed contribute)", op)
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(activity); err != nil {
+			return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal activity)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed contribute)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return activity, nil
+}
+
+// WalletSendCoin moves coins from the wallet to a user on behalf of one of its owners. The transfer is
+// recorded with the owner as its sender, so it counts towards the owner's transfer limits.
+func (w *WalletRepository) WalletSendCoin(transfer model.WalletTransfer,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	const op = "repository.wallet.WalletSendCoin"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	wallet, err := lockWalletForOwner(tx, transfer.Wallet, transfer.Owner)
+	if err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	// the owner is locked with the receiver, so concurrent transfers of the owner can't both fit into the limits
+	queryLockUsers := fmt.Sprintf(`SELECT username FROM %s WHERE username IN ($1, $2) FOR UPDATE`, usersTable)
+	var usernames []string
+	if err := tx.Select(&usernames, queryLockUsers, transfer.Owner, transfer.Send.ToUser); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get users)", op))
+	}
+	if len(usernames) < 2 {
+		return model.WalletActivity{}, apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError,
+			op+": (failed get users): receiver not found")
+	}
+
+	if wallet.Balance < transfer.Send.Amount {
+		return model.WalletActivity{}, apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError,
+			op+": (failed get wallet): not enough money")
+	}
+
+	if err := checkTransferLimits(tx, transfer.Owner, transfer.Send, transfer.Limits); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed check limits)", op)
+	}
+
+	activity, err := addWalletActivity(tx, transfer.Wallet, model.WalletActivity{
+		Username:     transfer.Owner,
+		Kind:         model.WalletActivityTransfer,
+		Amount:       -transfer.Send.Amount,
+		Counterparty: transfer.Send.ToUser,
+	})
+	if err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	if err := post(tx, model.Posting{
+		From:      model.WalletAccount(transfer.Wallet),
+		To:        model.UserAccount(transfer.Send.ToUser),
+		Amount:    transfer.Send.Amount,
+		Kind:      model.LedgerKindTransfer,
+		Reference: walletActivityReference(activity.ID),
+	}); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	queryAddTransaction := fmt.Sprintf(
+		`INSERT INTO %s (sender, receiver, amount, message, category, wallet) VALUES ($1, $2, $3, $4, $5, $6)`,
+		transactionsTable)
+	if _, err := tx.Exec(queryAddTransaction, transfer.Owner, transfer.Send.ToUser, transfer.Send.Amount,
+		transfer.Send.Message, transfer.Send.Category, transfer.Wallet); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save transaction)", op))
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(activity); err != nil {
+			return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal activity)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.WalletActivity{}, errors.Wrapf(err, "%s: (failed send coin)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return activity, nil
+}
+
+// WalletBuy buys quantity units of the item from the wallet on behalf of one of its owners, the items
+// go to the owner's inventory. The idempotency key, if any, is saved in the same transaction.
+func (w *WalletRepository) WalletBuy(wallet, owner, item string, quantity int,
+	key *model.IdempotencyKey) (model.Order, error) {
+	const op = "repository.wallet.WalletBuy"
+
+	tx, err := w.db.Beginx()
+	if err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed begin transaction)", op))
+	}
+	defer rollback(w.logger, tx)
+
+	order, err := buyItems(w.logger, tx, owner, wallet, []model.OrderLine{{Type: item, Quantity: quantity}})
+	if err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed buy item)", op)
+	}
+
+	if key != nil {
+		if key.Response, err = json.Marshal(order); err != nil {
+			return model.Order{}, apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(err, "%s: (failed marshal order)", op))
+		}
+	}
+	if err := claimIdempotencyKey(tx, key); err != nil {
+		return model.Order{}, errors.Wrapf(err, "%s: (failed buy item)", op)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Order{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed commit)", op))
+	}
+
+	return order, nil
+}
+
+// getWallet reads the wallet with the role of the user in it, forUpdate locks the wallet row until
+// the end of the transaction. Wallets the user isn't a member of are reported as not found,
+// so their existence isn't disclosed.
+func getWallet(q sqlx.Queryer, name, username string, forUpdate bool) (model.Wallet, error) {
+	const op = "repository.wallet.getWallet"
+
+	query := fmt.Sprintf(
+		`SELECT w.name, w.balance, m.role, w.created_by, w.created_at
+				FROM %s w
+				JOIN %s m ON m.wallet = w.name AND m.username = $2
+				WHERE w.name = $1`, walletsTable, walletMembersTable)
+	if forUpdate {
+		query += " FOR UPDATE OF w"
+	}
+
+	var wallet model.Wallet
+	if err := sqlx.Get(q, &wallet, query, name, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.Wallet{}, apierror.NewAPIError(apierror.WalletNotFoundError,
+				errors.Wrapf(err, "%s: (failed find wallet)", op))
+		}
+		return model.Wallet{}, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get wallet)", op))
+	}
+
+	return wallet, nil
+}
+
+// lockWalletForOwner locks the wallet and checks that the user is one of its owners.
+func lockWalletForOwner(tx *sqlx.Tx, name, username string) (model.Wallet, error) {
+	const op = "repository.wallet.lockWalletForOwner"
+
+	wallet, err := getWallet(tx, name, username, true)
+	if err != nil {
+		return model.Wallet{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+	if wallet.Role != model.WalletRoleOwner {
+		return model.Wallet{}, apierror.NewAPIErrorWithMsg(apierror.ForbiddenError,
+			op+": (failed check role): only owners can manage and spend from the wallet")
+	}
+
+	return wallet, nil
+}
+
+// getWalletDetails reads the wallet for one of its members together with every member's contributions
+// and spending.
+func getWalletDetails(q sqlx.Queryer, name, username string) (model.WalletDetails, error) {
+	const op = "repository.wallet.getWalletDetails"
+
+	wallet, err := getWallet(q, name, username, false)
+	if err != nil {
+		return model.WalletDetails{}, errors.Wrapf(err, "%s: (failed get wallet)", op)
+	}
+
+	query := fmt.Sprintf(
+		`SELECT m.username, m.role, m.added_by, m.added_at,
+				       COALESCE(SUM(a.amount) FILTER (WHERE a.kind = $2), 0) AS contributed,
+				       COALESCE(-SUM(a.amount) FILTER (WHERE a.kind <> $2), 0) AS spent
+				FROM %s m
+				LEFT JOIN %s a ON a.wallet = m.wallet AND a.username = m.username
+				WHERE m.wallet = $1
+				GROUP BY m.username, m.role, m.added_by, m.added_at
+				ORDER BY m.username`, walletMembersTable, walletActivityTable)
+	details := model.WalletDetails{Wallet: wallet, Members: make([]model.WalletMember, 0)}
+	if err := sqlx.Select(q, &details.Members, query, name, model.WalletActivityContribution); err != nil {
+		return model.WalletDetails{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed get members)", op))
+	}
+
+	return details, nil
+}
+
+// getWalletRole returns the role of the user in the wallet, empty if they aren't a member,
+// and the number of the wallet's owners.
+func getWalletRole(tx *sqlx.Tx, wallet, username string) (string, int, error) {
+	const op = "repository.wallet.getWalletRole"
+
+	query := fmt.Sprintf(
+		`SELECT COALESCE((SELECT role FROM %[1]s WHERE wallet = $1 AND username = $2), '') AS role,
+				       (SELECT COUNT(*) FROM %[1]s WHERE wallet = $1 AND role = $3) AS owners`, walletMembersTable)
+	var member struct {
+		Role   string `db:"role"`
+		Owners int    `db:"owners"`
+	}
+	if err := tx.Get(&member, query, wallet, username, model.WalletRoleOwner); err != nil {
+		return "", 0, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed get role)", op))
+	}
+
+	return member.Role, member.Owners, nil
+}
+
+// addWalletActivity attributes a coin movement of the wallet to the member who made it.
+func addWalletActivity(tx *sqlx.Tx, wallet string, activity model.WalletActivity) (model.WalletActivity, error) {
+	const op = "repository.wallet.addWalletActivity"
+
+	query := fmt.Sprintf(
+		`INSERT INTO %s (wallet, username, kind, amount, counterparty, reference) VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING %s`, walletActivityTable, walletActivityColumns)
+	var added model.WalletActivity
+	if err := tx.Get(&added, query, wallet, activity.Username, activity.Kind, activity.Amount,
+		activity.Counterparty, activity.Reference); err != nil {
+		return model.WalletActivity{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (failed save wallet activity)", op))
+	}
+
+	return added, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type ApprovalRepository interface {
+	ReserveTransfer(fromUsername string, send model.Send, limits model.TransferLimits,
+		expiresAt time.Time, key *model.IdempotencyKey) (model.TransferApproval, error)
+	DecideApproval(decision model.ApprovalDecision, key *model.IdempotencyKey) (model.TransferApproval, error)
+	ExpireApprovals() (int, error)
+	GetPendingApprovals(manager string) ([]model.TransferApproval, error)
+}
+
+type ApprovalService struct {
+	logger             *slog.Logger
+	approvalRepository ApprovalRepository
+}
+
+func NewApprovalService(logger *slog.Logger, a ApprovalRepository) *ApprovalService {
+	return &ApprovalService{
+		logger:             logger,
+		approvalRepository: a,
+	}
+}
+
+// getApprovalThreshold reads the amount above which transfers need an approval, zero disables approvals.
+func getApprovalThreshold() (int, error) {
+	const op = "service.approval.getApprovalThreshold"
+
+	raw := os.Getenv(model.EnvApprovalThreshold)
+	if raw == "" {
+		return 0, nil
+	}
+
+	threshold, err := strconv.Atoi(raw)
+	if err != nil || threshold < 0 {
+		return 0, apierror.NewAPIErrorWithMsg(apierror.InternalError,
+			fmt.Sprintf("%s: (env %s must be a non-negative number)", op, model.EnvApprovalThreshold))
+	}
+
+	return threshold, nil
+}
+
+// getApprovalExpiry returns when an approval created now expires.
+func getApprovalExpiry() (time.Time, error) {
+	const op = "service.approval.getApprovalExpiry"
+
+	ttl, err := strconv.Atoi(os.Getenv(model.EnvApprovalTTL))
+	if err != nil || ttl <= 0 {
+		return time.Time{}, apierror.NewAPIErrorWithMsg(apierror.InternalError,
+			fmt.Sprintf("%s: (env %s must be a positive number)", op, model.EnvApprovalTTL))
+	}
+
+	return time.Now().Add(time.Duration(ttl) * time.Hour), nil
+}
+
+func (s *ShopService) reserveTransfer(username string, send model.Send, limits model.TransferLimits,
+	key *model.IdempotencyKey) (model.TransferApproval, error) {
+	const op = "service.approval.reserveTransfer"
+
+	expiresAt, err := getApprovalExpiry()
+	if err != nil {
+		return model.TransferApproval{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the transfer is only accepted, so a replay of the request must respond the same way
+	if key != nil {
+		key.StatusCode = http.StatusAccepted
+	}
+
+	approval, err := s.approvalRepository.ReserveTransfer(username, send, limits, expiresAt, key)
+	if err != nil {
+		return model.TransferApproval{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.logger.Info("transfer is waiting for approval",
+		slog.Int64("approval", approval.ID), slog.String("from", username), slog.Int("amount", send.Amount))
+
+	return approval, nil
+}
+
+// GetApprovals returns the pending transfers the approver may decide on: all of them for an admin,
+// otherwise the transfers to the users the approver manages.
+func (a *ApprovalService) GetApprovals(approver string, admin bool) ([]model.TransferApproval, error) {
+	const op = "service.approval.GetApprovals"
+
+	manager := approver
+	if admin {
+		manager = ""
+	}
+
+	approvals, err := a.approvalRepository.GetPendingApprovals(manager)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return approvals, nil
+}
+
+func (a *ApprovalService) DecideApproval(decision model.ApprovalDecision,
+	key *model.IdempotencyKey) (model.TransferApproval, error) {
+	const op = "service.approval.DecideApproval"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.TransferApproval{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	approval, err := a.approvalRepository.DecideApproval(decision, key)
+	if err != nil {
+		return model.TransferApproval{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return approval, nil
+}
+
+// RunApprovalExpiry releases the coins of expired approvals every interval until ctx is done.
+func (a *ApprovalService) RunApprovalExpiry(ctx context.Context, interval time.Duration) {
+	const op = "service.approval.RunApprovalExpiry"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := a.approvalRepository.ExpireApprovals()
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("%s: %s", op, err))
+			continue
+		}
+
+		if expired > 0 {
+			a.logger.Info("approvals expired", slog.Int("count", expired))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockApprovalRepository struct {
+	mock.Mock
+}
+
+func (m *MockApprovalRepository) ReserveTransfer(fromUsername string, send model.Send, limits model.TransferLimits,
+	expiresAt time.Time, key *model.IdempotencyKey) (model.TransferApproval, error) {
+	args := m.Called(fromUsername, send, limits, expiresAt, key)
+	approval, _ := args.Get(0).(model.TransferApproval)
+	return approval, args.Error(1)
+}
+
+func (m *MockApprovalRepository) DecideApproval(decision model.ApprovalDecision,
+	key *model.IdempotencyKey) (model.TransferApproval, error) {
+	args := m.Called(decision, key)
+	approval, _ := args.Get(0).(model.TransferApproval)
+	return approval, args.Error(1)
+}
+
+func (m *MockApprovalRepository) ExpireApprovals() (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockApprovalRepository) GetPendingApprovals(manager string) ([]model.TransferApproval, error) {
+	args := m.Called(manager)
+	approvals, _ := args.Get(0).([]model.TransferApproval)
+	return approvals, args.Error(1)
+}
+
+func TestNewApprovalService(t *testing.T) {
+	var log *slog.Logger
+	approvalRepository := new(MockApprovalRepository)
+
+	s := NewApprovalService(log, approvalRepository)
+	assert.Equal(t, &ApprovalService{
+		logger:             log,
+		approvalRepository: approvalRepository}, s)
+}
+
+func TestApprovalService_GetApprovals(t *testing.T) {
+	tests := []struct {
+		name        string
+		approver    string
+		admin       bool
+		wantManager string
+	}{
+		{
+			name:        "manager",
+			approver:    "boss",
+			wantManager: "boss",
+		},
+		{
+			name:        "admin sees every approval",
+			approver:    "admin",
+			admin:       true,
+			wantManager: "",
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approvalRepository := new(MockApprovalRepository)
+			s := NewApprovalService(log, approvalRepository)
+			approvalRepository.On("GetPendingApprovals", tt.wantManager).
+				Return([]model.TransferApproval{{ID: 1}}, nil)
+
+			approvals, err := s.GetApprovals(tt.approver, tt.admin)
+
+			assert.NoError(t, err)
+			assert.Len(t, approvals, 1)
+			approvalRepository.AssertCalled(t, "GetPendingApprovals", tt.wantManager)
+		})
+	}
+}
+
+func TestApprovalService_DecideApproval(t *testing.T) {
+	decision := model.ApprovalDecision{ID: 1, Approver: "boss", Approve: true}
+
+	tests := []struct {
+		name                      string
+		decideApprovalOutputError error
+		wantErr                   *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                      "expired",
+			decideApprovalOutputError: apierror.NewAPIErrorWithMsg(apierror.ApprovalExpiredError, "mock"),
+			wantErr:                   &apierror.ApprovalExpiredError,
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approvalRepository := new(MockApprovalRepository)
+			s := NewApprovalService(log, approvalRepository)
+			approvalRepository.On("DecideApproval", decision, (*model.IdempotencyKey)(nil)).
+				Return(model.TransferApproval{ID: 1, Status: model.ApprovalStatusApproved}, tt.decideApprovalOutputError)
+
+			approval, err := s.DecideApproval(decision, nil)
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, model.ApprovalStatusApproved, approval.Status)
+		})
+	}
+}
@@ -5,80 +5,240 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/sha3"
 
 	"github.com/nosikmy/avito-shop/internal/app/apierror"
 	"github.com/nosikmy/avito-shop/internal/app/model"
 )
 
 type AuthRepository interface {
-	Auth(username, passwordHash string) error
+	GetUser(username string) (model.AuthDB, error)
+	CreateUser(username, passwordHash string) error
+	UpdatePasswordHash(username, passwordHash string) error
+	UpdateRole(username, role string) error
+	UpdateManager(username, manager string) error
+}
+
+// tokenClaims carries the role as a custom claim next to the registered ones.
+type tokenClaims struct {
+	jwt.StandardClaims
+	Role string `json:"role,omitempty"`
+}
+
+type TokenRepository interface {
+	SaveRefreshToken(token model.RefreshToken) error
+	RotateRefreshToken(oldTokenHash string, newToken model.RefreshToken) (string, error)
+	RevokeRefreshTokenFamily(username, tokenHash string) error
+	RevokeAccessToken(tokenID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(tokenID string) (bool, error)
 }
 
 type AuthService struct {
-	logger         *slog.Logger
-	authRepository AuthRepository
+	logger          *slog.Logger
+	authRepository  AuthRepository
+	tokenRepository TokenRepository
+	passwordHasher  PasswordHasher
+	keyring         *Keyring
+	dummyHash       string
+	dummyHashOnce   sync.Once
 }
 
-func NewAuthService(logger *slog.Logger, a AuthRepository) *AuthService {
+func NewAuthService(logger *slog.Logger, a AuthRepository, t TokenRepository, p PasswordHasher,
+	k *Keyring) *AuthService {
 	return &AuthService{
-		logger:         logger,
-		authRepository: a,
+		logger:          logger,
+		authRepository:  a,
+		tokenRepository: t,
+		passwordHasher:  p,
+		keyring:         k,
+	}
+}
+
+func (a *AuthService) Auth(input model.AuthInput) error {
+	const op = "service.auth.Auth"
+
+	user, err := a.authRepository.GetUser(input.Username)
+	if err != nil {
+		if !apierror.Is(err, apierror.UserNotFoundError) {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		autoSignUp, errEnv := autoSignUpEnabled()
+		if errEnv != nil {
+			return apierror.NewAPIError(apierror.InternalError,
+				errors.Wrapf(errEnv, "%s: (env %s must be boolean)", op, model.EnvAuthAutoSignUp))
+		}
+		if !autoSignUp {
+			a.verifyDummyPassword(input.Password)
+			return apierror.NewAPIError(apierror.InvalidCredentialsError, errors.Wrapf(err, "%s: (failed sign in user)", op))
+		}
+
+		return a.signUp(input)
 	}
+
+	ok, err := a.passwordHasher.Verify(input.Password, user.PasswordHash)
+	if err != nil {
+		return fmt.Errorf("%s: (failed verify password): %w", op, err)
+	}
+	if !ok {
+		return apierror.NewAPIErrorWithMsg(apierror.InvalidCredentialsError, op+": (failed sign in user): wrong password")
+	}
+
+	if a.passwordHasher.NeedsRehash(user.PasswordHash) {
+		a.rehashPassword(input)
+	}
+
+	return nil
 }
 
-func generatePasswordHash(password string) (string, error) {
-	hash := sha3.New256()
-	hash.Write([]byte(password))
+// dummyPassword is hashed once and verified instead of the password of an unknown user.
+const dummyPassword = "avito-shop-dummy-password"
+
+// verifyDummyPassword takes as long as checking a real password, so that unknown usernames
+// can't be told apart by the response time.
+func (a *AuthService) verifyDummyPassword(password string) {
+	const op = "service.auth.verifyDummyPassword"
 
-	salt := os.Getenv(model.EnvPasswordSalt)
-	if salt == "" {
-		return "", apierror.NewAPIErrorWithMsg(apierror.InternalError, "salt is empty")
+	a.dummyHashOnce.Do(func() {
+		hash, err := a.passwordHasher.Hash(dummyPassword)
+		if err != nil {
+			a.logger.Error(fmt.Sprintf("%s: (failed generate password hash): %s", op, err))
+			return
+		}
+		a.dummyHash = hash
+	})
+	if a.dummyHash == "" {
+		return
 	}
 
-	return fmt.Sprintf("%x", hash.Sum([]byte(salt))), nil
+	if _, err := a.passwordHasher.Verify(password, a.dummyHash); err != nil {
+		a.logger.Error(fmt.Sprintf("%s: (failed verify password): %s", op, err))
+	}
 }
 
-func (a *AuthService) Auth(input model.AuthInput) error {
-	const op = "service.auth.Auth"
+// autoSignUpEnabled reports whether Auth should create unknown users the way
+// it used to before explicit registration was introduced. It's on unless turned off.
+func autoSignUpEnabled() (bool, error) {
+	value := os.Getenv(model.EnvAuthAutoSignUp)
+	if value == "" {
+		return true, nil
+	}
 
-	passwordHash, err := generatePasswordHash(input.Password)
+	return strconv.ParseBool(value)
+}
+
+func (a *AuthService) Register(input model.AuthInput) error {
+	const op = "service.auth.Register"
+
+	if err := a.signUp(input); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) signUp(input model.AuthInput) error {
+	const op = "service.auth.signUp"
+
+	passwordHash, err := a.passwordHasher.Hash(input.Password)
 	if err != nil {
 		return fmt.Errorf("%s: (failed generate password hash): %w", op, err)
 	}
 
-	if err := a.authRepository.Auth(input.Username, passwordHash); err != nil {
+	if err := a.authRepository.CreateUser(input.Username, passwordHash); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (a *AuthService) GenerateToken(username string) (string, error) {
+// rehashPassword upgrades an outdated hash after a successful login. The user is
+// already authenticated at this point, so a failure is only logged.
+func (a *AuthService) rehashPassword(input model.AuthInput) {
+	const op = "service.auth.rehashPassword"
+
+	passwordHash, err := a.passwordHasher.Hash(input.Password)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("%s: (failed generate password hash): %s", op, err))
+		return
+	}
+
+	if err := a.authRepository.UpdatePasswordHash(input.Username, passwordHash); err != nil {
+		a.logger.Error(fmt.Sprintf("%s: %s", op, err))
+		return
+	}
+
+	a.logger.Info("password hash upgraded", slog.String("username", input.Username))
+}
+
+func (a *AuthService) GenerateTokens(username string) (model.AuthOutput, error) {
+	const op = "service.auth.GenerateTokens"
+
+	user, err := a.authRepository.GetUser(username)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, err := a.GenerateToken(username, user.Role)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	familyID, err := randomToken(tokenIDLength)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refreshToken, token, err := newRefreshToken()
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+	token.Username = username
+	token.FamilyID = familyID
+
+	if err := a.tokenRepository.SaveRefreshToken(token); err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return model.AuthOutput{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// GenerateToken issues a short-lived access token; its jti is what Logout puts on the denylist.
+func (a *AuthService) GenerateToken(username, role string) (string, error) {
 	const op = "service.auth.GenerateToken"
 
-	tokenTTL, err := strconv.Atoi(os.Getenv(model.EnvTokenTTLHours))
+	// TOKEN_TTL_HOURS set the lifetime before ACCESS_TOKEN_TTL_MINUTES replaced it, old deployments still have it
+	ttlEnv, ttlUnit := model.EnvAccessTokenTTLMinutes, time.Minute
+	if os.Getenv(ttlEnv) == "" && os.Getenv(model.EnvTokenTTLHours) != "" {
+		ttlEnv, ttlUnit = model.EnvTokenTTLHours, time.Hour
+	}
+	tokenTTL, err := strconv.Atoi(os.Getenv(ttlEnv))
 	if err != nil {
 		return "", apierror.NewAPIError(apierror.InternalError,
-			errors.Wrapf(err, "%s: (env %s must be numeric)", op, model.EnvTokenTTLHours))
+			errors.Wrapf(err, "%s: (env %s must be numeric)", op, ttlEnv))
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(time.Duration(tokenTTL) * time.Hour).Unix(),
-		IssuedAt:  time.Now().Unix(),
-		Id:        username,
-	})
-
-	signingKey := os.Getenv(model.EnvSigningKey)
-	if signingKey == "" {
-		return "", apierror.NewAPIErrorWithMsg(apierror.InternalError, op+": (failed get sign key): sign key is empty")
+	tokenID, err := randomToken(tokenIDLength)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	signedToken, err := token.SignedString([]byte(signingKey))
+	signedToken, err := a.keyring.Sign(tokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Duration(tokenTTL) * ttlUnit).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Id:        tokenID,
+			Subject:   username,
+		},
+		Role: role,
+	})
 	if err != nil {
 		return "", apierror.NewAPIError(apierror.BadTokenError, errors.Wrapf(err, "%s: (failed sign token)", op))
 	}
@@ -86,29 +246,120 @@ func (a *AuthService) GenerateToken(username string) (string, error) {
 	return signedToken, nil
 }
 
-func (a *AuthService) ParseToken(token string) (string, error) {
+func (a *AuthService) ParseToken(token string) (model.TokenClaims, error) {
 	const op = "service.auth.ParseToken"
 
-	t, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return "", apierror.NewAPIErrorWithMsg(apierror.BadTokenError, op+": (failed parse token): invalid signing method")
-		}
+	t, err := jwt.ParseWithClaims(token, &tokenClaims{}, a.keyring.Keyfunc)
+	if err != nil {
+		return model.TokenClaims{}, apierror.NewAPIError(apierror.BadTokenError, errors.Wrapf(err, "%s: (failed parse token)", op))
+	}
 
-		signingKey := os.Getenv(model.EnvSigningKey)
-		if signingKey == "" {
-			return "", apierror.NewAPIErrorWithMsg(apierror.InternalError, op+": (failed get sign key): sign key is empty")
-		}
+	claims, ok := t.Claims.(*tokenClaims)
+	if !ok {
+		return model.TokenClaims{}, apierror.NewAPIErrorWithMsg(apierror.BadTokenError,
+			op+": (failed parse token): invalid access token claims type")
+	}
 
-		return []byte(signingKey), nil
-	})
+	if claims.Subject == "" || claims.Id == "" {
+		return model.TokenClaims{}, apierror.NewAPIErrorWithMsg(apierror.BadTokenError,
+			op+": (failed parse token): token has no subject or id")
+	}
+
+	revoked, err := a.tokenRepository.IsAccessTokenRevoked(claims.Id)
 	if err != nil {
-		return "", apierror.NewAPIError(apierror.BadTokenError, errors.Wrapf(err, "%s: (failed parse token)", op))
+		return model.TokenClaims{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if revoked {
+		return model.TokenClaims{}, apierror.NewAPIErrorWithMsg(apierror.RevokedTokenError,
+			op+": (failed parse token): token is on the denylist")
 	}
 
-	claims, ok := t.Claims.(*jwt.StandardClaims)
-	if !ok {
-		return "", apierror.NewAPIErrorWithMsg(apierror.BadTokenError, op+": (failed parse token): invalid access token claims type")
+	// tokens issued before roles were introduced belong to regular users
+	role := claims.Role
+	if role == "" {
+		role = model.RoleUser
+	}
+
+	return model.TokenClaims{
+		Username:  claims.Subject,
+		Role:      role,
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+func (a *AuthService) JWKS() model.JWKS {
+	return a.keyring.JWKS()
+}
+
+// RefreshTokens exchanges a refresh token for a new access and refresh token pair.
+// The presented refresh token can't be used again.
+func (a *AuthService) RefreshTokens(refreshToken string) (model.AuthOutput, error) {
+	const op = "service.auth.RefreshTokens"
+
+	newToken, token, err := newRefreshToken()
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return claims.Id, nil
+	username, err := a.tokenRepository.RotateRefreshToken(hashRefreshToken(refreshToken), token)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the role is read again so that role changes apply on the next refresh
+	user, err := a.authRepository.GetUser(username)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	accessToken, err := a.GenerateToken(username, user.Role)
+	if err != nil {
+		return model.AuthOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return model.AuthOutput{
+		Token:        accessToken,
+		RefreshToken: newToken,
+	}, nil
+}
+
+// Logout revokes the access token it was called with and, if given,
+// every refresh token rotated from the same login as refreshToken.
+func (a *AuthService) Logout(claims model.TokenClaims, refreshToken string) error {
+	const op = "service.auth.Logout"
+
+	if err := a.tokenRepository.RevokeAccessToken(claims.TokenID, claims.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	if err := a.tokenRepository.RevokeRefreshTokenFamily(claims.Username, hashRefreshToken(refreshToken)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) SetRole(username, role string) error {
+	const op = "service.auth.SetRole"
+
+	if err := a.authRepository.UpdateRole(username, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *AuthService) SetManager(username, manager string) error {
+	const op = "service.auth.SetManager"
+
+	if err := a.authRepository.UpdateManager(username, manager); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
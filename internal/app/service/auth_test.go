@@ -5,8 +5,9 @@ import (
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -19,15 +20,68 @@ type MockAuthRepository struct {
 	mock.Mock
 }
 
-func (m *MockAuthRepository) Auth(username, passwordHash string) error {
+func (m *MockAuthRepository) GetUser(username string) (model.AuthDB, error) {
+	args := m.Called(username)
+	user, _ := args.Get(0).(model.AuthDB)
+	return user, args.Error(1)
+}
+
+func (m *MockAuthRepository) CreateUser(username, passwordHash string) error {
 	args := m.Called(username, passwordHash)
 	return args.Error(0)
 }
 
+func (m *MockAuthRepository) UpdatePasswordHash(username, passwordHash string) error {
+	args := m.Called(username, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) UpdateRole(username, role string) error {
+	args := m.Called(username, role)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) UpdateManager(username, manager string) error {
+	args := m.Called(username, manager)
+	return args.Error(0)
+}
+
+type MockTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockTokenRepository) SaveRefreshToken(token model.RefreshToken) error {
+	args := m.Called(token)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RotateRefreshToken(oldTokenHash string, newToken model.RefreshToken) (string, error) {
+	args := m.Called(oldTokenHash, newToken)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTokenRepository) RevokeRefreshTokenFamily(username, tokenHash string) error {
+	args := m.Called(username, tokenHash)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	args := m.Called(tokenID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) IsAccessTokenRevoked(tokenID string) (bool, error) {
+	args := m.Called(tokenID)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestNewAuthService(t *testing.T) {
 	type inputArgs struct {
-		logger         *slog.Logger
-		authRepository AuthRepository
+		logger          *slog.Logger
+		authRepository  AuthRepository
+		tokenRepository TokenRepository
+		passwordHasher  PasswordHasher
+		keyring         *Keyring
 	}
 	tests := []struct {
 		name    string
@@ -41,67 +95,83 @@ func TestNewAuthService(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := NewAuthService(tt.args.logger, tt.args.authRepository)
+			s := NewAuthService(tt.args.logger, tt.args.authRepository, tt.args.tokenRepository, tt.args.passwordHasher,
+				tt.args.keyring)
 			assert.Equal(t, &AuthService{
-				logger:         tt.args.logger,
-				authRepository: tt.args.authRepository}, s)
+				logger:          tt.args.logger,
+				authRepository:  tt.args.authRepository,
+				tokenRepository: tt.args.tokenRepository,
+				passwordHasher:  tt.args.passwordHasher,
+				keyring:         tt.args.keyring}, s)
 		})
 	}
 }
 
+func newTestKeyring(t *testing.T, secret string) *Keyring {
+	keyring, err := NewKeyring(legacyHMACKeyID, SigningKey{
+		KID:        legacyHMACKeyID,
+		Method:     jwt.SigningMethodHS256,
+		PrivateKey: []byte(secret),
+		PublicKey:  []byte(secret),
+	})
+	assert.NoError(t, err)
+	return keyring
+}
+
 func TestAuthService_GenerateTokenParseToken(t *testing.T) {
 	type inputArgs struct {
-		username      string
-		envTokenTTL   string
-		envSigningKey string
+		username          string
+		envTokenTTL       string
+		envLegacyTokenTTL string
 	}
 	tests := []struct {
 		name           string
 		args           inputArgs
+		wantTTL        time.Duration
 		wantErr        *apierror.APIError
 		wantErrMessage string
 	}{
 		{
 			name: "success",
 			args: inputArgs{
-				username:      "username",
-				envTokenTTL:   "4",
-				envSigningKey: "jgrh4r5ehg",
+				username:          "username",
+				envTokenTTL:       "4",
+				envLegacyTokenTTL: "2",
 			},
+			wantTTL: 4 * time.Minute,
 		},
 		{
-			name: "invalid signing key",
+			name: "falls back to TOKEN_TTL_HOURS",
 			args: inputArgs{
-				username:      "username",
-				envTokenTTL:   "4",
-				envSigningKey: "",
+				username:          "username",
+				envLegacyTokenTTL: "2",
 			},
-			wantErr:        &apierror.InternalError,
-			wantErrMessage: "service.auth.GenerateToken: (failed get sign key): sign key is empty",
+			wantTTL: 2 * time.Hour,
 		},
 		{
 			name: "invalid token TTL",
 			args: inputArgs{
-				username:      "username",
-				envTokenTTL:   "stroka",
-				envSigningKey: "gr5h567ui896l7kj",
+				username:    "username",
+				envTokenTTL: "stroka",
 			},
 			wantErr: &apierror.InternalError,
 			wantErrMessage: fmt.Sprintf(
 				"service.auth.GenerateToken: (env %s must be numeric): strconv.Atoi: parsing \"stroka\": invalid syntax",
-				model.EnvTokenTTLHours),
+				model.EnvAccessTokenTTLMinutes),
 		},
 	}
 	var log *slog.Logger
 	log = slog.New(
 		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
-	s := NewAuthService(log, nil)
+	tokenRepository := new(MockTokenRepository)
+	tokenRepository.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+	s := NewAuthService(log, nil, tokenRepository, nil, newTestKeyring(t, "jgrh4r5ehg"))
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			os.Setenv(model.EnvTokenTTLHours, tt.args.envTokenTTL)
-			os.Setenv(model.EnvSigningKey, tt.args.envSigningKey)
-			token, errGenerate := s.GenerateToken(tt.args.username)
+			t.Setenv(model.EnvAccessTokenTTLMinutes, tt.args.envTokenTTL)
+			t.Setenv(model.EnvTokenTTLHours, tt.args.envLegacyTokenTTL)
+			token, errGenerate := s.GenerateToken(tt.args.username, model.RoleAdmin)
 
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
@@ -112,20 +182,22 @@ func TestAuthService_GenerateTokenParseToken(t *testing.T) {
 					fmt.Sprintf("%s: %s", tt.wantErr.Message, tt.wantErrMessage))
 				return
 			}
-			username, errParse := s.ParseToken(token)
+			claims, errParse := s.ParseToken(token)
 			assert.NoError(t, errGenerate)
 			assert.NoError(t, errParse)
-			assert.Equal(t, tt.args.username, username)
+			assert.Equal(t, tt.args.username, claims.Username)
+			assert.Equal(t, model.RoleAdmin, claims.Role)
+			assert.NotEmpty(t, claims.TokenID)
+			assert.WithinDuration(t, time.Now().Add(tt.wantTTL), claims.ExpiresAt, 5*time.Second)
 		})
 	}
 }
 
 func TestAuthService_ParseToken(t *testing.T) {
-	godotenv.Load()
 	type inputArgs struct {
-		username      string
-		envTokenTTL   string
-		envSigningKey string
+		username         string
+		generateToken    bool
+		parserSigningKey string
 	}
 	tests := []struct {
 		name           string
@@ -136,9 +208,18 @@ func TestAuthService_ParseToken(t *testing.T) {
 		{
 			name: "changed signing key",
 			args: inputArgs{
-				username:      "username",
-				envTokenTTL:   "4",
-				envSigningKey: "ffege4g4gh4wa",
+				username:         "username",
+				generateToken:    true,
+				parserSigningKey: "ffege4g4gh4wa",
+			},
+			wantErr:        &apierror.BadTokenError,
+			wantErrMessage: "service.auth.ParseToken: (failed parse token): signature is invalid",
+		},
+		{
+			name: "malformed token",
+			args: inputArgs{
+				username:         "username",
+				parserSigningKey: "jgrh4r5ehg",
 			},
 			wantErr:        &apierror.BadTokenError,
 			wantErrMessage: "service.auth.ParseToken: (failed parse token): token contains an invalid number of segments",
@@ -148,14 +229,18 @@ func TestAuthService_ParseToken(t *testing.T) {
 	log = slog.New(
 		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
-	s := NewAuthService(log, nil)
+	os.Setenv(model.EnvAccessTokenTTLMinutes, "4")
+	generator := NewAuthService(log, nil, nil, nil, newTestKeyring(t, "jgrh4r5ehg"))
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			godotenv.Load()
-			token, errGenerate := s.GenerateToken(tt.args.username)
-			os.Setenv(model.EnvTokenTTLHours, tt.args.envTokenTTL)
-			os.Setenv(model.EnvSigningKey, tt.args.envSigningKey)
-			username, errParse := s.ParseToken(token)
+			var token string
+			if tt.args.generateToken {
+				var err error
+				token, err = generator.GenerateToken(tt.args.username, model.RoleUser)
+				assert.NoError(t, err)
+			}
+			s := NewAuthService(log, nil, nil, nil, newTestKeyring(t, tt.args.parserSigningKey))
+			claims, errParse := s.ParseToken(token)
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
 				ok := errors.As(errParse, &apiErr)
@@ -165,114 +250,507 @@ func TestAuthService_ParseToken(t *testing.T) {
 				return
 			}
 
-			assert.NoError(t, errGenerate)
 			assert.NoError(t, errParse)
-			assert.Equal(t, tt.args.username, username)
+			assert.Equal(t, tt.args.username, claims.Username)
 		})
 	}
 }
 
-func TestAuthService_generatePassword(t *testing.T) {
+func TestAuth(t *testing.T) {
 	type inputArgs struct {
-		password string
-		envSalt  string
+		username              string
+		password              string
+		envSalt               string
+		envAutoSignUp         string
+		storedPasswordHash    func() string
+		getUserOutputError    error
+		createUserOutputError error
 	}
 	tests := []struct {
 		name           string
 		args           inputArgs
+		wantCreate     bool
+		wantRehash     bool
 		wantErr        *apierror.APIError
 		wantErrMessage string
 	}{
 		{
-			name: "success",
+			name: "sign up new user",
+			args: inputArgs{
+				username:           "username",
+				password:           "15646156",
+				envAutoSignUp:      "true",
+				getUserOutputError: apierror.NewAPIErrorWithMsg(apierror.UserNotFoundError, "mock"),
+			},
+			wantCreate: true,
+		},
+		{
+			name: "unknown user with auto sign up unset",
+			args: inputArgs{
+				username:           "username",
+				password:           "15646156",
+				envAutoSignUp:      "",
+				getUserOutputError: apierror.NewAPIErrorWithMsg(apierror.UserNotFoundError, "mock"),
+			},
+			wantCreate: true,
+		},
+		{
+			name: "unknown user with auto sign up disabled",
+			args: inputArgs{
+				username:           "username",
+				password:           "15646156",
+				envAutoSignUp:      "false",
+				getUserOutputError: apierror.NewAPIErrorWithMsg(apierror.UserNotFoundError, "mock"),
+			},
+			wantErr:        &apierror.InvalidCredentialsError,
+			wantErrMessage: "service.auth.Auth: (failed sign in user): user not found: mock",
+		},
+		{
+			name: "invalid auto sign up flag",
 			args: inputArgs{
-				password: "username",
-				envSalt:  "jngvurj",
+				username:           "username",
+				password:           "15646156",
+				envAutoSignUp:      "sometimes",
+				getUserOutputError: apierror.NewAPIErrorWithMsg(apierror.UserNotFoundError, "mock"),
 			},
+			wantErr: &apierror.InternalError,
+			wantErrMessage: fmt.Sprintf("service.auth.Auth: (env %s must be boolean): "+
+				"strconv.ParseBool: parsing \"sometimes\": invalid syntax", model.EnvAuthAutoSignUp),
 		},
 		{
-			name: "empty salt",
+			name: "sign in with current hash",
 			args: inputArgs{
-				password: "username",
-				envSalt:  "",
+				username: "username",
+				password: "15646156",
+				storedPasswordHash: func() string {
+					hash, _ := NewArgon2idHasher().Hash("15646156")
+					return hash
+				},
+			},
+		},
+		{
+			name: "sign in with legacy hash upgrades it",
+			args: inputArgs{
+				username: "username",
+				password: "15646156",
+				envSalt:  "vsso9evijo",
+				storedPasswordHash: func() string {
+					hash, _ := generateLegacyPasswordHash("15646156")
+					return hash
+				},
+			},
+			wantRehash: true,
+		},
+		{
+			name: "wrong password",
+			args: inputArgs{
+				username: "username",
+				password: "wrong_password",
+				storedPasswordHash: func() string {
+					hash, _ := NewArgon2idHasher().Hash("15646156")
+					return hash
+				},
+			},
+			wantErr:        &apierror.InvalidCredentialsError,
+			wantErrMessage: "service.auth.Auth: (failed sign in user): wrong password",
+		},
+		{
+			name: "legacy hash with empty salt",
+			args: inputArgs{
+				username:           "username",
+				password:           "15646156",
+				envSalt:            "",
+				storedPasswordHash: func() string { return "legacy" },
 			},
 			wantErr:        &apierror.InternalError,
 			wantErrMessage: "salt is empty",
 		},
+		{
+			name: "err in repository.GetUser",
+			args: inputArgs{
+				username:           "username",
+				password:           "15646156",
+				getUserOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantErr:        &apierror.InternalError,
+			wantErrMessage: "mock",
+		},
+		{
+			name: "err in repository.CreateUser",
+			args: inputArgs{
+				username:              "username",
+				password:              "15646156",
+				envAutoSignUp:         "true",
+				getUserOutputError:    apierror.NewAPIErrorWithMsg(apierror.UserNotFoundError, "mock"),
+				createUserOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantCreate:     true,
+			wantErr:        &apierror.InternalError,
+			wantErrMessage: "mock",
+		},
 	}
-
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	passwordHasher, err := NewPasswordHasher(HashAlgorithmArgon2id)
+	assert.NoError(t, err)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			os.Setenv(model.EnvPasswordSalt, tt.args.envSalt)
-			passwordHash1, err1 := generatePasswordHash(tt.args.password)
+			os.Setenv(model.EnvAuthAutoSignUp, tt.args.envAutoSignUp)
+			var storedPasswordHash string
+			if tt.args.storedPasswordHash != nil {
+				storedPasswordHash = tt.args.storedPasswordHash()
+			}
+			authRepository := new(MockAuthRepository)
+			s := NewAuthService(log, authRepository, nil, passwordHasher, nil)
+			authRepository.On("GetUser", tt.args.username).
+				Return(model.AuthDB{Username: tt.args.username, PasswordHash: storedPasswordHash}, tt.args.getUserOutputError)
+			authRepository.On("CreateUser", tt.args.username, mock.Anything).Return(tt.args.createUserOutputError)
+			authRepository.On("UpdatePasswordHash", tt.args.username, mock.Anything).Return(nil)
+			err := s.Auth(model.AuthInput{Username: tt.args.username, Password: tt.args.password})
+
+			if tt.wantCreate {
+				authRepository.AssertCalled(t, "CreateUser", tt.args.username, mock.Anything)
+			} else {
+				authRepository.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			}
+			if tt.wantRehash {
+				authRepository.AssertCalled(t, "UpdatePasswordHash", tt.args.username, mock.Anything)
+			} else {
+				authRepository.AssertNotCalled(t, "UpdatePasswordHash", mock.Anything, mock.Anything)
+			}
+
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
-				ok := errors.As(err1, &apiErr)
+				ok := errors.As(err, &apiErr)
 				assert.True(t, ok)
 				assert.Equal(t, apiErr.Status, tt.wantErr.Status)
 				assert.Equal(t, apiErr.Error(),
 					fmt.Sprintf("%s: %s", tt.wantErr.Message, tt.wantErrMessage))
 				return
 			}
-			passwordHash2, err2 := generatePasswordHash(tt.args.password)
-			assert.NoError(t, err1)
-			assert.NoError(t, err2)
-			assert.Equal(t, passwordHash2, passwordHash1)
+			assert.NoError(t, err)
 		})
 	}
 }
 
-func TestAuth(t *testing.T) {
-	type inputArgs struct {
-		username        string
-		password        string
-		envSalt         string
-		authOutputError error
+func TestAuthService_Register(t *testing.T) {
+	tests := []struct {
+		name                  string
+		createUserOutputError error
+		wantErr               *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                  "user already exists",
+			createUserOutputError: apierror.NewAPIErrorWithMsg(apierror.UserAlreadyExistsError, "mock"),
+			wantErr:               &apierror.UserAlreadyExistsError,
+		},
 	}
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	passwordHasher, err := NewPasswordHasher(HashAlgorithmArgon2id)
+	assert.NoError(t, err)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authRepository := new(MockAuthRepository)
+			s := NewAuthService(log, authRepository, nil, passwordHasher, nil)
+			authRepository.On("CreateUser", "username", mock.Anything).Return(tt.createUserOutputError)
+
+			err := s.Register(model.AuthInput{Username: "username", Password: "15646156"})
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			hash, _ := authRepository.Calls[0].Arguments.Get(1).(string)
+			ok, err := passwordHasher.Verify("15646156", hash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestAuthService_ParseTokenRevoked(t *testing.T) {
+	os.Setenv(model.EnvAccessTokenTTLMinutes, "15")
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	tokenRepository := new(MockTokenRepository)
+	tokenRepository.On("IsAccessTokenRevoked", mock.Anything).Return(true, nil)
+	s := NewAuthService(log, nil, tokenRepository, nil, newTestKeyring(t, "jgrh4r5ehg"))
+
+	token, err := s.GenerateToken("username", model.RoleUser)
+	assert.NoError(t, err)
+
+	_, err = s.ParseToken(token)
+	var apiErr apierror.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, apierror.RevokedTokenError.Status, apiErr.Status)
+	assert.Equal(t, apierror.RevokedTokenError.Message, apiErr.Message)
+}
+
+func TestAuthService_GenerateTokens(t *testing.T) {
 	tests := []struct {
-		name           string
-		args           inputArgs
-		wantErr        *apierror.APIError
-		wantErrMessage string
+		name                        string
+		envRefreshTokenTTL          string
+		saveRefreshTokenOutputError error
+		wantErr                     *apierror.APIError
+	}{
+		{
+			name:               "success",
+			envRefreshTokenTTL: "720",
+		},
+		{
+			name:               "invalid refresh token TTL",
+			envRefreshTokenTTL: "month",
+			wantErr:            &apierror.InternalError,
+		},
+		{
+			name:                        "err in repository.SaveRefreshToken",
+			envRefreshTokenTTL:          "720",
+			saveRefreshTokenOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantErr:                     &apierror.InternalError,
+		},
+	}
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(model.EnvAccessTokenTTLMinutes, "15")
+			os.Setenv(model.EnvRefreshTokenTTLHours, tt.envRefreshTokenTTL)
+			authRepository := new(MockAuthRepository)
+			authRepository.On("GetUser", "username").Return(model.AuthDB{Username: "username", Role: model.RoleUser}, nil)
+			tokenRepository := new(MockTokenRepository)
+			tokenRepository.On("SaveRefreshToken", mock.Anything).Return(tt.saveRefreshTokenOutputError)
+			s := NewAuthService(log, authRepository, tokenRepository, nil, newTestKeyring(t, "jgrh4r5ehg"))
+
+			tokens, err := s.GenerateTokens("username")
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, tokens.Token)
+			assert.NotEmpty(t, tokens.RefreshToken)
+
+			saved, _ := tokenRepository.Calls[0].Arguments.Get(0).(model.RefreshToken)
+			assert.Equal(t, "username", saved.Username)
+			assert.Equal(t, hashRefreshToken(tokens.RefreshToken), saved.TokenHash)
+			assert.NotEmpty(t, saved.FamilyID)
+		})
+	}
+}
+
+func TestAuthService_RefreshTokens(t *testing.T) {
+	tests := []struct {
+		name                        string
+		rotateOutputUsername        string
+		rotateRefreshTokenOutputErr error
+		wantErr                     *apierror.APIError
+	}{
+		{
+			name:                 "success",
+			rotateOutputUsername: "username",
+		},
+		{
+			name:                        "reused refresh token",
+			rotateRefreshTokenOutputErr: apierror.NewAPIErrorWithMsg(apierror.RefreshTokenReusedError, "mock"),
+			wantErr:                     &apierror.RefreshTokenReusedError,
+		},
+	}
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(model.EnvAccessTokenTTLMinutes, "15")
+			os.Setenv(model.EnvRefreshTokenTTLHours, "720")
+			tokenRepository := new(MockTokenRepository)
+			tokenRepository.On("RotateRefreshToken", hashRefreshToken("old_refresh_token"), mock.Anything).
+				Return(tt.rotateOutputUsername, tt.rotateRefreshTokenOutputErr)
+			tokenRepository.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+			authRepository := new(MockAuthRepository)
+			authRepository.On("GetUser", "username").Return(model.AuthDB{Username: "username", Role: model.RoleAuditor}, nil)
+			s := NewAuthService(log, authRepository, tokenRepository, nil, newTestKeyring(t, "jgrh4r5ehg"))
+
+			tokens, err := s.RefreshTokens("old_refresh_token")
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEqual(t, "old_refresh_token", tokens.RefreshToken)
+
+			claims, err := s.ParseToken(tokens.Token)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.rotateOutputUsername, claims.Username)
+			assert.Equal(t, model.RoleAuditor, claims.Role)
+		})
+	}
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	expiresAt := time.Now().Add(time.Minute)
+	claims := model.TokenClaims{Username: "username", TokenID: "jti", ExpiresAt: expiresAt}
+	tests := []struct {
+		name         string
+		refreshToken string
+		wantRevoke   bool
+	}{
+		{
+			name: "access token only",
+		},
+		{
+			name:         "with refresh token",
+			refreshToken: "refresh_token",
+			wantRevoke:   true,
+		},
+	}
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenRepository := new(MockTokenRepository)
+			tokenRepository.On("RevokeAccessToken", "jti", expiresAt).Return(nil)
+			tokenRepository.On("RevokeRefreshTokenFamily", "username", hashRefreshToken(tt.refreshToken)).Return(nil)
+			s := NewAuthService(log, nil, tokenRepository, nil, newTestKeyring(t, "jgrh4r5ehg"))
+
+			assert.NoError(t, s.Logout(claims, tt.refreshToken))
+
+			tokenRepository.AssertCalled(t, "RevokeAccessToken", "jti", expiresAt)
+			if tt.wantRevoke {
+				tokenRepository.AssertCalled(t, "RevokeRefreshTokenFamily", "username", hashRefreshToken(tt.refreshToken))
+			} else {
+				tokenRepository.AssertNotCalled(t, "RevokeRefreshTokenFamily", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAuthService_ParseTokenWithoutRole(t *testing.T) {
+	os.Setenv(model.EnvAccessTokenTTLMinutes, "15")
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	tokenRepository := new(MockTokenRepository)
+	tokenRepository.On("IsAccessTokenRevoked", mock.Anything).Return(false, nil)
+	keyring := newTestKeyring(t, "jgrh4r5ehg")
+	s := NewAuthService(log, nil, tokenRepository, nil, keyring)
+
+	token, err := keyring.Sign(jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		Id:        "jti",
+		Subject:   "username",
+	})
+	assert.NoError(t, err)
+
+	claims, err := s.ParseToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleUser, claims.Role)
+}
+
+func TestAuthService_SetRole(t *testing.T) {
+	tests := []struct {
+		name                  string
+		updateRoleOutputError error
+		wantErr               *apierror.APIError
 	}{
 		{
 			name: "success",
-			args: inputArgs{
-				username: "username",
-				password: "15646156",
-				envSalt:  "vsso9evijo",
-			},
 		},
 		{
-			name: "empty salt",
-			args: inputArgs{
-				username: "username",
-				password: "15646156",
-				envSalt:  "",
-			},
-			wantErr:        &apierror.InternalError,
-			wantErrMessage: "salt is empty",
+			name:                  "unknown user",
+			updateRoleOutputError: apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, "mock"),
+			wantErr:               &apierror.NoSuchUserError,
 		},
 	}
 	var log *slog.Logger
 	log = slog.New(
 		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
-	authRepository := new(MockAuthRepository)
-	s := NewAuthService(log, authRepository)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			os.Setenv(model.EnvPasswordSalt, tt.args.envSalt)
-			authRepository.On("Auth", mock.Anything, mock.Anything).Return(tt.args.authOutputError)
-			err := s.Auth(model.AuthInput{Username: tt.args.username, Password: tt.args.password})
+			authRepository := new(MockAuthRepository)
+			authRepository.On("UpdateRole", "username", model.RoleAdmin).Return(tt.updateRoleOutputError)
+			s := NewAuthService(log, authRepository, nil, nil, nil)
+
+			err := s.SetRole("username", model.RoleAdmin)
 
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
 				ok := errors.As(err, &apiErr)
 				assert.True(t, ok)
-				assert.Equal(t, apiErr.Status, tt.wantErr.Status)
-				assert.Equal(t, apiErr.Error(),
-					fmt.Sprintf("%s: %s", tt.wantErr.Message, tt.wantErrMessage))
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthService_SetManager(t *testing.T) {
+	tests := []struct {
+		name                     string
+		updateManagerOutputError error
+		wantErr                  *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                     "unknown manager",
+			updateManagerOutputError: apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, "mock"),
+			wantErr:                  &apierror.NoSuchUserError,
+		},
+	}
+	var log *slog.Logger
+	log = slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authRepository := new(MockAuthRepository)
+			authRepository.On("UpdateManager", "username", "boss").Return(tt.updateManagerOutputError)
+			s := NewAuthService(log, authRepository, nil, nil, nil)
+
+			err := s.SetManager("username", "boss")
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
 				return
 			}
 			assert.NoError(t, err)
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type CatalogRepository interface {
+	ListItems() ([]model.CatalogItem, error)
+	GetItems(filter model.ItemsFilter) ([]model.ShopItem, int, error)
+	GetItem(itemType string) (model.ShopItem, error)
+	GetCatalogItem(itemType string) (model.CatalogItem, error)
+	CreateItem(item model.CatalogItem) error
+	UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error)
+	ArchiveItem(itemType string) error
+	RestockItem(itemType string, quantity int) (model.CatalogItem, error)
+	SetStock(itemType string, stock *int) (model.CatalogItem, error)
+}
+
+type CatalogService struct {
+	logger            *slog.Logger
+	catalogRepository CatalogRepository
+}
+
+func NewCatalogService(logger *slog.Logger, c CatalogRepository) *CatalogService {
+	return &CatalogService{
+		logger:            logger,
+		catalogRepository: c,
+	}
+}
+
+func (c *CatalogService) ListItems() ([]model.CatalogItem, error) {
+	const op = "service.catalog.ListItems"
+
+	items, err := c.catalogRepository.ListItems()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return items, nil
+}
+
+func (c *CatalogService) GetItems(filter model.ItemsFilter) (model.ItemsPage, error) {
+	const op = "service.catalog.GetItems"
+
+	items, total, err := c.catalogRepository.GetItems(filter)
+	if err != nil {
+		return model.ItemsPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return model.ItemsPage{
+		Items:  items,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
+
+func (c *CatalogService) GetItem(itemType string) (model.ShopItem, error) {
+	const op = "service.catalog.GetItem"
+
+	item, err := c.catalogRepository.GetItem(itemType)
+	if err != nil {
+		return model.ShopItem{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return item, nil
+}
+
+func (c *CatalogService) GetCatalogItem(itemType string) (model.CatalogItem, error) {
+	const op = "service.catalog.GetCatalogItem"
+
+	item, err := c.catalogRepository.GetCatalogItem(itemType)
+	if err != nil {
+		return model.CatalogItem{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return item, nil
+}
+
+func (c *CatalogService) CreateItem(item model.CatalogItem) error {
+	const op = "service.catalog.CreateItem"
+
+	if err := c.catalogRepository.CreateItem(item); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *CatalogService) UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error) {
+	const op = "service.catalog.UpdateItem"
+
+	item, err := c.catalogRepository.UpdateItem(itemType, update)
+	if err != nil {
+		return model.CatalogItem{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return item, nil
+}
+
+func (c *CatalogService) ArchiveItem(itemType string) error {
+	const op = "service.catalog.ArchiveItem"
+
+	if err := c.catalogRepository.ArchiveItem(itemType); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (c *CatalogService) RestockItem(itemType string, quantity int) (model.CatalogItem, error) {
+	const op = "service.catalog.RestockItem"
+
+	item, err := c.catalogRepository.RestockItem(itemType, quantity)
+	if err != nil {
+		return model.CatalogItem{}, fmt.Errorf("%s: %w", op, err)
+	}
+	c.warnLowStock(item)
+
+	return item, nil
+}
+
+func (c *CatalogService) SetStock(itemType string, stock *int) (model.CatalogItem, error) {
+	const op = "service.catalog.SetStock"
+
+	item, err := c.catalogRepository.SetStock(itemType, stock)
+	if err != nil {
+		return model.CatalogItem{}, fmt.Errorf("%s: %w", op, err)
+	}
+	c.warnLowStock(item)
+
+	return item, nil
+}
+
+func (c *CatalogService) warnLowStock(item model.CatalogItem) {
+	if item.LowStock {
+		c.logger.Warn("item is still low on stock",
+			slog.String("item", item.Type), slog.Int("stock", *item.Stock), slog.Int("threshold", item.LowStockThreshold))
+	}
+}
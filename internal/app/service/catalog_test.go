@@ -0,0 +1,255 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockCatalogRepository struct {
+	mock.Mock
+}
+
+func (m *MockCatalogRepository) ListItems() ([]model.CatalogItem, error) {
+	args := m.Called()
+	items, _ := args.Get(0).([]model.CatalogItem)
+	return items, args.Error(1)
+}
+
+func (m *MockCatalogRepository) GetItems(filter model.ItemsFilter) ([]model.ShopItem, int, error) {
+	args := m.Called(filter)
+	items, _ := args.Get(0).([]model.ShopItem)
+	return items, args.Int(1), args.Error(2)
+}
+
+func (m *MockCatalogRepository) GetItem(itemType string) (model.ShopItem, error) {
+	args := m.Called(itemType)
+	item, _ := args.Get(0).(model.ShopItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogRepository) GetCatalogItem(itemType string) (model.CatalogItem, error) {
+	args := m.Called(itemType)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogRepository) CreateItem(item model.CatalogItem) error {
+	args := m.Called(item)
+	return args.Error(0)
+}
+
+func (m *MockCatalogRepository) UpdateItem(itemType string, update model.CatalogItemUpdate) (model.CatalogItem, error) {
+	args := m.Called(itemType, update)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogRepository) ArchiveItem(itemType string) error {
+	args := m.Called(itemType)
+	return args.Error(0)
+}
+
+func (m *MockCatalogRepository) RestockItem(itemType string, quantity int) (model.CatalogItem, error) {
+	args := m.Called(itemType, quantity)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func (m *MockCatalogRepository) SetStock(itemType string, stock *int) (model.CatalogItem, error) {
+	args := m.Called(itemType, stock)
+	item, _ := args.Get(0).(model.CatalogItem)
+	return item, args.Error(1)
+}
+
+func TestNewCatalogService(t *testing.T) {
+	var log *slog.Logger
+	catalogRepository := new(MockCatalogRepository)
+
+	s := NewCatalogService(log, catalogRepository)
+	assert.Equal(t, &CatalogService{
+		logger:            log,
+		catalogRepository: catalogRepository}, s)
+}
+
+func TestCatalogService_GetItems(t *testing.T) {
+	filter := model.ItemsFilter{Sort: model.ItemsSortPrice, Limit: 2, Offset: 4}
+	items := []model.ShopItem{{Type: "cup", Price: 20, Available: true}}
+
+	tests := []struct {
+		name                string
+		getItemsOutputError error
+		wantPage            model.ItemsPage
+		wantErr             *apierror.APIError
+	}{
+		{
+			name:     "success",
+			wantPage: model.ItemsPage{Items: items, Total: 5, Limit: 2, Offset: 4},
+		},
+		{
+			name:                "err in repository.GetItems",
+			getItemsOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantErr:             &apierror.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			catalogRepository := new(MockCatalogRepository)
+			s := NewCatalogService(log, catalogRepository)
+			catalogRepository.On("GetItems", filter).Return(items, 5, tt.getItemsOutputError)
+
+			page, err := s.GetItems(filter)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantPage, page)
+		})
+	}
+}
+
+func TestCatalogService_UpdateItem(t *testing.T) {
+	price := 100
+	tests := []struct {
+		name                  string
+		updateItemOutputItem  model.CatalogItem
+		updateItemOutputError error
+		wantErr               *apierror.APIError
+	}{
+		{
+			name:                 "success",
+			updateItemOutputItem: model.CatalogItem{Type: "cup", Price: price, Active: true},
+		},
+		{
+			name:                  "unknown item",
+			updateItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:               &apierror.ItemNotFoundError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			catalogRepository := new(MockCatalogRepository)
+			s := NewCatalogService(log, catalogRepository)
+			update := model.CatalogItemUpdate{Price: &price}
+			catalogRepository.On("UpdateItem", "cup", update).
+				Return(tt.updateItemOutputItem, tt.updateItemOutputError)
+
+			item, err := s.UpdateItem("cup", update)
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.updateItemOutputItem, item)
+		})
+	}
+}
+
+func TestCatalogService_ArchiveItem(t *testing.T) {
+	tests := []struct {
+		name                   string
+		archiveItemOutputError error
+		wantErr                *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                   "unknown item",
+			archiveItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:                &apierror.ItemNotFoundError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			catalogRepository := new(MockCatalogRepository)
+			s := NewCatalogService(log, catalogRepository)
+			catalogRepository.On("ArchiveItem", "cup").Return(tt.archiveItemOutputError)
+
+			err := s.ArchiveItem("cup")
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCatalogService_RestockItem(t *testing.T) {
+	stock, lowStock := 30, 2
+
+	tests := []struct {
+		name                   string
+		restockItemOutputItem  model.CatalogItem
+		restockItemOutputError error
+		wantErr                *apierror.APIError
+	}{
+		{
+			name:                  "success",
+			restockItemOutputItem: model.CatalogItem{Type: "hoody", Stock: &stock, LowStockThreshold: 5},
+		},
+		{
+			name: "still low on stock",
+			restockItemOutputItem: model.CatalogItem{
+				Type: "hoody", Stock: &lowStock, LowStockThreshold: 5, LowStock: true},
+		},
+		{
+			name:                   "unknown item",
+			restockItemOutputError: apierror.NewAPIErrorWithMsg(apierror.ItemNotFoundError, "mock"),
+			wantErr:                &apierror.ItemNotFoundError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			catalogRepository := new(MockCatalogRepository)
+			s := NewCatalogService(log, catalogRepository)
+			catalogRepository.On("RestockItem", "hoody", 1).
+				Return(tt.restockItemOutputItem, tt.restockItemOutputError)
+
+			item, err := s.RestockItem("hoody", 1)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.restockItemOutputItem, item)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type CoinRequestRepository interface {
+	CreateCoinRequest(request model.CoinRequest) (model.CoinRequest, error)
+	GetCoinRequest(id int64) (model.CoinRequest, error)
+	GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error)
+	AcceptCoinRequest(acceptance model.CoinRequestAcceptance, key *model.IdempotencyKey) (model.CoinRequest, error)
+	DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error)
+}
+
+type CoinRequestService struct {
+	logger                *slog.Logger
+	coinRequestRepository CoinRequestRepository
+}
+
+func NewCoinRequestService(logger *slog.Logger, c CoinRequestRepository) *CoinRequestService {
+	return &CoinRequestService{
+		logger:                logger,
+		coinRequestRepository: c,
+	}
+}
+
+func (c *CoinRequestService) CreateCoinRequest(requester string, input model.CoinRequestInput) (model.CoinRequest, error) {
+	const op = "service.coinrequest.CreateCoinRequest"
+
+	request, err := c.coinRequestRepository.CreateCoinRequest(model.CoinRequest{
+		Requester: requester,
+		Payer:     input.FromUser,
+		Amount:    input.Amount,
+		Message:   input.Message,
+		Category:  input.Category,
+	})
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return request, nil
+}
+
+func (c *CoinRequestService) GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error) {
+	const op = "service.coinrequest.GetCoinRequests"
+
+	requests, err := c.coinRequestRepository.GetCoinRequests(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return requests, nil
+}
+
+// AcceptCoinRequest pays the request from the payer. The payment is a transfer like sendCoin,
+// so it's limited the same way and waits for an approval if it's above the approval threshold.
+func (c *CoinRequestService) AcceptCoinRequest(payer string, id int64, key *model.IdempotencyKey) (model.CoinRequest, error) {
+	const op = "service.coinrequest.AcceptCoinRequest"
+
+	limits, err := getTransferLimits()
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	threshold, err := getApprovalThreshold()
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the amount of a request never changes, so it can be checked against the threshold before the request is locked
+	request, err := c.coinRequestRepository.GetCoinRequest(id)
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if request.Payer != payer {
+		return model.CoinRequest{}, apierror.NewAPIErrorWithMsg(apierror.CoinRequestNotFoundError,
+			op+": coin request is made to another user")
+	}
+
+	acceptance := model.CoinRequestAcceptance{ID: id, Payer: payer, Limits: limits}
+	if threshold > 0 && request.Amount > threshold {
+		expiresAt, err := getApprovalExpiry()
+		if err != nil {
+			return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+		}
+		acceptance.ApprovalExpiresAt = &expiresAt
+
+		if key != nil {
+			key.StatusCode = http.StatusAccepted
+		}
+	}
+
+	request, err = c.coinRequestRepository.AcceptCoinRequest(acceptance, key)
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return request, nil
+}
+
+func (c *CoinRequestService) DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error) {
+	const op = "service.coinrequest.DeclineCoinRequest"
+
+	request, err := c.coinRequestRepository.DeclineCoinRequest(payer, id)
+	if err != nil {
+		return model.CoinRequest{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return request, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockCoinRequestRepository struct {
+	mock.Mock
+}
+
+func (m *MockCoinRequestRepository) CreateCoinRequest(request model.CoinRequest) (model.CoinRequest, error) {
+	args := m.Called(request)
+	created, _ := args.Get(0).(model.CoinRequest)
+	return created, args.Error(1)
+}
+
+func (m *MockCoinRequestRepository) GetCoinRequest(id int64) (model.CoinRequest, error) {
+	args := m.Called(id)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func (m *MockCoinRequestRepository) GetCoinRequests(filter model.CoinRequestsFilter) ([]model.CoinRequest, error) {
+	args := m.Called(filter)
+	requests, _ := args.Get(0).([]model.CoinRequest)
+	return requests, args.Error(1)
+}
+
+func (m *MockCoinRequestRepository) AcceptCoinRequest(acceptance model.CoinRequestAcceptance,
+	key *model.IdempotencyKey) (model.CoinRequest, error) {
+	args := m.Called(acceptance, key)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func (m *MockCoinRequestRepository) DeclineCoinRequest(payer string, id int64) (model.CoinRequest, error) {
+	args := m.Called(payer, id)
+	request, _ := args.Get(0).(model.CoinRequest)
+	return request, args.Error(1)
+}
+
+func TestNewCoinRequestService(t *testing.T) {
+	var log *slog.Logger
+	coinRequestRepository := new(MockCoinRequestRepository)
+
+	s := NewCoinRequestService(log, coinRequestRepository)
+	assert.Equal(t, &CoinRequestService{
+		logger:                log,
+		coinRequestRepository: coinRequestRepository}, s)
+}
+
+func TestCoinRequestService_AcceptCoinRequest(t *testing.T) {
+	type inputArgs struct {
+		payer                   string
+		request                 model.CoinRequest
+		getCoinRequestOutputErr error
+		key                     *model.IdempotencyKey
+		envThreshold            string
+	}
+	tests := []struct {
+		name         string
+		args         inputArgs
+		wantApproval bool
+		wantErr      *apierror.APIError
+	}{
+		{
+			name: "paid right away",
+			args: inputArgs{
+				payer:   "payer",
+				request: model.CoinRequest{ID: 1, Requester: "requester", Payer: "payer", Amount: 100},
+			},
+		},
+		{
+			name: "above approval threshold",
+			args: inputArgs{
+				payer:        "payer",
+				request:      model.CoinRequest{ID: 1, Requester: "requester", Payer: "payer", Amount: 1001},
+				key:          &model.IdempotencyKey{Username: "payer", Key: "key", StatusCode: 200},
+				envThreshold: "1000",
+			},
+			wantApproval: true,
+		},
+		{
+			name: "request to another user",
+			args: inputArgs{
+				payer:   "stranger",
+				request: model.CoinRequest{ID: 1, Requester: "requester", Payer: "payer", Amount: 100},
+			},
+			wantErr: &apierror.CoinRequestNotFoundError,
+		},
+		{
+			name: "unknown request",
+			args: inputArgs{
+				payer:                   "payer",
+				getCoinRequestOutputErr: apierror.NewAPIErrorWithMsg(apierror.CoinRequestNotFoundError, "mock"),
+			},
+			wantErr: &apierror.CoinRequestNotFoundError,
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(model.EnvIdempotencyKeyTTL, "24")
+			t.Setenv(model.EnvApprovalThreshold, tt.args.envThreshold)
+			t.Setenv(model.EnvApprovalTTL, "48")
+			coinRequestRepository := new(MockCoinRequestRepository)
+			s := NewCoinRequestService(log, coinRequestRepository)
+			coinRequestRepository.On("GetCoinRequest", int64(1)).Return(tt.args.request, tt.args.getCoinRequestOutputErr)
+			coinRequestRepository.On("AcceptCoinRequest", mock.Anything, tt.args.key).
+				Return(model.CoinRequest{ID: 1, Status: model.CoinRequestStatusAccepted}, nil)
+
+			_, err := s.AcceptCoinRequest(tt.args.payer, 1, tt.args.key)
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				coinRequestRepository.AssertNotCalled(t, "AcceptCoinRequest", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			coinRequestRepository.AssertCalled(t, "AcceptCoinRequest",
+				mock.MatchedBy(func(acceptance model.CoinRequestAcceptance) bool {
+					if acceptance.ID != 1 || acceptance.Payer != tt.args.payer {
+						return false
+					}
+					if !tt.wantApproval {
+						return acceptance.ApprovalExpiresAt == nil
+					}
+					return acceptance.ApprovalExpiresAt != nil &&
+						acceptance.ApprovalExpiresAt.Sub(time.Now().Add(48*time.Hour)).Abs() < time.Minute
+				}), tt.args.key)
+			if tt.wantApproval {
+				assert.Equal(t, 202, tt.args.key.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard five-field cron expression: minute, hour, day of month, month and day of week.
+// Each field is a bit set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// as in cron, a transfer fires when either of the day fields matches if both of them are restricted
+	domRestricted, dowRestricted bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// cronSearchYears bounds the search for the next run, so expressions like "0 0 30 2 *" end it.
+const cronSearchYears = 5
+
+func parseCron(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("cron must have %d fields", len(cronFields))
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return cronSchedule{}, err
+		}
+		sets[i] = set
+	}
+
+	// 7 is another name for Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return cronSchedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parseCronField parses a comma-separated list of "*", "a" or "a-b", each optionally followed by "/step".
+// "a/step" runs from a to the end of the range.
+func parseCronField(field string, bounds cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", bounds.name, part)
+			}
+			rangePart = part[:i]
+		}
+
+		from, to := bounds.min, bounds.max
+		if rangePart != "*" {
+			values := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(values[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %s field %q", bounds.name, part)
+			}
+			switch {
+			case len(values) == 2:
+				if to, err = strconv.Atoi(values[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %s field %q", bounds.name, part)
+				}
+			case step == 1:
+				to = from
+			}
+		}
+
+		if from < bounds.min || to > bounds.max || from > to {
+			return 0, fmt.Errorf("%s field %q is out of range %d-%d", bounds.name, part, bounds.min, bounds.max)
+		}
+
+		for value := from; value <= to; value += step {
+			set |= 1 << value
+		}
+	}
+
+	return set, nil
+}
+
+// next returns the first time after t the schedule fires, or false if it doesn't fire in the next years.
+func (c cronSchedule) next(t time.Time) (time.Time, bool) {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	domMatches := c.dom&(1<<uint(t.Day())) != 0
+	dowMatches := c.dow&(1<<uint(t.Weekday())) != 0
+
+	if c.domRestricted && c.dowRestricted {
+		return domMatches || dowMatches
+	}
+	return domMatches && dowMatches
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronSchedule_next(t *testing.T) {
+	// Friday
+	from := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expr      string
+		want      time.Time
+		wantNever bool
+	}{
+		{
+			name: "every minute",
+			expr: "* * * * *",
+			want: time.Date(2024, time.March, 15, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			name: "every Monday at 9",
+			expr: "0 9 * * 1",
+			want: time.Date(2024, time.March, 18, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Sunday as 7",
+			expr: "0 9 * * 7",
+			want: time.Date(2024, time.March, 17, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "every 15 minutes",
+			expr: "*/15 * * * *",
+			want: time.Date(2024, time.March, 15, 10, 45, 0, 0, time.UTC),
+		},
+		{
+			name: "working hours list and range",
+			expr: "0 9,18 * * 1-5",
+			want: time.Date(2024, time.March, 15, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "first of the month",
+			expr: "0 0 1 * *",
+			want: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "day of month or day of week",
+			expr: "0 12 20 * 1",
+			want: time.Date(2024, time.March, 18, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "leap day",
+			expr: "0 0 29 2 *",
+			want: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "never",
+			expr:      "0 0 30 2 *",
+			wantNever: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			assert.NoError(t, err)
+
+			next, ok := schedule.next(from)
+			if tt.wantNever {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, next)
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "steps from a value", expr: "5/20 */2 1-15/7 1,6 0-6"},
+		{name: "too few fields", expr: "0 9 * *", wantErr: true},
+		{name: "out of range", expr: "60 * * * *", wantErr: true},
+		{name: "reversed range", expr: "0 18-9 * * *", wantErr: true},
+		{name: "zero step", expr: "*/0 * * * *", wantErr: true},
+		{name: "not a number", expr: "0 9 * * mon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func (s *ShopService) GetHistory(filter model.HistoryFilter) (model.HistoryPage, error) {
+	const op = "service.history.GetHistory"
+
+	page, err := s.historyRepository.GetHistory(filter)
+	if err != nil {
+		return model.HistoryPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return page, nil
+}
+
+// ExportHistory passes the exported transfers to emit as they are read from the database.
+func (s *ShopService) ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error {
+	const op = "service.history.ExportHistory"
+
+	if err := s.historyRepository.ExportHistory(filter, emit); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
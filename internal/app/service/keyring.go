@@ -0,0 +1,266 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+// legacyHMACKeyID identifies the SIGNING_KEY secret. Tokens without a kid header
+// were issued before the keyring existed and are verified with this key.
+const legacyHMACKeyID = "hs256"
+
+// SigningKey is a JWT key. Keys without PrivateKey can only verify tokens,
+// which is how retired keys are kept around until their tokens expire.
+type SigningKey struct {
+	KID        string
+	Method     jwt.SigningMethod
+	PrivateKey interface{}
+	PublicKey  interface{}
+}
+
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeyring(activeKID string, keys ...SigningKey) (*Keyring, error) {
+	k := &Keyring{
+		keys: make(map[string]*SigningKey, len(keys)),
+	}
+
+	for i := range keys {
+		if _, ok := k.keys[keys[i].KID]; ok {
+			return nil, fmt.Errorf("duplicate key id: %s", keys[i].KID)
+		}
+		k.keys[keys[i].KID] = &keys[i]
+	}
+
+	active, ok := k.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKID)
+	}
+	if active.PrivateKey == nil {
+		return nil, fmt.Errorf("active key %q has no private key", activeKID)
+	}
+	k.active = active
+
+	return k, nil
+}
+
+// LoadKeyring builds the keyring from SIGNING_KEY and the PEM files in JWT_KEYS_DIR.
+// Every <kid>.pem file holds either a PKCS#8 Ed25519/RSA private key or a PKIX public key.
+// JWT_ACTIVE_KID selects the signing key and may be omitted when SIGNING_KEY is the only key.
+func LoadKeyring() (*Keyring, error) {
+	var keys []SigningKey
+
+	if secret := os.Getenv(model.EnvSigningKey); secret != "" {
+		keys = append(keys, SigningKey{
+			KID:        legacyHMACKeyID,
+			Method:     jwt.SigningMethodHS256,
+			PrivateKey: []byte(secret),
+			PublicKey:  []byte(secret),
+		})
+	}
+
+	if dir := os.Getenv(model.EnvJWTKeysDir); dir != "" {
+		dirKeys, err := loadKeysDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, dirKeys...)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys: set %s or %s", model.EnvSigningKey, model.EnvJWTKeysDir)
+	}
+
+	activeKID := os.Getenv(model.EnvJWTActiveKID)
+	if activeKID == "" {
+		activeKID = legacyHMACKeyID
+	}
+
+	return NewKeyring(activeKID, keys...)
+}
+
+// loadKeysDir reads the keys of the directory. A private key is usually kept next to its public key
+// as <kid>.pem and <kid>.pub.pem, such pairs are merged into the private key, which already carries
+// the public one.
+func loadKeysDir(dir string) ([]SigningKey, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("can't list keys in %s: %w", dir, err)
+	}
+
+	keys := make([]SigningKey, 0, len(files))
+	indexes := make(map[string]int, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("can't read key %s: %w", file, err)
+		}
+
+		kid := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")
+		key, err := ParseSigningKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse key %s: %w", file, err)
+		}
+
+		i, ok := indexes[kid]
+		if !ok {
+			indexes[kid] = len(keys)
+			keys = append(keys, key)
+			continue
+		}
+		if merged, ok := mergeKeyPair(keys[i], key); ok {
+			keys[i] = merged
+			continue
+		}
+		return nil, fmt.Errorf("duplicate key id: %s", kid)
+	}
+
+	return keys, nil
+}
+
+// mergeKeyPair merges a private key and the public key of the same pair, in either order.
+func mergeKeyPair(a, b SigningKey) (SigningKey, bool) {
+	if a.PrivateKey == nil {
+		a, b = b, a
+	}
+	if a.PrivateKey == nil || b.PrivateKey != nil {
+		return SigningKey{}, false
+	}
+
+	public, ok := a.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(b.PublicKey) {
+		return SigningKey{}, false
+	}
+
+	return a, true
+}
+
+// ParseSigningKey parses a PEM encoded Ed25519 or RSA key. The signing method
+// is derived from the key type: EdDSA for Ed25519 and RS256 for RSA.
+func ParseSigningKey(kid string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM block found")
+	}
+
+	var (
+		private interface{}
+		public  interface{}
+		err     error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	switch key := private.(type) {
+	case ed25519.PrivateKey:
+		public = key.Public()
+	case *rsa.PrivateKey:
+		public = &key.PublicKey
+	}
+
+	switch public.(type) {
+	case ed25519.PublicKey:
+		return SigningKey{KID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: private, PublicKey: public}, nil
+	case *rsa.PublicKey:
+		return SigningKey{KID: kid, Method: jwt.SigningMethodRS256, PrivateKey: private, PublicKey: public}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported key type: %T", public)
+	}
+}
+
+// Sign signs claims with the active key and puts its id into the kid header.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.Method, claims)
+	token.Header["kid"] = k.active.KID
+
+	return token.SignedString(k.active.PrivateKey)
+}
+
+// Keyfunc resolves the verification key by the kid header for jwt.Parse.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	const op = "service.keyring.Keyfunc"
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = legacyHMACKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, apierror.NewAPIErrorWithMsg(apierror.BadTokenError, op+": (failed parse token): unknown key id")
+	}
+
+	// the algorithm must come from the key, never from the token, otherwise
+	// a public key could be passed off as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, apierror.NewAPIErrorWithMsg(apierror.BadTokenError, op+": (failed parse token): invalid signing method")
+	}
+
+	return key.PublicKey, nil
+}
+
+// JWKS returns the public keys of the keyring. HMAC secrets are never published.
+func (k *Keyring) JWKS() model.JWKS {
+	jwks := model.JWKS{
+		Keys: make([]model.JWK, 0, len(k.keys)),
+	}
+
+	for _, key := range k.keys {
+		jwk := model.JWK{
+			KeyID:     key.KID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+		}
+
+		switch public := key.PublicKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func newEd25519Key(t *testing.T, kid string) SigningKey {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	return SigningKey{KID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: private, PublicKey: public}
+}
+
+func newRSAKey(t *testing.T, kid string) SigningKey {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	return SigningKey{KID: kid, Method: jwt.SigningMethodRS256, PrivateKey: private, PublicKey: &private.PublicKey}
+}
+
+func parseWithKeyring(k *Keyring, token string) (*jwt.StandardClaims, error) {
+	claims := &jwt.StandardClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, k.Keyfunc)
+	return claims, err
+}
+
+func TestNewKeyring(t *testing.T) {
+	ed := newEd25519Key(t, "ed-1")
+	verifyOnly := SigningKey{KID: "ed-0", Method: jwt.SigningMethodEdDSA, PublicKey: ed.PublicKey}
+
+	tests := []struct {
+		name      string
+		activeKID string
+		keys      []SigningKey
+		wantErr   bool
+	}{
+		{
+			name:      "success",
+			activeKID: "ed-1",
+			keys:      []SigningKey{ed, verifyOnly},
+		},
+		{
+			name:      "unknown active key",
+			activeKID: "ed-2",
+			keys:      []SigningKey{ed},
+			wantErr:   true,
+		},
+		{
+			name:      "active key without private part",
+			activeKID: "ed-0",
+			keys:      []SigningKey{ed, verifyOnly},
+			wantErr:   true,
+		},
+		{
+			name:      "duplicate key id",
+			activeKID: "ed-1",
+			keys:      []SigningKey{ed, ed},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.activeKID, tt.keys...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestKeyring_SignVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		key  SigningKey
+	}{
+		{
+			name: "EdDSA",
+			key:  newEd25519Key(t, "ed-1"),
+		},
+		{
+			name: "RS256",
+			key:  newRSAKey(t, "rsa-1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyring(tt.key.KID, tt.key)
+			assert.NoError(t, err)
+
+			token, err := k.Sign(jwt.StandardClaims{Subject: "username", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+			assert.NoError(t, err)
+
+			parsed, _ := jwt.Parse(token, nil)
+			assert.Equal(t, tt.key.KID, parsed.Header["kid"])
+			assert.Equal(t, tt.key.Method.Alg(), parsed.Header["alg"])
+
+			claims, err := parseWithKeyring(k, token)
+			assert.NoError(t, err)
+			assert.Equal(t, "username", claims.Subject)
+		})
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey := newEd25519Key(t, "ed-1")
+	newKey := newEd25519Key(t, "ed-2")
+
+	oldKeyring, err := NewKeyring(oldKey.KID, oldKey)
+	assert.NoError(t, err)
+	token, err := oldKeyring.Sign(jwt.StandardClaims{Subject: "username"})
+	assert.NoError(t, err)
+
+	// the old key is retired: only its public part is left for verification
+	rotated, err := NewKeyring(newKey.KID, newKey,
+		SigningKey{KID: oldKey.KID, Method: oldKey.Method, PublicKey: oldKey.PublicKey})
+	assert.NoError(t, err)
+	_, err = parseWithKeyring(rotated, token)
+	assert.NoError(t, err)
+
+	// once the old key is dropped its tokens are rejected
+	dropped, err := NewKeyring(newKey.KID, newKey)
+	assert.NoError(t, err)
+	_, err = parseWithKeyring(dropped, token)
+	assert.Error(t, err)
+}
+
+func TestKeyring_RejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey := newRSAKey(t, "rsa-1")
+	k, err := NewKeyring(rsaKey.KID, rsaKey)
+	assert.NoError(t, err)
+
+	// an HS256 token "signed" with the public key must not verify against the RSA key
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.PublicKey)
+	assert.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Subject: "admin"})
+	forged.Header["kid"] = rsaKey.KID
+	token, err := forged.SignedString(publicDER)
+	assert.NoError(t, err)
+
+	_, err = parseWithKeyring(k, token)
+	assert.Error(t, err)
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	ed := newEd25519Key(t, "ed-1")
+	rsaKey := newRSAKey(t, "rsa-1")
+	hmac := SigningKey{KID: legacyHMACKeyID, Method: jwt.SigningMethodHS256, PrivateKey: []byte("s"), PublicKey: []byte("s")}
+
+	k, err := NewKeyring(ed.KID, ed, rsaKey, hmac)
+	assert.NoError(t, err)
+
+	jwks := k.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, model.JWK{
+		KeyType:   "OKP",
+		KeyID:     "ed-1",
+		Use:       "sig",
+		Algorithm: "EdDSA",
+		Curve:     "Ed25519",
+		X:         jwks.Keys[0].X,
+	}, jwks.Keys[0])
+	assert.NotEmpty(t, jwks.Keys[0].X)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ed-2.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}), 0o600))
+	// the public key next to its private key is merged into the same key
+	edPublicDER, err := x509.MarshalPKIXPublicKey(edPrivate.Public())
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ed-2.pub.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublicDER}), 0o600))
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaDER, err := x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "rsa-1.pub.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaDER}), 0o600))
+
+	t.Setenv(model.EnvSigningKey, "jgrh4r5ehg")
+	t.Setenv(model.EnvJWTKeysDir, dir)
+	t.Setenv(model.EnvJWTActiveKID, "ed-2")
+
+	k, err := LoadKeyring()
+	assert.NoError(t, err)
+	assert.Equal(t, "ed-2", k.active.KID)
+	assert.Len(t, k.keys, 3)
+	assert.NotNil(t, k.keys["ed-2"].PrivateKey)
+	assert.Nil(t, k.keys["rsa-1"].PrivateKey)
+
+	jwks := k.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+
+	t.Setenv(model.EnvJWTActiveKID, "rsa-1")
+	_, err = LoadKeyring()
+	assert.Error(t, err)
+
+	// a public key of another pair under the same kid is still a conflict
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherDER, err := x509.MarshalPKIXPublicKey(otherPublic)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ed-2.pub.pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER}), 0o600))
+	t.Setenv(model.EnvJWTActiveKID, "ed-2")
+	_, err = LoadKeyring()
+	assert.ErrorContains(t, err, "duplicate key id: ed-2")
+
+	t.Setenv(model.EnvSigningKey, "")
+	t.Setenv(model.EnvJWTKeysDir, "")
+	_, err = LoadKeyring()
+	assert.Error(t, err)
+}
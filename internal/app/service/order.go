@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type OrderRepository interface {
+	GetOrders(filter model.OrdersFilter) ([]model.Order, error)
+	GetOrder(id int64) (model.Order, error)
+	UpdateOrderStatus(id int64, status string) (model.Order, error)
+	RefundOrder(request model.RefundRequest, key *model.IdempotencyKey) (model.Refund, error)
+}
+
+type OrderService struct {
+	logger          *slog.Logger
+	orderRepository OrderRepository
+}
+
+func NewOrderService(logger *slog.Logger, o OrderRepository) *OrderService {
+	return &OrderService{
+		logger:          logger,
+		orderRepository: o,
+	}
+}
+
+func (o *OrderService) GetOrders(filter model.OrdersFilter) ([]model.Order, error) {
+	const op = "service.order.GetOrders"
+
+	orders, err := o.orderRepository.GetOrders(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return orders, nil
+}
+
+func (o *OrderService) GetOrder(id int64) (model.Order, error) {
+	const op = "service.order.GetOrder"
+
+	order, err := o.orderRepository.GetOrder(id)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return order, nil
+}
+
+// GetUserOrder returns the order only if it belongs to username, so users can't look into the orders of others.
+func (o *OrderService) GetUserOrder(username string, id int64) (model.Order, error) {
+	const op = "service.order.GetUserOrder"
+
+	order, err := o.orderRepository.GetOrder(id)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if order.Username != username {
+		return model.Order{}, apierror.NewAPIErrorWithMsg(apierror.OrderNotFoundError,
+			op+": (failed get order): order belongs to another user")
+	}
+
+	return order, nil
+}
+
+func (o *OrderService) UpdateOrderStatus(id int64, status string) (model.Order, error) {
+	const op = "service.order.UpdateOrderStatus"
+
+	order, err := o.orderRepository.UpdateOrderStatus(id, status)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return order, nil
+}
+
+// CancelUserOrder refunds an order of username that hasn't been delivered yet,
+// as long as it was paid within the last REFUND_GRACE_PERIOD_MINUTES.
+func (o *OrderService) CancelUserOrder(username string, id int64, key *model.IdempotencyKey) (model.Refund, error) {
+	const op = "service.order.CancelUserOrder"
+
+	gracePeriod, err := strconv.Atoi(os.Getenv(model.EnvRefundGracePeriod))
+	if err != nil {
+		return model.Refund{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (env %s must be numeric)", op, model.EnvRefundGracePeriod))
+	}
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.Refund{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refund, err := o.orderRepository.RefundOrder(model.RefundRequest{
+		OrderID:    id,
+		Owner:      username,
+		PaidAfter:  time.Now().Add(-time.Duration(gracePeriod) * time.Minute),
+		RefundedBy: username,
+		Reason:     "cancelled by user",
+	}, key)
+	if err != nil {
+		return model.Refund{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return refund, nil
+}
+
+// RefundOrder refunds any paid order, delivered ones included, on behalf of an admin.
+func (o *OrderService) RefundOrder(admin string, id int64, reason string, key *model.IdempotencyKey) (model.Refund, error) {
+	const op = "service.order.RefundOrder"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.Refund{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refund, err := o.orderRepository.RefundOrder(model.RefundRequest{
+		OrderID:        id,
+		AllowDelivered: true,
+		RefundedBy:     admin,
+		Reason:         reason,
+	}, key)
+	if err != nil {
+		return model.Refund{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return refund, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockOrderRepository struct {
+	mock.Mock
+}
+
+func (m *MockOrderRepository) GetOrders(filter model.OrdersFilter) ([]model.Order, error) {
+	args := m.Called(filter)
+	orders, _ := args.Get(0).([]model.Order)
+	return orders, args.Error(1)
+}
+
+func (m *MockOrderRepository) GetOrder(id int64) (model.Order, error) {
+	args := m.Called(id)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderRepository) UpdateOrderStatus(id int64, status string) (model.Order, error) {
+	args := m.Called(id, status)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockOrderRepository) RefundOrder(request model.RefundRequest, key *model.IdempotencyKey) (model.Refund, error) {
+	args := m.Called(request, key)
+	refund, _ := args.Get(0).(model.Refund)
+	return refund, args.Error(1)
+}
+
+func TestNewOrderService(t *testing.T) {
+	var log *slog.Logger
+	orderRepository := new(MockOrderRepository)
+
+	s := NewOrderService(log, orderRepository)
+	assert.Equal(t, &OrderService{
+		logger:          log,
+		orderRepository: orderRepository}, s)
+}
+
+func TestOrderService_GetUserOrder(t *testing.T) {
+	tests := []struct {
+		name                string
+		username            string
+		getOrderOutputOrder model.Order
+		getOrderOutputError error
+		wantErr             *apierror.APIError
+	}{
+		{
+			name:                "own order",
+			username:            "username",
+			getOrderOutputOrder: model.Order{ID: 1, Username: "username", Status: model.OrderStatusPaid},
+		},
+		{
+			name:                "order of another user",
+			username:            "username",
+			getOrderOutputOrder: model.Order{ID: 1, Username: "another", Status: model.OrderStatusPaid},
+			wantErr:             &apierror.OrderNotFoundError,
+		},
+		{
+			name:                "unknown order",
+			username:            "username",
+			getOrderOutputError: apierror.NewAPIErrorWithMsg(apierror.OrderNotFoundError, "mock"),
+			wantErr:             &apierror.OrderNotFoundError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			orderRepository := new(MockOrderRepository)
+			s := NewOrderService(log, orderRepository)
+			orderRepository.On("GetOrder", int64(1)).Return(tt.getOrderOutputOrder, tt.getOrderOutputError)
+
+			order, err := s.GetUserOrder(tt.username, 1)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.getOrderOutputOrder, order)
+		})
+	}
+}
+
+func TestOrderService_UpdateOrderStatus(t *testing.T) {
+	tests := []struct {
+		name                         string
+		updateOrderStatusOutputError error
+		wantErr                      *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                         "forbidden transition",
+			updateOrderStatusOutputError: apierror.NewAPIErrorWithMsg(apierror.OrderStatusTransitionError, "mock"),
+			wantErr:                      &apierror.OrderStatusTransitionError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			orderRepository := new(MockOrderRepository)
+			s := NewOrderService(log, orderRepository)
+			updated := model.Order{ID: 1, Username: "username", Status: model.OrderStatusDelivered}
+			orderRepository.On("UpdateOrderStatus", int64(1), model.OrderStatusDelivered).
+				Return(updated, tt.updateOrderStatusOutputError)
+
+			order, err := s.UpdateOrderStatus(1, model.OrderStatusDelivered)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, updated, order)
+		})
+	}
+}
+
+func TestOrderService_CancelUserOrder(t *testing.T) {
+	tests := []struct {
+		name                   string
+		envGracePeriod         string
+		refundOrderOutputError error
+		wantErr                *apierror.APIError
+	}{
+		{
+			name:           "success",
+			envGracePeriod: "60",
+		},
+		{
+			name:                   "grace period is over",
+			envGracePeriod:         "60",
+			refundOrderOutputError: apierror.NewAPIErrorWithMsg(apierror.RefundPeriodExpiredError, "mock"),
+			wantErr:                &apierror.RefundPeriodExpiredError,
+		},
+		{
+			name:           "invalid grace period",
+			envGracePeriod: "hour",
+			wantErr:        &apierror.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(model.EnvRefundGracePeriod, tt.envGracePeriod)
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			orderRepository := new(MockOrderRepository)
+			s := NewOrderService(log, orderRepository)
+			var request model.RefundRequest
+			orderRepository.On("RefundOrder", mock.Anything, (*model.IdempotencyKey)(nil)).
+				Run(func(args mock.Arguments) { request = args.Get(0).(model.RefundRequest) }).
+				Return(model.Refund{OrderID: 1, Amount: 40}, tt.refundOrderOutputError)
+
+			refund, err := s.CancelUserOrder("username", 1, nil)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 40, refund.Amount)
+			assert.Equal(t, "username", request.Owner)
+			assert.False(t, request.AllowDelivered)
+			assert.WithinDuration(t, time.Now().Add(-time.Hour), request.PaidAfter, time.Minute)
+		})
+	}
+}
+
+func TestOrderService_RefundOrder(t *testing.T) {
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	orderRepository := new(MockOrderRepository)
+	s := NewOrderService(log, orderRepository)
+	orderRepository.On("RefundOrder", model.RefundRequest{
+		OrderID:        1,
+		AllowDelivered: true,
+		RefundedBy:     "admin",
+		Reason:         "broken",
+	}, (*model.IdempotencyKey)(nil)).Return(model.Refund{OrderID: 1, Amount: 40}, nil)
+
+	refund, err := s.RefundOrder("admin", 1, "broken", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 40, refund.Amount)
+}
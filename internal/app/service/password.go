@@ -0,0 +1,260 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	HashAlgorithmArgon2id = "argon2id"
+	HashAlgorithmBcrypt   = "bcrypt"
+	hashAlgorithmLegacy   = "sha3-legacy"
+)
+
+// PasswordHasher produces self-describing password hashes. Argon2id hashes are
+// stored in PHC string format, bcrypt hashes in their native modular crypt format,
+// so every hash carries its own algorithm, parameters and per-user salt.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encodedHash string) (bool, error)
+	// NeedsRehash reports whether the hash should be replaced with a fresh one
+	// produced by the current algorithm and parameters.
+	NeedsRehash(encodedHash string) bool
+}
+
+// NewPasswordHasher returns a hasher that creates new hashes with the given algorithm
+// and still verifies hashes produced by any other supported one, including the legacy
+// SHA3 hashes, so that accounts can be upgraded on their next login.
+func NewPasswordHasher(algorithm string) (PasswordHasher, error) {
+	if algorithm == "" {
+		algorithm = HashAlgorithmArgon2id
+	}
+
+	hashers := map[string]PasswordHasher{
+		HashAlgorithmArgon2id: NewArgon2idHasher(),
+		HashAlgorithmBcrypt:   NewBcryptHasher(),
+		hashAlgorithmLegacy:   legacyHasher{},
+	}
+
+	current, ok := hashers[algorithm]
+	if !ok || algorithm == hashAlgorithmLegacy {
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", algorithm)
+	}
+
+	return &upgradingHasher{
+		algorithm: algorithm,
+		current:   current,
+		hashers:   hashers,
+	}, nil
+}
+
+type upgradingHasher struct {
+	algorithm string
+	current   PasswordHasher
+	hashers   map[string]PasswordHasher
+}
+
+func detectHashAlgorithm(encodedHash string) string {
+	switch {
+	case strings.HasPrefix(encodedHash, "$argon2id$"):
+		return HashAlgorithmArgon2id
+	case strings.HasPrefix(encodedHash, "$2a$"),
+		strings.HasPrefix(encodedHash, "$2b$"),
+		strings.HasPrefix(encodedHash, "$2y$"):
+		return HashAlgorithmBcrypt
+	default:
+		return hashAlgorithmLegacy
+	}
+}
+
+func (u *upgradingHasher) Hash(password string) (string, error) {
+	return u.current.Hash(password)
+}
+
+func (u *upgradingHasher) Verify(password, encodedHash string) (bool, error) {
+	return u.hashers[detectHashAlgorithm(encodedHash)].Verify(password, encodedHash)
+}
+
+func (u *upgradingHasher) NeedsRehash(encodedHash string) bool {
+	return detectHashAlgorithm(encodedHash) != u.algorithm || u.current.NeedsRehash(encodedHash)
+}
+
+// Argon2idHasher parameters follow the OWASP recommendation for argon2id.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	const op = "service.password.Argon2idHasher.Hash"
+
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed generate salt)", op))
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+type argon2idHash struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2idHash(encodedHash string) (argon2idHash, error) {
+	var h argon2idHash
+
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != HashAlgorithmArgon2id {
+		return h, errors.New("invalid argon2id hash format")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return h, errors.Wrap(err, "invalid argon2id version")
+	}
+	if h.version != argon2.Version {
+		return h, fmt.Errorf("unsupported argon2id version: %d", h.version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism); err != nil {
+		return h, errors.Wrap(err, "invalid argon2id parameters")
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return h, errors.Wrap(err, "invalid argon2id salt")
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return h, errors.Wrap(err, "invalid argon2id key")
+	}
+
+	return h, nil
+}
+
+func (a *Argon2idHasher) Verify(password, encodedHash string) (bool, error) {
+	const op = "service.password.Argon2idHasher.Verify"
+
+	h, err := parseArgon2idHash(encodedHash)
+	if err != nil {
+		return false, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed parse hash)", op))
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a *Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	h, err := parseArgon2idHash(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return h.memory != a.Memory || h.iterations != a.Iterations || h.parallelism != a.Parallelism ||
+		uint32(len(h.salt)) != a.SaltLength || uint32(len(h.key)) != a.KeyLength
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{
+		Cost: bcrypt.DefaultCost,
+	}
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	const op = "service.password.BcryptHasher.Hash"
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed generate hash)", op))
+	}
+
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Verify(password, encodedHash string) (bool, error) {
+	const op = "service.password.BcryptHasher.Verify"
+
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed compare hash)", op))
+	}
+}
+
+func (b *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != b.Cost
+}
+
+// legacyHasher verifies hashes created before per-user salts were introduced:
+// SHA3-256 of the password with the global PASSWORD_SALT prepended to the output.
+type legacyHasher struct{}
+
+func generateLegacyPasswordHash(password string) (string, error) {
+	hash := sha3.New256()
+	hash.Write([]byte(password))
+
+	salt := os.Getenv(model.EnvPasswordSalt)
+	if salt == "" {
+		return "", apierror.NewAPIErrorWithMsg(apierror.InternalError, "salt is empty")
+	}
+
+	return fmt.Sprintf("%x", hash.Sum([]byte(salt))), nil
+}
+
+func (legacyHasher) Hash(password string) (string, error) {
+	return generateLegacyPasswordHash(password)
+}
+
+func (legacyHasher) Verify(password, encodedHash string) (bool, error) {
+	hash, err := generateLegacyPasswordHash(password)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(encodedHash)) == 1, nil
+}
+
+func (legacyHasher) NeedsRehash(string) bool {
+	return true
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+func TestNewPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		wantPHC   string
+		wantErr   bool
+	}{
+		{
+			name:      "default is argon2id",
+			algorithm: "",
+			wantPHC:   "$argon2id$v=19$m=19456,t=2,p=1$",
+		},
+		{
+			name:      "bcrypt",
+			algorithm: HashAlgorithmBcrypt,
+			wantPHC:   "$2a$10$",
+		},
+		{
+			name:      "legacy can't be selected",
+			algorithm: hashAlgorithmLegacy,
+			wantErr:   true,
+		},
+		{
+			name:      "unknown algorithm",
+			algorithm: "md5",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewPasswordHasher(tt.algorithm)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			hash, err := h.Hash("password")
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(hash, tt.wantPHC), hash)
+
+			ok, err := h.Verify("password", hash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.False(t, h.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestPasswordHasher_HashVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{
+			name:   "argon2id",
+			hasher: NewArgon2idHasher(),
+		},
+		{
+			name:   "bcrypt",
+			hasher: &BcryptHasher{Cost: bcrypt.MinCost},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash1, err1 := tt.hasher.Hash("password")
+			hash2, err2 := tt.hasher.Hash("password")
+			assert.NoError(t, err1)
+			assert.NoError(t, err2)
+			assert.NotEqual(t, hash1, hash2, "every hash must have its own salt")
+
+			ok, err := tt.hasher.Verify("password", hash1)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = tt.hasher.Verify("wrong_password", hash1)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	os.Setenv(model.EnvPasswordSalt, "jngvurj")
+	legacyHash, err := generateLegacyPasswordHash("password")
+	assert.NoError(t, err)
+	bcryptHash, err := (&BcryptHasher{Cost: bcrypt.MinCost}).Hash("password")
+	assert.NoError(t, err)
+	weakArgon2idHash, err := (&Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}).
+		Hash("password")
+	assert.NoError(t, err)
+
+	h, err := NewPasswordHasher(HashAlgorithmArgon2id)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{
+			name: "legacy sha3",
+			hash: legacyHash,
+		},
+		{
+			name: "other algorithm",
+			hash: bcryptHash,
+		},
+		{
+			name: "outdated parameters",
+			hash: weakArgon2idHash,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := h.Verify("password", tt.hash)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.True(t, h.NeedsRehash(tt.hash))
+		})
+	}
+}
+
+func TestArgon2idHasher_VerifyMalformed(t *testing.T) {
+	_, err := NewArgon2idHasher().Verify("password", "$argon2id$v=19$m=19456$broken")
+
+	var apiErr apierror.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, apierror.InternalError.Status, apiErr.Status)
+}
+
+func TestAuthService_generateLegacyPassword(t *testing.T) {
+	type inputArgs struct {
+		password string
+		envSalt  string
+	}
+	tests := []struct {
+		name           string
+		args           inputArgs
+		wantErr        *apierror.APIError
+		wantErrMessage string
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				password: "username",
+				envSalt:  "jngvurj",
+			},
+		},
+		{
+			name: "empty salt",
+			args: inputArgs{
+				password: "username",
+				envSalt:  "",
+			},
+			wantErr:        &apierror.InternalError,
+			wantErrMessage: "salt is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Setenv(model.EnvPasswordSalt, tt.args.envSalt)
+			passwordHash1, err1 := generateLegacyPasswordHash(tt.args.password)
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err1, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, apiErr.Status, tt.wantErr.Status)
+				assert.Equal(t, apiErr.Error(),
+					fmt.Sprintf("%s: %s", tt.wantErr.Message, tt.wantErrMessage))
+				return
+			}
+			passwordHash2, err2 := generateLegacyPasswordHash(tt.args.password)
+			assert.NoError(t, err1)
+			assert.NoError(t, err2)
+			assert.Equal(t, passwordHash2, passwordHash1)
+		})
+	}
+}
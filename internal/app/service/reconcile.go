@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type ReconcileRepository interface {
+	GetLedgerSnapshot(ctx context.Context) (model.LedgerSnapshot, error)
+}
+
+type ReconcileService struct {
+	logger              *slog.Logger
+	reconcileRepository ReconcileRepository
+}
+
+func NewReconcileService(logger *slog.Logger, r ReconcileRepository) *ReconcileService {
+	return &ReconcileService{
+		logger:              logger,
+		reconcileRepository: r,
+	}
+}
+
+// Reconcile compares every user's and every wallet's cached balance with the ledger and with the balance
+// recomputed from the history, checks that every posting is balanced and that no coins appeared or vanished.
+func (r *ReconcileService) Reconcile(ctx context.Context) (model.ReconciliationReport, error) {
+	const op = "service.reconcile.Reconcile"
+
+	snapshot, err := r.reconcileRepository.GetLedgerSnapshot(ctx)
+	if err != nil {
+		return model.ReconciliationReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	report := model.ReconciliationReport{
+		CheckedAt:           time.Now().UTC(),
+		Users:               len(snapshot.Balances),
+		Discrepancies:       make([]model.BalanceCheck, 0),
+		Wallets:             len(snapshot.WalletBalances),
+		WalletDiscrepancies: make([]model.WalletBalanceCheck, 0),
+		UnbalancedPostings:  snapshot.UnbalancedPostings,
+		Conservation:        snapshot.Conservation,
+	}
+	if report.UnbalancedPostings == nil {
+		report.UnbalancedPostings = make([]int64, 0)
+	}
+
+	for _, balance := range snapshot.Balances {
+		if balance.Balance != balance.LedgerBalance || balance.Balance != balance.ExpectedBalance {
+			report.Discrepancies = append(report.Discrepancies, balance)
+		}
+	}
+
+	for _, balance := range snapshot.WalletBalances {
+		if balance.Balance != balance.LedgerBalance || balance.Balance != balance.ExpectedBalance {
+			report.WalletDiscrepancies = append(report.WalletDiscrepancies, balance)
+		}
+	}
+
+	conservation := &report.Conservation
+	conservation.Conserved = conservation.Issued ==
+		conservation.UsersBalance+conservation.WalletsBalance+conservation.ShopBalance+conservation.EscrowBalance
+
+	report.OK = len(report.Discrepancies) == 0 && len(report.WalletDiscrepancies) == 0 &&
+		len(report.UnbalancedPostings) == 0 && conservation.Conserved
+
+	return report, nil
+}
+
+// RunPeriodically reconciles the balances every interval until ctx is done and logs the reports.
+func (r *ReconcileService) RunPeriodically(ctx context.Context, interval time.Duration) {
+	const op = "service.reconcile.RunPeriodically"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Reconcile(ctx)
+		if err != nil {
+			r.logger.Error(fmt.Sprintf("%s: %s", op, err))
+			continue
+		}
+
+		if !report.OK {
+			r.logger.Error("balances don't reconcile", slog.Any("report", report))
+			continue
+		}
+
+		r.logger.Info("balances reconciled",
+			slog.Int("users", report.Users), slog.Int("issued", report.Conservation.Issued))
+	}
+}
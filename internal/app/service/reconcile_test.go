@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockReconcileRepository struct {
+	mock.Mock
+}
+
+func (m *MockReconcileRepository) GetLedgerSnapshot(ctx context.Context) (model.LedgerSnapshot, error) {
+	args := m.Called(ctx)
+	snapshot, _ := args.Get(0).(model.LedgerSnapshot)
+	return snapshot, args.Error(1)
+}
+
+func TestNewReconcileService(t *testing.T) {
+	var log *slog.Logger
+	reconcileRepository := new(MockReconcileRepository)
+
+	s := NewReconcileService(log, reconcileRepository)
+	assert.Equal(t, &ReconcileService{
+		logger:              log,
+		reconcileRepository: reconcileRepository}, s)
+}
+
+func TestReconcileService_Reconcile(t *testing.T) {
+	balances := []model.BalanceCheck{
+		{Username: "user1", Balance: 900, LedgerBalance: 900, ExpectedBalance: 900},
+		{Username: "user2", Balance: 1050, LedgerBalance: 1050, ExpectedBalance: 1050},
+	}
+
+	tests := []struct {
+		name              string
+		snapshot          model.LedgerSnapshot
+		snapshotErr       error
+		wantOK            bool
+		wantDiscrepancies []model.BalanceCheck
+		wantWallets       []model.WalletBalanceCheck
+		wantConserved     bool
+		wantErr           *apierror.APIError
+	}{
+		{
+			name: "everything reconciles",
+			snapshot: model.LedgerSnapshot{
+				Balances:     balances,
+				Conservation: model.CoinConservation{Issued: 2000, UsersBalance: 1950, ShopBalance: 50},
+			},
+			wantOK:            true,
+			wantDiscrepancies: []model.BalanceCheck{},
+			wantConserved:     true,
+		},
+		{
+			name: "coins in a wallet",
+			snapshot: model.LedgerSnapshot{
+				Balances: balances,
+				WalletBalances: []model.WalletBalanceCheck{
+					{Wallet: "backend-team", Balance: 100, LedgerBalance: 100, ExpectedBalance: 100},
+				},
+				Conservation: model.CoinConservation{Issued: 2100, UsersBalance: 1950, WalletsBalance: 100, ShopBalance: 50},
+			},
+			wantOK:            true,
+			wantDiscrepancies: []model.BalanceCheck{},
+			wantConserved:     true,
+		},
+		{
+			name: "wallet activity doesn't match the ledger",
+			snapshot: model.LedgerSnapshot{
+				Balances: balances,
+				WalletBalances: []model.WalletBalanceCheck{
+					{Wallet: "backend-team", Balance: 100, LedgerBalance: 100, ExpectedBalance: 150},
+				},
+				Conservation: model.CoinConservation{Issued: 2100, UsersBalance: 1950, WalletsBalance: 100, ShopBalance: 50},
+			},
+			wantDiscrepancies: []model.BalanceCheck{},
+			wantWallets: []model.WalletBalanceCheck{
+				{Wallet: "backend-team", Balance: 100, LedgerBalance: 100, ExpectedBalance: 150},
+			},
+			wantConserved: true,
+		},
+		{
+			name: "cached balance drifted",
+			snapshot: model.LedgerSnapshot{
+				Balances: []model.BalanceCheck{
+					balances[0],
+					{Username: "user2", Balance: 1100, LedgerBalance: 1050, ExpectedBalance: 1050},
+				},
+				Conservation: model.CoinConservation{Issued: 2000, UsersBalance: 2000, ShopBalance: 50},
+			},
+			wantDiscrepancies: []model.BalanceCheck{
+				{Username: "user2", Balance: 1100, LedgerBalance: 1050, ExpectedBalance: 1050},
+			},
+		},
+		{
+			name: "history doesn't match the ledger",
+			snapshot: model.LedgerSnapshot{
+				Balances: []model.BalanceCheck{
+					{Username: "user1", Balance: 900, LedgerBalance: 900, ExpectedBalance: 1000},
+				},
+				Conservation: model.CoinConservation{Issued: 950, UsersBalance: 900, ShopBalance: 50},
+			},
+			wantDiscrepancies: []model.BalanceCheck{
+				{Username: "user1", Balance: 900, LedgerBalance: 900, ExpectedBalance: 1000},
+			},
+			wantConserved: true,
+		},
+		{
+			name: "unbalanced posting",
+			snapshot: model.LedgerSnapshot{
+				Balances:           balances,
+				UnbalancedPostings: []int64{7},
+				Conservation:       model.CoinConservation{Issued: 2000, UsersBalance: 1950, ShopBalance: 50},
+			},
+			wantDiscrepancies: []model.BalanceCheck{},
+			wantConserved:     true,
+		},
+		{
+			name:        "error in repository",
+			snapshotErr: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantErr:     &apierror.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			reconcileRepository := new(MockReconcileRepository)
+			s := NewReconcileService(log, reconcileRepository)
+			reconcileRepository.On("GetLedgerSnapshot", mock.Anything).Return(tt.snapshot, tt.snapshotErr)
+
+			report, err := s.Reconcile(context.Background())
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOK, report.OK)
+			assert.Equal(t, tt.wantDiscrepancies, report.Discrepancies)
+			if tt.wantWallets == nil {
+				tt.wantWallets = []model.WalletBalanceCheck{}
+			}
+			assert.Equal(t, tt.wantWallets, report.WalletDiscrepancies)
+			assert.Equal(t, tt.wantConserved, report.Conservation.Conserved)
+			assert.Equal(t, len(tt.snapshot.Balances), report.Users)
+		})
+	}
+}
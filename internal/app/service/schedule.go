@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+// scheduledTransfersBatch is how many due transfers a replica claims at once.
+const scheduledTransfersBatch = 100
+
+// CoinSender makes a transfer the way sendCoin does.
+type CoinSender interface {
+	SendCoin(username string, send model.Send, key *model.IdempotencyKey) (*model.TransferApproval, error)
+}
+
+type ScheduleRepository interface {
+	CreateScheduledTransfer(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error)
+	GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error)
+	CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error)
+	ClaimDueScheduledTransfers(limit int, next func(model.ScheduledTransfer) *time.Time) ([]model.ScheduledTransfer, error)
+	FinishScheduledTransferRun(id int64, runErr string) error
+}
+
+type ScheduleService struct {
+	logger             *slog.Logger
+	scheduleRepository ScheduleRepository
+	coinSender         CoinSender
+}
+
+func NewScheduleService(logger *slog.Logger, s ScheduleRepository, c CoinSender) *ScheduleService {
+	return &ScheduleService{
+		logger:             logger,
+		scheduleRepository: s,
+		coinSender:         c,
+	}
+}
+
+// CreateScheduledTransfer schedules a transfer once at input.RunAt or repeatedly by input.Cron.
+func (s *ScheduleService) CreateScheduledTransfer(username string,
+	input model.ScheduledTransferInput) (model.ScheduledTransfer, error) {
+	const op = "service.schedule.CreateScheduledTransfer"
+
+	schedule := model.ScheduledTransfer{
+		FromUser: username,
+		ToUser:   input.ToUser,
+		Amount:   input.Amount,
+		Message:  input.Message,
+		Category: input.Category,
+	}
+
+	now := time.Now()
+	switch {
+	case (input.RunAt == nil) == (input.Cron == ""):
+		return model.ScheduledTransfer{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+			op+": exactly one of runAt and cron must be set")
+	case input.RunAt != nil:
+		if !input.RunAt.After(now) {
+			return model.ScheduledTransfer{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+				op+": runAt must be in the future")
+		}
+		schedule.NextRunAt = input.RunAt
+	default:
+		cron, err := parseCron(input.Cron)
+		if err != nil {
+			return model.ScheduledTransfer{}, apierror.NewAPIError(apierror.BadRequestError,
+				errors.Wrapf(err, "%s: invalid cron", op))
+		}
+		next, ok := cron.next(now)
+		if !ok {
+			return model.ScheduledTransfer{}, apierror.NewAPIErrorWithMsg(apierror.BadRequestError,
+				op+": cron never fires")
+		}
+		schedule.Cron = &input.Cron
+		schedule.NextRunAt = &next
+	}
+
+	schedule, err := s.scheduleRepository.CreateScheduledTransfer(schedule)
+	if err != nil {
+		return model.ScheduledTransfer{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return schedule, nil
+}
+
+func (s *ScheduleService) GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error) {
+	const op = "service.schedule.GetScheduledTransfers"
+
+	schedules, err := s.scheduleRepository.GetScheduledTransfers(username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return schedules, nil
+}
+
+func (s *ScheduleService) CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error) {
+	const op = "service.schedule.CancelScheduledTransfer"
+
+	schedule, err := s.scheduleRepository.CancelScheduledTransfer(username, id)
+	if err != nil {
+		return model.ScheduledTransfer{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return schedule, nil
+}
+
+// nextScheduledRun returns the next run of a recurring schedule after now, so runs missed while
+// no replica was running are skipped instead of being made all at once. One-shot schedules end.
+func nextScheduledRun(schedule model.ScheduledTransfer, now time.Time) *time.Time {
+	if schedule.Cron == nil {
+		return nil
+	}
+
+	cron, err := parseCron(*schedule.Cron)
+	if err != nil {
+		return nil
+	}
+
+	next, ok := cron.next(now)
+	if !ok {
+		return nil
+	}
+
+	return &next
+}
+
+// runDueScheduledTransfers claims the due transfers and makes them like sendCoin does,
+// so they are limited and approved the same way. It returns the number of runs made.
+func (s *ScheduleService) runDueScheduledTransfers() (int, error) {
+	const op = "service.schedule.runDueScheduledTransfers"
+
+	schedules, err := s.scheduleRepository.ClaimDueScheduledTransfers(scheduledTransfersBatch,
+		func(schedule model.ScheduledTransfer) *time.Time {
+			return nextScheduledRun(schedule, time.Now())
+		})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, schedule := range schedules {
+		runErr := ""
+		_, err := s.coinSender.SendCoin(schedule.FromUser, model.Send{
+			ToUser:   schedule.ToUser,
+			Amount:   schedule.Amount,
+			Message:  schedule.Message,
+			Category: schedule.Category,
+		}, nil)
+		if err != nil {
+			runErr = apierror.GetAPIError(err).Message
+			s.logger.Error(fmt.Sprintf("%s: scheduled transfer %d failed: %s", op, schedule.ID, err))
+		}
+
+		if err := s.scheduleRepository.FinishScheduledTransferRun(schedule.ID, runErr); err != nil {
+			s.logger.Error(fmt.Sprintf("%s: %s", op, err))
+		}
+	}
+
+	return len(schedules), nil
+}
+
+// RunScheduledTransfers makes the due scheduled transfers every interval until ctx is done.
+// Every replica may run it, each run is claimed by one of them.
+func (s *ScheduleService) RunScheduledTransfers(ctx context.Context, interval time.Duration) {
+	const op = "service.schedule.RunScheduledTransfers"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// a full batch means more transfers may be due
+		for {
+			runs, err := s.runDueScheduledTransfers()
+			if err != nil {
+				s.logger.Error(fmt.Sprintf("%s: %s", op, err))
+				break
+			}
+			if runs > 0 {
+				s.logger.Info("scheduled transfers made", slog.Int("count", runs))
+			}
+			if runs < scheduledTransfersBatch || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
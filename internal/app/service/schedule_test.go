@@ -0,0 +1,181 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockScheduleRepository struct {
+	mock.Mock
+}
+
+func (m *MockScheduleRepository) CreateScheduledTransfer(schedule model.ScheduledTransfer) (model.ScheduledTransfer, error) {
+	args := m.Called(schedule)
+	created, _ := args.Get(0).(model.ScheduledTransfer)
+	return created, args.Error(1)
+}
+
+func (m *MockScheduleRepository) GetScheduledTransfers(username string) ([]model.ScheduledTransfer, error) {
+	args := m.Called(username)
+	schedules, _ := args.Get(0).([]model.ScheduledTransfer)
+	return schedules, args.Error(1)
+}
+
+func (m *MockScheduleRepository) CancelScheduledTransfer(username string, id int64) (model.ScheduledTransfer, error) {
+	args := m.Called(username, id)
+	schedule, _ := args.Get(0).(model.ScheduledTransfer)
+	return schedule, args.Error(1)
+}
+
+func (m *MockScheduleRepository) ClaimDueScheduledTransfers(limit int,
+	next func(model.ScheduledTransfer) *time.Time) ([]model.ScheduledTransfer, error) {
+	args := m.Called(limit, next)
+	schedules, _ := args.Get(0).([]model.ScheduledTransfer)
+	return schedules, args.Error(1)
+}
+
+func (m *MockScheduleRepository) FinishScheduledTransferRun(id int64, runErr string) error {
+	args := m.Called(id, runErr)
+	return args.Error(0)
+}
+
+func TestNewScheduleService(t *testing.T) {
+	var log *slog.Logger
+	scheduleRepository := new(MockScheduleRepository)
+	coinSender := NewShopService(log, nil, nil, nil, nil)
+
+	s := NewScheduleService(log, scheduleRepository, coinSender)
+	assert.Equal(t, &ScheduleService{
+		logger:             log,
+		scheduleRepository: scheduleRepository,
+		coinSender:         coinSender}, s)
+}
+
+func TestScheduleService_CreateScheduledTransfer(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		input    model.ScheduledTransferInput
+		wantCron bool
+		wantErr  *apierror.APIError
+	}{
+		{
+			name:  "one-shot",
+			input: model.ScheduledTransferInput{ToUser: "fund", Amount: 10, RunAt: &future},
+		},
+		{
+			name:     "recurring",
+			input:    model.ScheduledTransferInput{ToUser: "fund", Amount: 10, Cron: "0 9 * * 1"},
+			wantCron: true,
+		},
+		{
+			name:    "both runAt and cron",
+			input:   model.ScheduledTransferInput{ToUser: "fund", Amount: 10, RunAt: &future, Cron: "0 9 * * 1"},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "neither runAt nor cron",
+			input:   model.ScheduledTransferInput{ToUser: "fund", Amount: 10},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "runAt in the past",
+			input:   model.ScheduledTransferInput{ToUser: "fund", Amount: 10, RunAt: &past},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "invalid cron",
+			input:   model.ScheduledTransferInput{ToUser: "fund", Amount: 10, Cron: "every monday"},
+			wantErr: &apierror.BadRequestError,
+		},
+		{
+			name:    "cron never fires",
+			input:   model.ScheduledTransferInput{ToUser: "fund", Amount: 10, Cron: "0 0 31 4 *"},
+			wantErr: &apierror.BadRequestError,
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduleRepository := new(MockScheduleRepository)
+			s := NewScheduleService(log, scheduleRepository, nil)
+			scheduleRepository.On("CreateScheduledTransfer", mock.Anything).Return(model.ScheduledTransfer{ID: 1}, nil)
+
+			_, err := s.CreateScheduledTransfer("username", tt.input)
+
+			if tt.wantErr != nil {
+				var apiErr apierror.APIError
+				ok := errors.As(err, &apiErr)
+				assert.True(t, ok)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				scheduleRepository.AssertNotCalled(t, "CreateScheduledTransfer", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			scheduleRepository.AssertCalled(t, "CreateScheduledTransfer",
+				mock.MatchedBy(func(schedule model.ScheduledTransfer) bool {
+					if schedule.FromUser != "username" || schedule.NextRunAt == nil ||
+						!schedule.NextRunAt.After(time.Now()) {
+						return false
+					}
+					return (schedule.Cron != nil) == tt.wantCron
+				}))
+		})
+	}
+}
+
+func TestNextScheduledRun(t *testing.T) {
+	cron := "0 9 * * 1"
+	now := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+
+	assert.Nil(t, nextScheduledRun(model.ScheduledTransfer{}, now))
+
+	next := nextScheduledRun(model.ScheduledTransfer{Cron: &cron}, now)
+	if assert.NotNil(t, next) {
+		assert.Equal(t, time.Date(2024, time.March, 18, 9, 0, 0, 0, time.UTC), *next)
+	}
+}
+
+func TestScheduleService_runDueScheduledTransfers(t *testing.T) {
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	t.Setenv(model.EnvApprovalThreshold, "")
+
+	shopRepository := new(MockRepository)
+	scheduleRepository := new(MockScheduleRepository)
+	s := NewScheduleService(log, scheduleRepository, NewShopService(log, shopRepository, shopRepository, shopRepository, nil))
+	scheduleRepository.On("ClaimDueScheduledTransfers", scheduledTransfersBatch, mock.Anything).
+		Return([]model.ScheduledTransfer{
+			{ID: 1, FromUser: "user1", ToUser: "fund", Amount: 10, Category: model.TransferCategoryGift},
+			{ID: 2, FromUser: "user2", ToUser: "fund", Amount: 10, Category: model.TransferCategoryGift},
+		}, nil)
+	shopRepository.On("SendCoin", "user1", mock.Anything, mock.Anything, (*model.IdempotencyKey)(nil)).Return(nil)
+	shopRepository.On("SendCoin", "user2", mock.Anything, mock.Anything, (*model.IdempotencyKey)(nil)).
+		Return(apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, "mock"))
+	scheduleRepository.On("FinishScheduledTransferRun", mock.Anything, mock.Anything).Return(nil)
+
+	runs, err := s.runDueScheduledTransfers()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, runs)
+	shopRepository.AssertCalled(t, "SendCoin", "user1",
+		model.Send{ToUser: "fund", Amount: 10, Category: model.TransferCategoryGift},
+		mock.Anything, (*model.IdempotencyKey)(nil))
+	scheduleRepository.AssertCalled(t, "FinishScheduledTransferRun", int64(1), "")
+	scheduleRepository.AssertCalled(t, "FinishScheduledTransferRun", int64(2), apierror.NotEnoughMoneyError.Message)
+}
@@ -3,7 +3,13 @@ package service
 import (
 	"fmt"
 	"log/slog"
+	"os"
+	"strconv"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
 	"github.com/nosikmy/avito-shop/internal/app/model"
 )
 
@@ -13,13 +19,24 @@ type InfoRepository interface {
 }
 
 type HistoryRepository interface {
-	GetCoinReceivedHistory(username string) ([]model.Receive, error)
-	GetCoinSentHistory(username string) ([]model.Send, error)
+	GetCoinReceivedHistory(username string, limit int) ([]model.Receive, error)
+	GetCoinSentHistory(username string, limit int) ([]model.Send, error)
+	GetHistory(filter model.HistoryFilter) (model.HistoryPage, error)
+	GetCounterpartyHistory(username string) ([]model.CounterpartyHistory, error)
+	ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error
+	GetRefundHistory(username string) ([]model.RefundHistory, error)
+	GetGrantHistory(username string) ([]model.GrantHistory, error)
+	GetApprovalHistory(username string) ([]model.TransferApproval, error)
+	GetPurchaseHistory(username string, filter model.PurchasesFilter) ([]model.Purchase, error)
 }
 
 type ShoppingRepository interface {
-	SendCoin(fromUsername, toUsername string, amount int) error
-	Buy(username, item string) error
+	SendCoin(fromUsername string, send model.Send, limits model.TransferLimits, key *model.IdempotencyKey) error
+	Buy(username, item string, quantity int, key *model.IdempotencyKey) error
+	Checkout(username string, lines []model.OrderLine, key *model.IdempotencyKey) (model.Order, error)
+	GetIdempotencyKey(username, key string) (model.IdempotencyKey, error)
+	SaveIdempotencyKey(key model.IdempotencyKey) error
+	GrantCoins(batch model.GrantBatch, key *model.IdempotencyKey) (model.GrantReport, error)
 }
 
 type ShopService struct {
@@ -27,18 +44,23 @@ type ShopService struct {
 	infoRepository     InfoRepository
 	historyRepository  HistoryRepository
 	shoppingRepository ShoppingRepository
+	approvalRepository ApprovalRepository
 }
 
-func NewShopService(logger *slog.Logger, i InfoRepository, h HistoryRepository, s ShoppingRepository) *ShopService {
+func NewShopService(logger *slog.Logger, i InfoRepository, h HistoryRepository, s ShoppingRepository,
+	a ApprovalRepository) *ShopService {
 	return &ShopService{
 		logger:             logger,
 		infoRepository:     i,
 		historyRepository:  h,
 		shoppingRepository: s,
+		approvalRepository: a,
 	}
 }
 
-func (s *ShopService) GetInfo(username string) (model.InfoOutput, error) {
+// GetInfo returns the user's coins, inventory and history shaped by the filter,
+// the whole history of transfers is in GetHistory.
+func (s *ShopService) GetInfo(username string, filter model.InfoFilter) (model.InfoOutput, error) {
 	const op = "service.shop.GetInfo"
 
 	coins, err := s.infoRepository.GetCoinsAmount(username)
@@ -51,44 +73,201 @@ func (s *ShopService) GetInfo(username string) (model.InfoOutput, error) {
 		return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	received, err := s.historyRepository.GetCoinReceivedHistory(username)
-	if err != nil {
+	history := model.CoinHistory{Received: []model.Receive{}, Sent: []model.Send{}}
+	if filter.Aggregate == model.HistoryAggregateCounterparty {
+		if history.Counterparties, err = s.historyRepository.GetCounterpartyHistory(username); err != nil {
+			return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
+		}
+	} else {
+		if history.Received, err = s.historyRepository.GetCoinReceivedHistory(username, filter.HistoryLimit); err != nil {
+			return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if history.Sent, err = s.historyRepository.GetCoinSentHistory(username, filter.HistoryLimit); err != nil {
+			return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if history.Refunds, err = s.historyRepository.GetRefundHistory(username); err != nil {
 		return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
 	}
 
-	sent, err := s.historyRepository.GetCoinSentHistory(username)
-	if err != nil {
+	if history.Grants, err = s.historyRepository.GetGrantHistory(username); err != nil {
+		return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if history.Approvals, err = s.historyRepository.GetApprovalHistory(username); err != nil {
 		return model.InfoOutput{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	info := model.InfoOutput{
-		Coins:     coins,
-		Inventory: inventory,
-		CoinHistory: model.CoinHistory{
-			Received: received,
-			Sent:     sent,
-		},
+		Coins:       coins,
+		Inventory:   inventory,
+		CoinHistory: history,
 	}
 
 	return info, nil
 }
 
-func (s *ShopService) SendCoin(username string, send model.Send) error {
+func (s *ShopService) GetPurchases(username string, filter model.PurchasesFilter) ([]model.Purchase, error) {
+	const op = "service.shop.GetPurchases"
+
+	purchases, err := s.historyRepository.GetPurchaseHistory(username, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return purchases, nil
+}
+
+// SendCoin transfers the coins right away, or reserves them and returns the pending approval
+// if the amount is above the approval threshold.
+func (s *ShopService) SendCoin(username string, send model.Send, key *model.IdempotencyKey) (*model.TransferApproval, error) {
 	const op = "service.shop.SendCoin"
 
-	if err := s.shoppingRepository.SendCoin(username, send.ToUser, send.Amount); err != nil {
+	limits, err := getTransferLimits()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	threshold, err := getApprovalThreshold()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if threshold > 0 && send.Amount > threshold {
+		approval, err := s.reserveTransfer(username, send, limits, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return &approval, nil
+	}
+
+	if err := s.shoppingRepository.SendCoin(username, send, limits, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil, nil
+}
+
+func (s *ShopService) Buy(username, item string, quantity int, key *model.IdempotencyKey) error {
+	const op = "service.shop.Buy"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.shoppingRepository.Buy(username, item, quantity, key); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
 }
 
-func (s *ShopService) Buy(username, item string) error {
-	const op = "service.shop.Buy"
+func (s *ShopService) Checkout(username string, input model.OrderInput, key *model.IdempotencyKey) (model.Order, error) {
+	const op = "service.shop.Checkout"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	order, err := s.shoppingRepository.Checkout(username, input.Items, key)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return order, nil
+}
+
+func (s *ShopService) GrantCoins(admin string, input model.GrantInput, dryRun bool,
+	key *model.IdempotencyKey) (model.GrantReport, error) {
+	const op = "service.shop.GrantCoins"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.GrantReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	report, err := s.shoppingRepository.GrantCoins(model.GrantBatch{
+		Reason:    input.Reason,
+		GrantedBy: admin,
+		Grants:    input.Grants,
+		DryRun:    dryRun,
+	}, key)
+	if err != nil {
+		return model.GrantReport{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return report, nil
+}
+
+func (s *ShopService) GetIdempotencyKey(username, key string) (model.IdempotencyKey, error) {
+	const op = "service.shop.GetIdempotencyKey"
+
+	idempotencyKey, err := s.shoppingRepository.GetIdempotencyKey(username, key)
+	if err != nil {
+		return model.IdempotencyKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return idempotencyKey, nil
+}
+
+func (s *ShopService) SaveIdempotencyKey(key model.IdempotencyKey) error {
+	const op = "service.shop.SaveIdempotencyKey"
 
-	if err := s.shoppingRepository.Buy(username, item); err != nil {
+	if err := setIdempotencyKeyExpiry(&key); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := s.shoppingRepository.SaveIdempotencyKey(key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func setIdempotencyKeyExpiry(key *model.IdempotencyKey) error {
+	const op = "service.shop.setIdempotencyKeyExpiry"
+
+	if key == nil {
+		return nil
+	}
+
+	ttl, err := strconv.Atoi(os.Getenv(model.EnvIdempotencyKeyTTL))
+	if err != nil {
+		return apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (env %s must be numeric)", op, model.EnvIdempotencyKeyTTL))
+	}
+	key.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Hour)
+
 	return nil
 }
+
+// getTransferLimits reads the limits of sendCoin, an unset limit is disabled.
+func getTransferLimits() (model.TransferLimits, error) {
+	const op = "service.shop.getTransferLimits"
+
+	var limits model.TransferLimits
+	for env, limit := range map[string]*int{
+		model.EnvTransferMaxAmount:       &limits.MaxAmount,
+		model.EnvTransferDailyAmount:     &limits.DailyAmount,
+		model.EnvTransferDailyCount:      &limits.DailyCount,
+		model.EnvTransferDailyRecipients: &limits.DailyRecipients,
+	} {
+		raw := os.Getenv(env)
+		if raw == "" {
+			continue
+		}
+
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return model.TransferLimits{}, apierror.NewAPIErrorWithMsg(apierror.InternalError,
+				fmt.Sprintf("%s: (env %s must be a non-negative number)", op, env))
+		}
+		*limit = value
+	}
+
+	return limits, nil
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -29,34 +30,107 @@ func (m *MockRepository) GetInventory(username string) ([]model.Item, error) {
 	return inventory, args.Error(1)
 }
 
-func (m *MockRepository) SendCoin(fromUsername, toUsername string, amount int) error {
-	args := m.Called(fromUsername, toUsername, amount)
+func (m *MockRepository) SendCoin(fromUsername string, send model.Send, limits model.TransferLimits,
+	key *model.IdempotencyKey) error {
+	args := m.Called(fromUsername, send, limits, key)
 	return args.Error(0)
 }
 
-func (m *MockRepository) Buy(username, item string) error {
-	args := m.Called(username, item)
+func (m *MockRepository) Buy(username, item string, quantity int, key *model.IdempotencyKey) error {
+	args := m.Called(username, item, quantity, key)
 	return args.Error(0)
 }
 
-func (m *MockRepository) GetCoinReceivedHistory(username string) ([]model.Receive, error) {
+func (m *MockRepository) GrantCoins(batch model.GrantBatch, key *model.IdempotencyKey) (model.GrantReport, error) {
+	args := m.Called(batch, key)
+	report, _ := args.Get(0).(model.GrantReport)
+	return report, args.Error(1)
+}
+
+func (m *MockRepository) GetGrantHistory(username string) ([]model.GrantHistory, error) {
 	args := m.Called(username)
+	grants, _ := args.Get(0).([]model.GrantHistory)
+	return grants, args.Error(1)
+}
+
+func (m *MockRepository) GetApprovalHistory(username string) ([]model.TransferApproval, error) {
+	args := m.Called(username)
+	approvals, _ := args.Get(0).([]model.TransferApproval)
+	return approvals, args.Error(1)
+}
+
+func (m *MockRepository) GetIdempotencyKey(username, key string) (model.IdempotencyKey, error) {
+	args := m.Called(username, key)
+	idempotencyKey, _ := args.Get(0).(model.IdempotencyKey)
+	return idempotencyKey, args.Error(1)
+}
+
+func (m *MockRepository) SaveIdempotencyKey(key model.IdempotencyKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockRepository) Checkout(username string, lines []model.OrderLine,
+	key *model.IdempotencyKey) (model.Order, error) {
+	args := m.Called(username, lines, key)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func (m *MockRepository) GetCoinReceivedHistory(username string, limit int) ([]model.Receive, error) {
+	args := m.Called(username, limit)
 	received, _ := args.Get(0).([]model.Receive)
 	return received, args.Error(1)
 }
 
-func (m *MockRepository) GetCoinSentHistory(username string) ([]model.Send, error) {
-	args := m.Called(username)
+func (m *MockRepository) GetCoinSentHistory(username string, limit int) ([]model.Send, error) {
+	args := m.Called(username, limit)
 	sent, _ := args.Get(0).([]model.Send)
 	return sent, args.Error(1)
 }
 
+func (m *MockRepository) GetHistory(filter model.HistoryFilter) (model.HistoryPage, error) {
+	args := m.Called(filter)
+	page, _ := args.Get(0).(model.HistoryPage)
+	return page, args.Error(1)
+}
+
+func (m *MockRepository) ExportHistory(filter model.HistoryExportFilter, emit func(model.TransferExport) error) error {
+	args := m.Called(filter)
+	transfers, _ := args.Get(0).([]model.TransferExport)
+	for _, transfer := range transfers {
+		if err := emit(transfer); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockRepository) GetCounterpartyHistory(username string) ([]model.CounterpartyHistory, error) {
+	args := m.Called(username)
+	counterparties, _ := args.Get(0).([]model.CounterpartyHistory)
+	return counterparties, args.Error(1)
+}
+
+func (m *MockRepository) GetRefundHistory(username string) ([]model.RefundHistory, error) {
+	args := m.Called(username)
+	refunds, _ := args.Get(0).([]model.RefundHistory)
+	return refunds, args.Error(1)
+}
+
+func (m *MockRepository) GetPurchaseHistory(username string, filter model.PurchasesFilter) ([]model.Purchase, error) {
+	args := m.Called(username, filter)
+	purchases, _ := args.Get(0).([]model.Purchase)
+	return purchases, args.Error(1)
+}
+
 func TestNewShopService(t *testing.T) {
 	type inputArgs struct {
 		logger             *slog.Logger
 		infoRepository     InfoRepository
 		historyRepository  HistoryRepository
 		shoppingRepository ShoppingRepository
+		approvalRepository ApprovalRepository
 	}
 	tests := []struct {
 		name    string
@@ -70,27 +144,37 @@ func TestNewShopService(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := NewShopService(tt.args.logger, tt.args.infoRepository, tt.args.historyRepository, tt.args.shoppingRepository)
+			s := NewShopService(tt.args.logger, tt.args.infoRepository, tt.args.historyRepository,
+				tt.args.shoppingRepository, tt.args.approvalRepository)
 			assert.Equal(t, &ShopService{
 				logger:             tt.args.logger,
 				infoRepository:     tt.args.infoRepository,
 				historyRepository:  tt.args.historyRepository,
-				shoppingRepository: tt.args.shoppingRepository}, s)
+				shoppingRepository: tt.args.shoppingRepository,
+				approvalRepository: tt.args.approvalRepository}, s)
 		})
 	}
 }
 
 func TestShopService_GetInfo(t *testing.T) {
 	type inputArgs struct {
-		username                         string
-		getCoinsAmountOutputAmount       int
-		getCoinsAmountOutputError        error
-		getInventoryOutputInventory      []model.Item
-		getInventoryOutputError          error
-		getReceivedHistoryOutputReceived []model.Receive
-		getReceivedHistoryOutputError    error
-		getSentHistoryOutputSent         []model.Send
-		getSentHistoryOutputError        error
+		username                          string
+		getCoinsAmountOutputAmount        int
+		getCoinsAmountOutputError         error
+		getInventoryOutputInventory       []model.Item
+		getInventoryOutputError           error
+		getReceivedHistoryOutputReceived  []model.Receive
+		getReceivedHistoryOutputError     error
+		getSentHistoryOutputSent          []model.Send
+		getSentHistoryOutputError         error
+		getRefundHistoryOutputRefunds     []model.RefundHistory
+		getRefundHistoryOutputError       error
+		getGrantHistoryOutputGrants       []model.GrantHistory
+		getGrantHistoryOutputError        error
+		getApprovalHistoryOutputApprovals []model.TransferApproval
+		getApprovalHistoryOutputError     error
+		aggregate                         string
+		getCounterpartyHistoryOutputError error
 	}
 
 	tests := []struct {
@@ -142,6 +226,50 @@ func TestShopService_GetInfo(t *testing.T) {
 			},
 			wantErr: &apierror.InternalError,
 		},
+		{
+			name: "err get refund history",
+			args: inputArgs{
+				username:                    "username",
+				getCoinsAmountOutputAmount:  0,
+				getRefundHistoryOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantErr: &apierror.InternalError,
+		},
+		{
+			name: "err get grant history",
+			args: inputArgs{
+				username:                   "username",
+				getCoinsAmountOutputAmount: 0,
+				getGrantHistoryOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantErr: &apierror.InternalError,
+		},
+		{
+			name: "err get approval history",
+			args: inputArgs{
+				username:                      "username",
+				getCoinsAmountOutputAmount:    0,
+				getApprovalHistoryOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantErr: &apierror.InternalError,
+		},
+		{
+			name: "success aggregated per counterparty",
+			args: inputArgs{
+				username:                   "username",
+				getCoinsAmountOutputAmount: 1000,
+				aggregate:                  model.HistoryAggregateCounterparty,
+			},
+		},
+		{
+			name: "err get counterparty history",
+			args: inputArgs{
+				username:                          "username",
+				aggregate:                         model.HistoryAggregateCounterparty,
+				getCounterpartyHistoryOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			},
+			wantErr: &apierror.InternalError,
+		},
 	}
 	var log *slog.Logger
 	log = slog.New(
@@ -151,16 +279,25 @@ func TestShopService_GetInfo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			shopRepository := new(MockRepository)
-			s := NewShopService(log, shopRepository, shopRepository, shopRepository)
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, nil)
 			shopRepository.On("GetCoinsAmount", tt.args.username).
 				Return(tt.args.getCoinsAmountOutputAmount, tt.args.getCoinsAmountOutputError)
 			shopRepository.On("GetInventory", tt.args.username).
 				Return(tt.args.getInventoryOutputInventory, tt.args.getInventoryOutputError)
-			shopRepository.On("GetCoinReceivedHistory", tt.args.username).
+			shopRepository.On("GetCoinReceivedHistory", tt.args.username, 10).
 				Return(tt.args.getReceivedHistoryOutputReceived, tt.args.getReceivedHistoryOutputError)
-			shopRepository.On("GetCoinSentHistory", tt.args.username).
+			shopRepository.On("GetCoinSentHistory", tt.args.username, 10).
 				Return(tt.args.getSentHistoryOutputSent, tt.args.getSentHistoryOutputError)
-			info, err := s.GetInfo(tt.args.username)
+			shopRepository.On("GetRefundHistory", tt.args.username).
+				Return(tt.args.getRefundHistoryOutputRefunds, tt.args.getRefundHistoryOutputError)
+			shopRepository.On("GetGrantHistory", tt.args.username).
+				Return(tt.args.getGrantHistoryOutputGrants, tt.args.getGrantHistoryOutputError)
+			shopRepository.On("GetApprovalHistory", tt.args.username).
+				Return(tt.args.getApprovalHistoryOutputApprovals, tt.args.getApprovalHistoryOutputError)
+			shopRepository.On("GetCounterpartyHistory", tt.args.username).
+				Return([]model.CounterpartyHistory{{Direction: model.HistoryDirectionReceived, Counterparty: "user2",
+					Amount: 100, Count: 2}}, tt.args.getCounterpartyHistoryOutputError)
+			info, err := s.GetInfo(tt.args.username, model.InfoFilter{HistoryLimit: 10, Aggregate: tt.args.aggregate})
 			t.Log(tt.name, fmt.Sprintf("%T", err), err, info)
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
@@ -172,21 +309,34 @@ func TestShopService_GetInfo(t *testing.T) {
 			}
 			assert.NoError(t, err)
 
+			if tt.args.aggregate != "" {
+				assert.Len(t, info.Counterparties, 1)
+				shopRepository.AssertNotCalled(t, "GetCoinReceivedHistory", mock.Anything, mock.Anything)
+				shopRepository.AssertNotCalled(t, "GetCoinSentHistory", mock.Anything, mock.Anything)
+				return
+			}
+			shopRepository.AssertNotCalled(t, "GetCounterpartyHistory", mock.Anything)
 		})
 	}
 }
 
 func TestShopService_SendCoin(t *testing.T) {
 	type inputArgs struct {
-		sendCoinOutputErr error
-		username          string
-		send              model.Send
+		sendCoinOutputErr        error
+		reserveTransferOutputErr error
+		username                 string
+		send                     model.Send
+		key                      *model.IdempotencyKey
+		envTTL                   string
+		envThreshold             string
+		envApprovalTTL           string
 	}
 	tests := []struct {
 		name             string
 		args             inputArgs
 		wantErr          *apierror.APIError
 		wantedErrMessage string
+		wantApproval     bool
 	}{
 		{
 			name: "success",
@@ -210,6 +360,80 @@ func TestShopService_SendCoin(t *testing.T) {
 			},
 			wantErr: &apierror.InternalError,
 		},
+		{
+			name: "with idempotency key",
+			args: inputArgs{
+				username: "username",
+				send: model.Send{
+					ToUser: "toUser",
+					Amount: 344,
+				},
+				key:    &model.IdempotencyKey{Username: "username", Key: "key", StatusCode: 200},
+				envTTL: "24",
+			},
+		},
+		{
+			name: "idempotency key with non-numeric ttl",
+			args: inputArgs{
+				username: "username",
+				send: model.Send{
+					ToUser: "toUser",
+					Amount: 344,
+				},
+				key:    &model.IdempotencyKey{Username: "username", Key: "key", StatusCode: 200},
+				envTTL: "",
+			},
+			wantErr: &apierror.InternalError,
+		},
+		{
+			name: "below approval threshold",
+			args: inputArgs{
+				username:     "username",
+				send:         model.Send{ToUser: "toUser", Amount: 1000},
+				envThreshold: "1000",
+			},
+		},
+		{
+			name: "above approval threshold",
+			args: inputArgs{
+				username:       "username",
+				send:           model.Send{ToUser: "toUser", Amount: 1001},
+				key:            &model.IdempotencyKey{Username: "username", Key: "key", StatusCode: 200},
+				envTTL:         "24",
+				envThreshold:   "1000",
+				envApprovalTTL: "48",
+			},
+			wantApproval: true,
+		},
+		{
+			name: "err in repository.ReserveTransfer",
+			args: inputArgs{
+				reserveTransferOutputErr: apierror.NewAPIErrorWithMsg(apierror.NotEnoughMoneyError, "mock"),
+				username:                 "username",
+				send:                     model.Send{ToUser: "toUser", Amount: 1001},
+				envThreshold:             "1000",
+				envApprovalTTL:           "48",
+			},
+			wantErr: &apierror.NotEnoughMoneyError,
+		},
+		{
+			name: "non-numeric approval threshold",
+			args: inputArgs{
+				username:     "username",
+				send:         model.Send{ToUser: "toUser", Amount: 344},
+				envThreshold: "many",
+			},
+			wantErr: &apierror.InternalError,
+		},
+		{
+			name: "approval without ttl",
+			args: inputArgs{
+				username:     "username",
+				send:         model.Send{ToUser: "toUser", Amount: 1001},
+				envThreshold: "1000",
+			},
+			wantErr: &apierror.InternalError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -218,11 +442,17 @@ func TestShopService_SendCoin(t *testing.T) {
 			log = slog.New(
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
+			os.Setenv(model.EnvIdempotencyKeyTTL, tt.args.envTTL)
+			t.Setenv(model.EnvApprovalThreshold, tt.args.envThreshold)
+			t.Setenv(model.EnvApprovalTTL, tt.args.envApprovalTTL)
 			shopRepository := new(MockRepository)
-			s := NewShopService(log, shopRepository, shopRepository, shopRepository)
-			shopRepository.On("SendCoin", mock.Anything, mock.Anything, mock.Anything).
+			approvalRepository := new(MockApprovalRepository)
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, approvalRepository)
+			shopRepository.On("SendCoin", mock.Anything, mock.Anything, mock.Anything, tt.args.key).
 				Return(tt.args.sendCoinOutputErr)
-			err := s.SendCoin(tt.args.username, tt.args.send)
+			approvalRepository.On("ReserveTransfer", tt.args.username, tt.args.send, mock.Anything, mock.Anything, tt.args.key).
+				Return(model.TransferApproval{ID: 1, Status: model.ApprovalStatusPending}, tt.args.reserveTransferOutputErr)
+			approval, err := s.SendCoin(tt.args.username, tt.args.send, tt.args.key)
 
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
@@ -233,7 +463,22 @@ func TestShopService_SendCoin(t *testing.T) {
 				return
 			}
 			assert.NoError(t, err)
-
+			if tt.args.key != nil {
+				assert.WithinDuration(t, time.Now().Add(24*time.Hour), tt.args.key.ExpiresAt, time.Minute)
+			}
+			if !tt.wantApproval {
+				assert.Nil(t, approval)
+				approvalRepository.AssertNotCalled(t, "ReserveTransfer",
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.Equal(t, int64(1), approval.ID)
+			assert.Equal(t, 202, tt.args.key.StatusCode)
+			shopRepository.AssertNotCalled(t, "SendCoin", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			approvalRepository.AssertCalled(t, "ReserveTransfer", tt.args.username, tt.args.send, mock.Anything,
+				mock.MatchedBy(func(expiresAt time.Time) bool {
+					return expiresAt.Sub(time.Now().Add(48*time.Hour)).Abs() < time.Minute
+				}), tt.args.key)
 		})
 	}
 }
@@ -275,10 +520,10 @@ func TestShopService_Buy(t *testing.T) {
 				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 			)
 			shopRepository := new(MockRepository)
-			s := NewShopService(log, shopRepository, shopRepository, shopRepository)
-			shopRepository.On("Buy", mock.Anything, mock.Anything).
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, nil)
+			shopRepository.On("Buy", mock.Anything, mock.Anything, 1, (*model.IdempotencyKey)(nil)).
 				Return(tt.args.buyOutputErr)
-			err := s.Buy(tt.args.username, tt.args.item)
+			err := s.Buy(tt.args.username, tt.args.item, 1, nil)
 
 			if tt.wantErr != nil {
 				var apiErr apierror.APIError
@@ -293,3 +538,207 @@ func TestShopService_Buy(t *testing.T) {
 		})
 	}
 }
+
+func TestShopService_Checkout(t *testing.T) {
+	lines := []model.OrderLine{{Type: "cup", Quantity: 2}, {Type: "pen", Quantity: 3}}
+	order := model.Order{
+		Items: []model.OrderLineOutput{
+			{Type: "cup", Quantity: 2, UnitPrice: 20, Amount: 40},
+			{Type: "pen", Quantity: 3, UnitPrice: 10, Amount: 30},
+		},
+		Total: 70,
+	}
+
+	tests := []struct {
+		name              string
+		checkoutOutputErr error
+		wantErr           *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name: "error in repository.Checkout",
+			checkoutOutputErr: apierror.NewAPIErrorWithDetails(apierror.NotEnoughMoneyError, "mock",
+				model.OrderErrorDetails{Total: 70, Balance: 50}),
+			wantErr: &apierror.NotEnoughMoneyError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log *slog.Logger
+			log = slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			shopRepository := new(MockRepository)
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, nil)
+			shopRepository.On("Checkout", "username", lines, (*model.IdempotencyKey)(nil)).Return(order, tt.checkoutOutputErr)
+
+			got, err := s.Checkout("username", model.OrderInput{Items: lines}, nil)
+
+			if tt.wantErr != nil {
+				apiErr := apierror.GetAPIError(err)
+				assert.Equal(t, tt.wantErr.Status, apiErr.Status)
+				assert.Equal(t, tt.wantErr.Message, apiErr.Message)
+				assert.Equal(t, model.OrderErrorDetails{Total: 70, Balance: 50}, apiErr.Details)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, order, got)
+		})
+	}
+}
+
+func TestShopService_GetPurchases(t *testing.T) {
+	filter := model.PurchasesFilter{Limit: 10}
+	purchases := []model.Purchase{{OrderID: 1, Type: "cup", Quantity: 2, UnitPrice: 20, Amount: 40}}
+
+	tests := []struct {
+		name                          string
+		getPurchaseHistoryOutputError error
+		wantErr                       *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                          "error in repository.GetPurchaseHistory",
+			getPurchaseHistoryOutputError: apierror.NewAPIErrorWithMsg(apierror.InternalError, "mock"),
+			wantErr:                       &apierror.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			shopRepository := new(MockRepository)
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, nil)
+			shopRepository.On("GetPurchaseHistory", "username", filter).
+				Return(purchases, tt.getPurchaseHistoryOutputError)
+
+			got, err := s.GetPurchases("username", filter)
+
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, purchases, got)
+		})
+	}
+}
+
+func TestShopService_GrantCoins(t *testing.T) {
+	input := model.GrantInput{
+		Reason: "hackathon prize",
+		Grants: []model.GrantLine{{Username: "user1", Amount: 500}, {Username: "user2", Amount: 300}},
+	}
+
+	tests := []struct {
+		name            string
+		dryRun          bool
+		grantOutput     model.GrantReport
+		grantOutputErr  error
+		wantErr         *apierror.APIError
+		wantReportTotal int
+	}{
+		{
+			name:            "success",
+			grantOutput:     model.GrantReport{ID: 1, Total: 800},
+			wantReportTotal: 800,
+		},
+		{
+			name:            "dry run",
+			dryRun:          true,
+			grantOutput:     model.GrantReport{DryRun: true, Total: 800},
+			wantReportTotal: 800,
+		},
+		{
+			name:           "unknown recipient",
+			grantOutputErr: apierror.NewAPIErrorWithMsg(apierror.NoSuchUserError, "mock"),
+			wantErr:        &apierror.NoSuchUserError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := slog.New(
+				slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+			)
+			shopRepository := new(MockRepository)
+			s := NewShopService(log, shopRepository, shopRepository, shopRepository, nil)
+			shopRepository.On("GrantCoins", model.GrantBatch{
+				Reason:    input.Reason,
+				GrantedBy: "admin",
+				Grants:    input.Grants,
+				DryRun:    tt.dryRun,
+			}, (*model.IdempotencyKey)(nil)).Return(tt.grantOutput, tt.grantOutputErr)
+
+			report, err := s.GrantCoins("admin", input, tt.dryRun, nil)
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantReportTotal, report.Total)
+		})
+	}
+}
+
+func TestShopService_getTransferLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    model.TransferLimits
+		wantErr *apierror.APIError
+	}{
+		{
+			name: "no limits",
+			env: map[string]string{
+				model.EnvTransferMaxAmount:       "",
+				model.EnvTransferDailyAmount:     "",
+				model.EnvTransferDailyCount:      "",
+				model.EnvTransferDailyRecipients: "",
+			},
+		},
+		{
+			name: "all limits",
+			env: map[string]string{
+				model.EnvTransferMaxAmount:       "500",
+				model.EnvTransferDailyAmount:     "1000",
+				model.EnvTransferDailyCount:      "10",
+				model.EnvTransferDailyRecipients: "5",
+			},
+			want: model.TransferLimits{MaxAmount: 500, DailyAmount: 1000, DailyCount: 10, DailyRecipients: 5},
+		},
+		{
+			name: "non-numeric limit",
+			env: map[string]string{
+				model.EnvTransferMaxAmount:       "",
+				model.EnvTransferDailyAmount:     "a lot",
+				model.EnvTransferDailyCount:      "",
+				model.EnvTransferDailyRecipients: "",
+			},
+			wantErr: &apierror.InternalError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for env, value := range tt.env {
+				t.Setenv(env, value)
+			}
+
+			limits, err := getTransferLimits()
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, limits)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+const (
+	tokenIDLength      = 16
+	refreshTokenLength = 32
+)
+
+func randomToken(length int) (string, error) {
+	const op = "service.token.randomToken"
+
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		return "", apierror.NewAPIError(apierror.InternalError, errors.Wrapf(err, "%s: (failed read random bytes)", op))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashRefreshToken is what gets stored instead of the refresh token itself,
+// so a leaked table can't be used to refresh sessions.
+func hashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken returns an opaque refresh token and its record without username and family set.
+func newRefreshToken() (string, model.RefreshToken, error) {
+	const op = "service.token.newRefreshToken"
+
+	tokenTTL, err := strconv.Atoi(os.Getenv(model.EnvRefreshTokenTTLHours))
+	if err != nil {
+		return "", model.RefreshToken{}, apierror.NewAPIError(apierror.InternalError,
+			errors.Wrapf(err, "%s: (env %s must be numeric)", op, model.EnvRefreshTokenTTLHours))
+	}
+
+	refreshToken, err := randomToken(refreshTokenLength)
+	if err != nil {
+		return "", model.RefreshToken{}, err
+	}
+
+	return refreshToken, model.RefreshToken{
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(time.Duration(tokenTTL) * time.Hour),
+	}, nil
+}
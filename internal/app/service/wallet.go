@@ -0,0 +1,166 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type WalletRepository interface {
+	CreateWallet(name, owner string) (model.Wallet, error)
+	GetWallets(username string) ([]model.Wallet, error)
+	GetWallet(name, username string) (model.WalletDetails, error)
+	GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error)
+	SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error)
+	RemoveWalletMember(wallet, actor, username string) error
+	Contribute(wallet, username string, amount int, key *model.IdempotencyKey) (model.WalletActivity, error)
+	WalletSendCoin(transfer model.WalletTransfer, key *model.IdempotencyKey) (model.WalletActivity, error)
+	WalletBuy(wallet, owner, item string, quantity int, key *model.IdempotencyKey) (model.Order, error)
+}
+
+type WalletService struct {
+	logger           *slog.Logger
+	walletRepository WalletRepository
+}
+
+func NewWalletService(logger *slog.Logger, w WalletRepository) *WalletService {
+	return &WalletService{
+		logger:           logger,
+		walletRepository: w,
+	}
+}
+
+func (w *WalletService) CreateWallet(username string, input model.WalletInput) (model.Wallet, error) {
+	const op = "service.wallet.CreateWallet"
+
+	wallet, err := w.walletRepository.CreateWallet(input.Name, username)
+	if err != nil {
+		return model.Wallet{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+func (w *WalletService) GetWallets(username string) ([]model.Wallet, error) {
+	const op = "service.wallet.GetWallets"
+
+	wallets, err := w.walletRepository.GetWallets(username)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallets, nil
+}
+
+func (w *WalletService) GetWallet(username, name string) (model.WalletDetails, error) {
+	const op = "service.wallet.GetWallet"
+
+	wallet, err := w.walletRepository.GetWallet(name, username)
+	if err != nil {
+		return model.WalletDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+func (w *WalletService) GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error) {
+	const op = "service.wallet.GetWalletActivity"
+
+	activity, err := w.walletRepository.GetWalletActivity(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return activity, nil
+}
+
+func (w *WalletService) SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error) {
+	const op = "service.wallet.SetWalletMember"
+
+	wallet, err := w.walletRepository.SetWalletMember(membership)
+	if err != nil {
+		return model.WalletDetails{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return wallet, nil
+}
+
+func (w *WalletService) RemoveWalletMember(actor, wallet, username string) error {
+	const op = "service.wallet.RemoveWalletMember"
+
+	if err := w.walletRepository.RemoveWalletMember(wallet, actor, username); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (w *WalletService) Contribute(username, wallet string, amount int, key *model.IdempotencyKey) (model.WalletActivity, error) {
+	const op = "service.wallet.Contribute"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	activity, err := w.walletRepository.Contribute(wallet, username, amount, key)
+	if err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return activity, nil
+}
+
+// WalletSendCoin transfers coins from the wallet within the owner's transfer limits. A wallet has
+// no manager to approve a transfer, so transfers above the approval threshold are refused.
+func (w *WalletService) WalletSendCoin(owner, wallet string, send model.Send,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	const op = "service.wallet.WalletSendCoin"
+
+	limits, err := getTransferLimits()
+	if err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	threshold, err := getApprovalThreshold()
+	if err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if threshold > 0 && send.Amount > threshold {
+		return model.WalletActivity{}, apierror.NewAPIErrorWithDetails(apierror.TransferLimitExceededError,
+			op+": amount is above the approval threshold",
+			model.TransferLimitDetails{Limit: model.TransferLimitApprovalThreshold, Max: threshold, Remaining: threshold})
+	}
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	activity, err := w.walletRepository.WalletSendCoin(model.WalletTransfer{
+		Wallet: wallet,
+		Owner:  owner,
+		Send:   send,
+		Limits: limits,
+	}, key)
+	if err != nil {
+		return model.WalletActivity{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return activity, nil
+}
+
+func (w *WalletService) WalletBuy(owner, wallet, item string, quantity int, key *model.IdempotencyKey) (model.Order, error) {
+	const op = "service.wallet.WalletBuy"
+
+	if err := setIdempotencyKeyExpiry(key); err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	order, err := w.walletRepository.WalletBuy(wallet, owner, item, quantity, key)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return order, nil
+}
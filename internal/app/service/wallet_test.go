@@ -0,0 +1,194 @@
+package service
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/nosikmy/avito-shop/internal/app/apierror"
+	"github.com/nosikmy/avito-shop/internal/app/model"
+)
+
+type MockWalletRepository struct {
+	mock.Mock
+}
+
+func (m *MockWalletRepository) CreateWallet(name, owner string) (model.Wallet, error) {
+	args := m.Called(name, owner)
+	wallet, _ := args.Get(0).(model.Wallet)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletRepository) GetWallets(username string) ([]model.Wallet, error) {
+	args := m.Called(username)
+	wallets, _ := args.Get(0).([]model.Wallet)
+	return wallets, args.Error(1)
+}
+
+func (m *MockWalletRepository) GetWallet(name, username string) (model.WalletDetails, error) {
+	args := m.Called(name, username)
+	wallet, _ := args.Get(0).(model.WalletDetails)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletRepository) GetWalletActivity(filter model.WalletActivityFilter) ([]model.WalletActivity, error) {
+	args := m.Called(filter)
+	activity, _ := args.Get(0).([]model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletRepository) SetWalletMember(membership model.WalletMembership) (model.WalletDetails, error) {
+	args := m.Called(membership)
+	wallet, _ := args.Get(0).(model.WalletDetails)
+	return wallet, args.Error(1)
+}
+
+func (m *MockWalletRepository) RemoveWalletMember(wallet, actor, username string) error {
+	args := m.Called(wallet, actor, username)
+	return args.Error(0)
+}
+
+func (m *MockWalletRepository) Contribute(wallet, username string, amount int,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	args := m.Called(wallet, username, amount, key)
+	activity, _ := args.Get(0).(model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletRepository) WalletSendCoin(transfer model.WalletTransfer,
+	key *model.IdempotencyKey) (model.WalletActivity, error) {
+	args := m.Called(transfer, key)
+	activity, _ := args.Get(0).(model.WalletActivity)
+	return activity, args.Error(1)
+}
+
+func (m *MockWalletRepository) WalletBuy(wallet, owner, item string, quantity int,
+	key *model.IdempotencyKey) (model.Order, error) {
+	args := m.Called(wallet, owner, item, quantity, key)
+	order, _ := args.Get(0).(model.Order)
+	return order, args.Error(1)
+}
+
+func TestNewWalletService(t *testing.T) {
+	var log *slog.Logger
+	walletRepository := new(MockWalletRepository)
+
+	s := NewWalletService(log, walletRepository)
+	assert.Equal(t, &WalletService{
+		logger:           log,
+		walletRepository: walletRepository}, s)
+}
+
+func TestWalletService_WalletSendCoin(t *testing.T) {
+	type inputArgs struct {
+		send               model.Send
+		sendOutputError    error
+		envThreshold       string
+		envDailyAmount     string
+		wantRepositoryCall bool
+	}
+	tests := []struct {
+		name       string
+		args       inputArgs
+		wantLimits model.TransferLimits
+		wantErr    *apierror.APIError
+	}{
+		{
+			name: "success",
+			args: inputArgs{
+				send:               model.Send{ToUser: "user2", Amount: 100},
+				envDailyAmount:     "500",
+				wantRepositoryCall: true,
+			},
+			wantLimits: model.TransferLimits{DailyAmount: 500},
+		},
+		{
+			name: "above approval threshold",
+			args: inputArgs{
+				send:         model.Send{ToUser: "user2", Amount: 1001},
+				envThreshold: "1000",
+			},
+			wantErr: &apierror.TransferLimitExceededError,
+		},
+		{
+			name: "error in repository",
+			args: inputArgs{
+				send:               model.Send{ToUser: "user2", Amount: 100},
+				sendOutputError:    apierror.NewAPIErrorWithMsg(apierror.ForbiddenError, "mock"),
+				wantRepositoryCall: true,
+			},
+			wantErr: &apierror.ForbiddenError,
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(model.EnvIdempotencyKeyTTL, "24")
+			t.Setenv(model.EnvApprovalThreshold, tt.args.envThreshold)
+			t.Setenv(model.EnvTransferDailyAmount, tt.args.envDailyAmount)
+			walletRepository := new(MockWalletRepository)
+			s := NewWalletService(log, walletRepository)
+			walletRepository.On("WalletSendCoin", mock.Anything, mock.Anything).
+				Return(model.WalletActivity{ID: 1}, tt.args.sendOutputError)
+
+			_, err := s.WalletSendCoin("owner", "backend-team", tt.args.send, nil)
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if !tt.args.wantRepositoryCall {
+				walletRepository.AssertNotCalled(t, "WalletSendCoin", mock.Anything, mock.Anything)
+				return
+			}
+			walletRepository.AssertCalled(t, "WalletSendCoin", model.WalletTransfer{
+				Wallet: "backend-team",
+				Owner:  "owner",
+				Send:   tt.args.send,
+				Limits: tt.wantLimits,
+			}, (*model.IdempotencyKey)(nil))
+		})
+	}
+}
+
+func TestWalletService_RemoveWalletMember(t *testing.T) {
+	tests := []struct {
+		name              string
+		removeOutputError error
+		wantErr           *apierror.APIError
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:              "last owner",
+			removeOutputError: apierror.NewAPIErrorWithMsg(apierror.WalletLastOwnerError, "mock"),
+			wantErr:           &apierror.WalletLastOwnerError,
+		},
+	}
+
+	log := slog.New(
+		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walletRepository := new(MockWalletRepository)
+			s := NewWalletService(log, walletRepository)
+			walletRepository.On("RemoveWalletMember", "backend-team", "owner", "user2").Return(tt.removeOutputError)
+
+			err := s.RemoveWalletMember("owner", "backend-team", "user2")
+			if tt.wantErr != nil {
+				assert.True(t, apierror.Is(err, *tt.wantErr))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -19,6 +21,14 @@ import (
 	"github.com/nosikmy/avito-shop/internal/app/service"
 )
 
+const (
+	// approvalExpiryInterval is how often the server releases the coins of expired transfer approvals.
+	approvalExpiryInterval = time.Minute
+	// scheduledTransfersInterval is how often the server looks for due scheduled transfers, schedules
+	// have minute precision. Every replica runs the scheduler, each run is claimed by one of them.
+	scheduledTransfersInterval = 15 * time.Second
+)
+
 func main() {
 	log := slog.New(
 		slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
@@ -44,14 +54,53 @@ func main() {
 	}
 
 	authRepository := repository.NewAuthRepository(log, db)
+	tokenRepository := repository.NewTokenRepository(log, db)
 	historyRepository := repository.NewHistoryRepository(log, db)
 	infoRepository := repository.NewInfoRepository(log, db)
 	shoppingRepository := repository.NewShoppingRepository(log, db)
+	walletRepository := repository.NewWalletRepository(log, db)
+	approvalRepository := repository.NewApprovalRepository(log, db)
+	coinRequestRepository := repository.NewCoinRequestRepository(log, db)
+	scheduleRepository := repository.NewScheduleRepository(log, db)
+	catalogRepository := repository.NewCatalogRepository(log, db)
+	orderRepository := repository.NewOrderRepository(log, db)
+	reconcileRepository := repository.NewReconcileRepository(log, db)
+
+	passwordHasher, err := service.NewPasswordHasher(os.Getenv(model.EnvPasswordHasher))
+	if err != nil {
+		log.Error("error occurred while init password hasher: " + err.Error())
+		return
+	}
+
+	keyring, err := service.LoadKeyring()
+	if err != nil {
+		log.Error("error occurred while loading signing keys: " + err.Error())
+		return
+	}
 
-	authService := service.NewAuthService(log, authRepository)
-	shopService := service.NewShopService(log, infoRepository, historyRepository, shoppingRepository)
+	authService := service.NewAuthService(log, authRepository, tokenRepository, passwordHasher, keyring)
+	shopService := service.NewShopService(log, infoRepository, historyRepository, shoppingRepository, approvalRepository)
+	catalogService := service.NewCatalogService(log, catalogRepository)
+	orderService := service.NewOrderService(log, orderRepository)
+	walletService := service.NewWalletService(log, walletRepository)
+	approvalService := service.NewApprovalService(log, approvalRepository)
+	coinRequestService := service.NewCoinRequestService(log, coinRequestRepository)
+	scheduleService := service.NewScheduleService(log, scheduleRepository, shopService)
+	reconcileService := service.NewReconcileService(log, reconcileRepository)
+
+	// the reconciliation only runs inside the server when an interval is set
+	var reconcileInterval time.Duration
+	if interval := os.Getenv(model.EnvReconcileInterval); interval != "" {
+		minutes, err := strconv.Atoi(interval)
+		if err != nil || minutes <= 0 {
+			log.Error("env " + model.EnvReconcileInterval + " must be a positive number")
+			return
+		}
+		reconcileInterval = time.Duration(minutes) * time.Minute
+	}
 
-	handlers := handler.NewHandler(log, authService, shopService)
+	handlers := handler.NewHandler(log, authService, shopService, catalogService, orderService,
+		walletService, approvalService, coinRequestService, scheduleService)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
@@ -73,6 +122,13 @@ func main() {
 
 	log.Info("server is running om port: " + srvPort)
 
+	go approvalService.RunApprovalExpiry(ctx, approvalExpiryInterval)
+	go scheduleService.RunScheduledTransfers(ctx, scheduledTransfersInterval)
+
+	if reconcileInterval > 0 {
+		go reconcileService.RunPeriodically(ctx, reconcileInterval)
+	}
+
 	<-ctx.Done()
 
 	if err := srv.Shutdown(context.Background()); err != nil {
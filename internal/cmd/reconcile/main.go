@@ -0,0 +1,72 @@
+// Command reconcile checks the balances against the ledger and the coin history and prints
+// the report as JSON. It exits with status 1 if anything doesn't reconcile.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"github.com/nosikmy/avito-shop/internal/app/model"
+	"github.com/nosikmy/avito-shop/internal/app/repository"
+	"github.com/nosikmy/avito-shop/internal/app/service"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	log := slog.New(
+		slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}),
+	)
+
+	if err := godotenv.Load(); err != nil {
+		log.Error("error loading .env file: " + err.Error())
+		return 2
+	}
+
+	cfgDB := repository.Config{
+		Host:     os.Getenv(model.EnvDatabaseHost),
+		Port:     os.Getenv(model.EnvDatabasePort),
+		Username: os.Getenv(model.EnvDatabaseUser),
+		Password: os.Getenv(model.EnvDatabasePassword),
+		DBName:   os.Getenv(model.EnvDatabaseName),
+	}
+
+	db, err := repository.NewPostgresDB(cfgDB)
+	if err != nil {
+		log.Error("error occurred while init DB: " + err.Error())
+		return 2
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Error("can't close DB connection: " + err.Error())
+		}
+	}()
+
+	reconcileService := service.NewReconcileService(log, repository.NewReconcileRepository(log, db))
+
+	report, err := reconcileService.Reconcile(context.Background())
+	if err != nil {
+		log.Error("error while reconciling balances: " + err.Error())
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Error("error while writing report: " + err.Error())
+		return 2
+	}
+
+	if !report.OK {
+		return 1
+	}
+
+	return 0
+}
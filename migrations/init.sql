@@ -2,13 +2,19 @@ CREATE TABLE users
 (
     username      VARCHAR PRIMARY KEY,
     password_hash VARCHAR NOT NULL,
-    balance       INTEGER
+    balance       INTEGER,
+    role          VARCHAR NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin', 'auditor')),
+    manager       VARCHAR REFERENCES users (username)
 );
 
 CREATE TABLE items
 (
-    type  VARCHAR PRIMARY KEY,
-    price INTEGER
+    type                VARCHAR PRIMARY KEY,
+    price               INTEGER CHECK (price > 0),
+    description         VARCHAR NOT NULL DEFAULT '',
+    active              BOOLEAN NOT NULL DEFAULT true,
+    stock               INTEGER CHECK (stock >= 0),
+    low_stock_threshold INTEGER NOT NULL DEFAULT 0 CHECK (low_stock_threshold >= 0)
 );
 
 INSERT INTO items
@@ -23,18 +29,246 @@ VALUES ('t-shirt', 80),
        ('wallet', 50),
        ('pink-hoody', 500);
 
+-- a wallet shared by a team, wallets.balance is a cached projection of the wallet:<name> account
+CREATE TABLE wallets
+(
+    name       VARCHAR PRIMARY KEY,
+    balance    INTEGER     NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_by VARCHAR     NOT NULL REFERENCES users (username),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- owners spend from the wallet and manage its members, every member can contribute to it
+CREATE TABLE wallet_members
+(
+    wallet   VARCHAR     NOT NULL REFERENCES wallets (name),
+    username VARCHAR     NOT NULL REFERENCES users (username),
+    role     VARCHAR     NOT NULL CHECK (role IN ('owner', 'member')),
+    added_by VARCHAR     NOT NULL REFERENCES users (username),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (wallet, username)
+);
+
+CREATE INDEX wallet_members_username_idx ON wallet_members (username);
+
+-- every coin movement of a wallet with the member who made it, amount is negative for spending
+CREATE TABLE wallet_activity
+(
+    id           BIGSERIAL PRIMARY KEY,
+    wallet       VARCHAR     NOT NULL REFERENCES wallets (name),
+    username     VARCHAR     NOT NULL REFERENCES users (username),
+    kind         VARCHAR     NOT NULL CHECK (kind IN ('contribution', 'transfer', 'purchase', 'refund')),
+    amount       INTEGER     NOT NULL CHECK (amount <> 0),
+    counterparty VARCHAR     NOT NULL DEFAULT '',
+    reference    VARCHAR     NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX wallet_activity_wallet_idx ON wallet_activity (wallet, id);
+CREATE INDEX wallet_activity_username_idx ON wallet_activity (username);
+
+-- a transfer paid from a wallet has the owner who made it as its sender
 CREATE TABLE transactions
 (
+    id         BIGSERIAL PRIMARY KEY,
     sender     VARCHAR REFERENCES users (username),
     receiver   VARCHAR REFERENCES users (username),
     amount     INTEGER,
-    created_at TIMESTAMP DEFAULT now()
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    message    VARCHAR     NOT NULL DEFAULT '',
+    category   VARCHAR     NOT NULL DEFAULT 'other'
+        CHECK (category IN ('gratitude', 'repayment', 'gift', 'reward', 'other')),
+    wallet     VARCHAR REFERENCES wallets (name)
 );
 
-CREATE TABLE purchases
+-- the coin history is paged by (created_at, id) from the latest transfer
+CREATE INDEX transactions_sender_created_at_idx ON transactions (sender, created_at, id);
+CREATE INDEX transactions_receiver_created_at_idx ON transactions (receiver, created_at, id);
+-- the admin export goes through all the transfers in the order they were made
+CREATE INDEX transactions_created_at_idx ON transactions (created_at, id);
+
+CREATE TABLE orders
 (
-    username VARCHAR REFERENCES users (username),
-    item     VARCHAR REFERENCES items (type),
-    quantity INTEGER,
-    CONSTRAINT username_item UNIQUE (username, item)
-)
\ No newline at end of file
+    id           BIGSERIAL PRIMARY KEY,
+    username     VARCHAR     NOT NULL REFERENCES users (username),
+    status       VARCHAR     NOT NULL CHECK (status IN ('created', 'paid', 'ready_for_pickup', 'delivered', 'cancelled')),
+    total        INTEGER     NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    paid_at      TIMESTAMPTZ,
+    ready_at     TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ,
+    -- the shared wallet the order was paid from, its refund goes back to the wallet
+    wallet       VARCHAR REFERENCES wallets (name)
+);
+
+CREATE INDEX orders_username_idx ON orders (username);
+
+-- every purchased line with the price that was paid at the moment of the purchase
+CREATE TABLE order_items
+(
+    order_id   BIGINT      NOT NULL REFERENCES orders (id),
+    item       VARCHAR     NOT NULL REFERENCES items (type),
+    quantity   INTEGER     NOT NULL CHECK (quantity > 0),
+    unit_price INTEGER     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (order_id, item)
+);
+
+CREATE TABLE refunds
+(
+    id          BIGSERIAL PRIMARY KEY,
+    order_id    BIGINT      NOT NULL UNIQUE REFERENCES orders (id),
+    username    VARCHAR     NOT NULL REFERENCES users (username),
+    amount      INTEGER     NOT NULL,
+    reason      VARCHAR     NOT NULL DEFAULT '',
+    refunded_by VARCHAR     NOT NULL REFERENCES users (username),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refunds_username_idx ON refunds (username);
+
+-- the inventory of a user is everything they have paid for and haven't cancelled
+CREATE VIEW purchases AS
+SELECT o.username, oi.item, SUM(oi.quantity)::INTEGER AS quantity
+FROM orders o
+         JOIN order_items oi ON oi.order_id = o.id
+WHERE o.status IN ('paid', 'ready_for_pickup', 'delivered')
+GROUP BY o.username, oi.item;
+
+CREATE TABLE coin_grants
+(
+    id         BIGSERIAL PRIMARY KEY,
+    reason     VARCHAR     NOT NULL,
+    granted_by VARCHAR     NOT NULL REFERENCES users (username),
+    total      INTEGER     NOT NULL CHECK (total > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE coin_grant_items
+(
+    grant_id BIGINT  NOT NULL REFERENCES coin_grants (id),
+    username VARCHAR NOT NULL REFERENCES users (username),
+    amount   INTEGER NOT NULL CHECK (amount > 0),
+    PRIMARY KEY (grant_id, username)
+);
+
+CREATE INDEX coin_grant_items_username_idx ON coin_grant_items (username);
+
+CREATE TABLE transfer_approvals
+(
+    id         BIGSERIAL PRIMARY KEY,
+    sender     VARCHAR     NOT NULL REFERENCES users (username),
+    receiver   VARCHAR     NOT NULL REFERENCES users (username),
+    amount     INTEGER     NOT NULL CHECK (amount > 0),
+    message    VARCHAR     NOT NULL DEFAULT '',
+    category   VARCHAR     NOT NULL DEFAULT 'other',
+    status     VARCHAR     NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'rejected', 'expired')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    decided_by VARCHAR REFERENCES users (username),
+    decided_at TIMESTAMPTZ
+);
+
+CREATE INDEX transfer_approvals_sender_idx ON transfer_approvals (sender);
+CREATE INDEX transfer_approvals_receiver_idx ON transfer_approvals (receiver);
+CREATE INDEX transfer_approvals_pending_idx ON transfer_approvals (expires_at) WHERE status = 'pending';
+
+-- a request of the requester to be paid by the payer, an accepted request above the approval threshold
+-- refers to the approval of its transfer and is reopened if the approval is rejected or expires
+CREATE TABLE coin_requests
+(
+    id          BIGSERIAL PRIMARY KEY,
+    requester   VARCHAR     NOT NULL REFERENCES users (username),
+    payer       VARCHAR     NOT NULL REFERENCES users (username),
+    amount      INTEGER     NOT NULL CHECK (amount > 0),
+    message     VARCHAR     NOT NULL DEFAULT '',
+    category    VARCHAR     NOT NULL DEFAULT 'repayment'
+        CHECK (category IN ('gratitude', 'repayment', 'gift', 'reward', 'other')),
+    status      VARCHAR     NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined')),
+    approval_id BIGINT REFERENCES transfer_approvals (id),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    decided_at  TIMESTAMPTZ,
+    CHECK (requester <> payer)
+);
+
+CREATE INDEX coin_requests_requester_idx ON coin_requests (requester);
+CREATE INDEX coin_requests_payer_idx ON coin_requests (payer);
+CREATE INDEX coin_requests_approval_idx ON coin_requests (approval_id) WHERE approval_id IS NOT NULL;
+
+-- a one-shot transfer has no cron, next_run_at is NULL once a schedule is completed or cancelled
+CREATE TABLE scheduled_transfers
+(
+    id          BIGSERIAL PRIMARY KEY,
+    sender      VARCHAR     NOT NULL REFERENCES users (username),
+    receiver    VARCHAR     NOT NULL REFERENCES users (username),
+    amount      INTEGER     NOT NULL CHECK (amount > 0),
+    message     VARCHAR     NOT NULL DEFAULT '',
+    category    VARCHAR     NOT NULL DEFAULT 'other'
+        CHECK (category IN ('gratitude', 'repayment', 'gift', 'reward', 'other')),
+    cron        VARCHAR,
+    status      VARCHAR     NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_error  VARCHAR,
+    runs        INTEGER     NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (sender <> receiver),
+    CHECK ((status = 'active') = (next_run_at IS NOT NULL))
+);
+
+CREATE INDEX scheduled_transfers_sender_idx ON scheduled_transfers (sender);
+CREATE INDEX scheduled_transfers_due_idx ON scheduled_transfers (next_run_at) WHERE status = 'active';
+
+CREATE SEQUENCE ledger_postings_seq;
+
+-- every coin movement is a posting of two entries with opposite amounts, so the entries of a posting sum to zero;
+-- users.balance is a cached projection of the user:<username> accounts, wallets.balance of the wallet:<name> ones
+CREATE TABLE ledger_entries
+(
+    id         BIGSERIAL PRIMARY KEY,
+    posting_id BIGINT      NOT NULL,
+    account    VARCHAR     NOT NULL,
+    amount     INTEGER     NOT NULL CHECK (amount <> 0),
+    kind       VARCHAR     NOT NULL
+        CHECK (kind IN ('start_grant', 'transfer', 'purchase', 'refund', 'grant', 'reserve', 'release', 'contribution')),
+    reference  VARCHAR     NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_account_idx ON ledger_entries (account);
+CREATE INDEX ledger_entries_posting_id_idx ON ledger_entries (posting_id);
+
+CREATE TABLE idempotency_keys
+(
+    username     VARCHAR     NOT NULL REFERENCES users (username),
+    key          VARCHAR     NOT NULL,
+    request_hash VARCHAR     NOT NULL,
+    status_code  INTEGER     NOT NULL,
+    response     BYTEA       NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (username, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+CREATE TABLE refresh_tokens
+(
+    token_hash VARCHAR PRIMARY KEY,
+    username   VARCHAR     NOT NULL REFERENCES users (username),
+    family_id  VARCHAR     NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    used_at    TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+CREATE TABLE revoked_tokens
+(
+    jti        VARCHAR PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);